@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Client queries the API of an orchestrator serving a results database.
+type Client struct {
+	BaseURL string // e.g., http://localhost:8080
+	HTTP    *http.Client
+}
+
+// NewClient returns a client of the server at the base URL.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		HTTP:    &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Projects lists the projects.
+func (c *Client) Projects(q Query) (*ProjectPage, error) {
+	var page ProjectPage
+	return &page, c.get(PATH_PROJECTS, q, &page)
+}
+
+// Experiments lists the experiments, filtered by project, status and origin.
+func (c *Client) Experiments(q Query) (*ExperimentPage, error) {
+	var page ExperimentPage
+	return &page, c.get(PATH_EXPERIMENTS, q, &page)
+}
+
+// Experiment returns the experiment with its config and arguments.
+func (c *Client) Experiment(id int64) (*Experiment, error) {
+	var experiment Experiment
+	return &experiment, c.get(PATH_EXPERIMENTS+"/"+strconv.FormatInt(id, 10), Query{}, &experiment)
+}
+
+// Benchmarks lists the benchmarks, filtered by project, experiments, tags and benchmark rules.
+func (c *Client) Benchmarks(q Query) (*BenchmarkPage, error) {
+	var page BenchmarkPage
+	return &page, c.get(PATH_BENCHMARKS, q, &page)
+}
+
+// Tags lists the tags benchmarks were discovered on, filtered by project.
+func (c *Client) Tags(q Query) (*TagPage, error) {
+	var page TagPage
+	return &page, c.get(PATH_TAGS, q, &page)
+}
+
+// Measurements returns a page of measurements, filtered by project, experiments, tags and benchmark rules.
+func (c *Client) Measurements(q Query) (*MeasurementPage, error) {
+	var page MeasurementPage
+	return &page, c.get(PATH_MEASUREMENTS, q, &page)
+}
+
+// AllMeasurements pages through all measurements matching the query, starting at its offset.
+func (c *Client) AllMeasurements(q Query) ([]Measurement, error) {
+	var all []Measurement
+	for {
+		page, err := c.Measurements(q)
+		if err != nil {
+			return all, err
+		}
+		all = append(all, page.Items...)
+		q.Offset = page.Offset + len(page.Items)
+		if len(page.Items) == 0 || q.Offset >= page.Total {
+			return all, nil
+		}
+	}
+}
+
+// Stats returns the statistics of ns/op per benchmark and tag, filtered like measurements.
+func (c *Client) Stats(q Query) (*StatsPage, error) {
+	var page StatsPage
+	return &page, c.get(PATH_STATS, q, &page)
+}
+
+// get requests the path and decodes the JSON response into v.
+func (c *Client) get(path string, q Query, v any) error {
+	url := c.BaseURL + path
+	if values := q.Values(); len(values) > 0 {
+		url += "?" + values.Encode()
+	}
+	resp, err := c.HTTP.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr Error
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return errors.Errorf("%s: %s", resp.Status, apiErr.Error)
+		}
+		return errors.New(resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errors.Wrapf(err, "decoding response of %s", path)
+	}
+	return nil
+}
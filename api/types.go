@@ -0,0 +1,199 @@
+// Package api describes the read-only HTTP/JSON API the orchestrator serves over a results database
+// (orchestrator serve), and provides a client for it.
+package api
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Endpoints, relative to the base URL of the server. Experiments are also served individually at PATH_EXPERIMENTS/<id>.
+const (
+	PATH_PROJECTS     = "/api/v1/projects"
+	PATH_EXPERIMENTS  = "/api/v1/experiments"
+	PATH_BENCHMARKS   = "/api/v1/benchmarks"
+	PATH_TAGS         = "/api/v1/tags"
+	PATH_MEASUREMENTS = "/api/v1/measurements"
+	PATH_STATS        = "/api/v1/stats"
+)
+
+// Page sizes of list endpoints
+const (
+	DEFAULT_LIMIT = 1000
+	MAX_LIMIT     = 10000
+)
+
+type (
+	// Query filters and pages the results of list endpoints, empty fields do not restrict.
+	// Not every endpoint supports every filter, unsupported ones are ignored.
+	Query struct {
+		Project     string
+		Experiments []int64
+		Tags        []string
+		Benchmarks  []string // filter rules like include in the config, e.g., BenchmarkEncode* or pkg:./codec/*
+		Status      string   // experiments only
+		Origin      string   // experiments only
+		Limit       int      // 0 is DEFAULT_LIMIT
+		Offset      int
+	}
+
+	// Page describes the slice of a list returned by a request.
+	Page struct {
+		Total  int `json:"total"`
+		Limit  int `json:"limit"`
+		Offset int `json:"offset"`
+	}
+
+	Project struct {
+		Name        string `json:"name"`
+		BasePackage string `json:"basePackage"`
+		Experiments int    `json:"experiments"`
+		Benchmarks  int    `json:"benchmarks"`
+	}
+
+	// Experiment is a run of the orchestrator, or imported or merged results. Config and Args are only
+	// returned for a single experiment.
+	Experiment struct {
+		Id                  int64      `json:"id"`
+		Project             string     `json:"project"`
+		Status              string     `json:"status"`
+		StartedAt           time.Time  `json:"startedAt"`
+		FinishedAt          *time.Time `json:"finishedAt,omitempty"`
+		OrchestratorVersion string     `json:"orchestratorVersion"`
+		RunnerVersion       string     `json:"runnerVersion"`
+		BedSetup            int        `json:"bedSetup"`
+		ItSetup             int        `json:"itSetup"`
+		SrSetup             int        `json:"srSetup"`
+		IrSetup             int        `json:"irSetup"`
+		Origin              string     `json:"origin"`
+		Source              string     `json:"source,omitempty"`
+		Measurements        int        `json:"measurements"`
+		Config              string     `json:"config,omitempty"`
+		Args                string     `json:"args,omitempty"`
+	}
+
+	Benchmark struct {
+		Id       int64             `json:"id"`
+		Name     string            `json:"name"`
+		Package  string            `json:"package"`
+		Project  string            `json:"project"`
+		Module   string            `json:"module"`
+		Function string            `json:"function"`
+		Sub      string            `json:"sub,omitempty"` // sub-benchmark path
+		Params   map[string]string `json:"params,omitempty"`
+		Procs    int               `json:"procs"`
+		Labels   []string          `json:"labels,omitempty"`
+		Tags     []string          `json:"tags"`
+	}
+
+	// Tag is a revision benchmarks were discovered on.
+	Tag struct {
+		Project    string `json:"project"`
+		Tag        string `json:"tag"`
+		Benchmarks int    `json:"benchmarks"`
+	}
+
+	// Measurement is one result of a benchmark execution, IDs are 0 if the measurement has no reference.
+	Measurement struct {
+		Id           int64   `json:"id"`
+		ExperimentId int64   `json:"experimentId,omitempty"`
+		BenchmarkId  int64   `json:"benchmarkId,omitempty"`
+		HostId       int64   `json:"hostId,omitempty"`
+		Name         string  `json:"name"`
+		Package      string  `json:"package"`
+		Project      string  `json:"project"`
+		Tag          string  `json:"tag"`
+		N            int     `json:"n"`
+		NsPerOp      float64 `json:"nsPerOp"`
+		BedSetup     int     `json:"bedSetup"`
+		ItSetup      int     `json:"itSetup"`
+		SrSetup      int     `json:"srSetup"`
+		IrSetup      int     `json:"irSetup"`
+		BedPos       int     `json:"bedPos"`
+		ItPos        int     `json:"itPos"`
+		SrPos        int     `json:"srPos"`
+		IrPos        int     `json:"irPos"`
+		CountIndex   int     `json:"countIndex"`
+	}
+
+	// Stats aggregates the ns/op of the measurements of a benchmark on a tag.
+	Stats struct {
+		Name    string  `json:"name"`
+		Package string  `json:"package"`
+		Project string  `json:"project"`
+		Tag     string  `json:"tag"`
+		Count   int     `json:"count"`
+		Mean    float64 `json:"mean"`
+		Median  float64 `json:"median"`
+		StdDev  float64 `json:"stdDev"`
+		Cv      float64 `json:"cv"`
+		Min     float64 `json:"min"`
+		Max     float64 `json:"max"`
+	}
+
+	ProjectPage struct {
+		Page
+		Items []Project `json:"items"`
+	}
+
+	ExperimentPage struct {
+		Page
+		Items []Experiment `json:"items"`
+	}
+
+	BenchmarkPage struct {
+		Page
+		Items []Benchmark `json:"items"`
+	}
+
+	TagPage struct {
+		Page
+		Items []Tag `json:"items"`
+	}
+
+	MeasurementPage struct {
+		Page
+		Items []Measurement `json:"items"`
+	}
+
+	StatsPage struct {
+		Page
+		Items []Stats `json:"items"`
+	}
+
+	// Error is the body of failed requests.
+	Error struct {
+		Error string `json:"error"`
+	}
+)
+
+// Values encodes the query as URL parameters, lists are repeated parameters.
+func (q Query) Values() url.Values {
+	values := url.Values{}
+	if q.Project != "" {
+		values.Set("project", q.Project)
+	}
+	for _, e := range q.Experiments {
+		values.Add("experiment", strconv.FormatInt(e, 10))
+	}
+	for _, t := range q.Tags {
+		values.Add("tag", t)
+	}
+	for _, b := range q.Benchmarks {
+		values.Add("bench", b)
+	}
+	if q.Status != "" {
+		values.Set("status", q.Status)
+	}
+	if q.Origin != "" {
+		values.Set("origin", q.Origin)
+	}
+	if q.Limit != 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset != 0 {
+		values.Set("offset", strconv.Itoa(q.Offset))
+	}
+	return values
+}
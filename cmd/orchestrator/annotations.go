@@ -0,0 +1,100 @@
+package main
+
+import (
+	"cloud-benchmark-tool/common"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// RULE_SKIP_ANNOTATION is recorded as exclusion rule of benchmarks skipped in the source.
+const RULE_SKIP_ANNOTATION = common.ANNOTATION_PREFIX + "skip"
+
+// readAnnotations parses the test files of the packages of the discovered benchmarks in the checked out
+// revision, and attaches the cbt directives of each Benchmark function to it and its sub-benchmarks.
+// Malformed directives are logged and ignored.
+func readAnnotations(projPath string, benchmarks []common.Benchmark) error {
+	byDir := make(map[string]map[string]common.Annotations) // package directory -> function -> annotations
+
+	for i := range benchmarks {
+		dir := filepath.Join(projPath, benchmarks[i].Module, benchmarks[i].Package)
+		annotations, parsed := byDir[dir]
+		if !parsed {
+			var err error
+			annotations, err = parseAnnotations(dir)
+			if err != nil {
+				return err
+			}
+			byDir[dir] = annotations
+		}
+
+		function := common.ParseBenchmarkName(benchmarks[i].Name, 1).Function
+		benchmarks[i].Annotations = annotations[function]
+	}
+	return nil
+}
+
+// applySkipAnnotations removes the benchmarks annotated with //cbt:skip, and returns them as exclusions.
+func applySkipAnnotations(benchmarks []common.Benchmark) ([]common.Benchmark, []exclusion) {
+	kept := make([]common.Benchmark, 0, len(benchmarks))
+	skipped := make([]exclusion, 0)
+	for _, b := range benchmarks {
+		if !b.Annotations.Skip {
+			kept = append(kept, b)
+			continue
+		}
+		log.Infof("Excluding benchmark %s in %s, rule: %s", b.Name, b.ProjectPackage(), RULE_SKIP_ANNOTATION)
+		skipped = append(skipped, exclusion{Benchmark: b, Rule: RULE_SKIP_ANNOTATION})
+	}
+	return kept, skipped
+}
+
+// parseAnnotations reads the directives of all Benchmark functions declared in the test files of the directory.
+func parseAnnotations(dir string) (map[string]common.Annotations, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading package directory %s", dir)
+	}
+
+	annotations := make(map[string]common.Annotations)
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), "_test.go") {
+			continue
+		}
+		fileName := filepath.Join(dir, entry.Name())
+		file, err := parser.ParseFile(fset, fileName, nil, parser.ParseComments)
+		if err != nil {
+			log.Warnf("Skipping annotations of %s: %v", fileName, err)
+			continue
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || fn.Doc == nil || !isBenchmarkName(fn.Name.Name) {
+				continue
+			}
+			comments := make([]string, 0, len(fn.Doc.List))
+			for _, c := range fn.Doc.List {
+				comments = append(comments, c.Text)
+			}
+
+			ann, err := common.ParseAnnotations(comments)
+			if err != nil {
+				log.Warnf("Ignoring annotations of %s in %s: %v", fn.Name.Name, fileName, err)
+				continue
+			}
+			if !ann.Empty() {
+				log.Debugf("Annotations of %s in %s: %+v", fn.Name.Name, fileName, ann)
+				annotations[fn.Name.Name] = ann
+			}
+		}
+	}
+	return annotations, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/tools/go/callgraph/cha"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+type (
+	// funcNode is a function or method declared in the project, identified by
+	// <import path>.<name> or <import path>.<receiver>.<name>.
+	funcNode struct {
+		Key     string
+		File    string // absolute file name
+		Start   int    // first line of the declaration
+		End     int    // last line of the declaration
+		Callees map[string]bool
+	}
+
+	// callGraph is the class hierarchy analysis (CHA) call graph of the SSA form of the project. Interface method calls
+	// are resolved to the methods of all types implementing the interface. Function literals belong to the declaring
+	// function, and references to functions are treated like calls, as they are usually callbacks. Calls through
+	// functions outside of the project (e.g., sort.Sort calling Less) are not followed.
+	callGraph struct {
+		Funcs map[string]*funcNode
+		Files map[string][]*funcNode // absolute file name -> declared functions
+	}
+)
+
+// buildCallGraph loads all packages including tests of the given modules and builds the call graph.
+func buildCallGraph(projPath string, modules []goModule) (*callGraph, error) {
+	graph := &callGraph{
+		Funcs: make(map[string]*funcNode),
+		Files: make(map[string][]*funcNode),
+	}
+
+	for _, module := range modules {
+		cfg := &packages.Config{
+			Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo |
+				packages.NeedTypesSizes | packages.NeedImports | packages.NeedDeps,
+			Dir:   filepath.Join(projPath, module.Dir),
+			Tests: true,
+		}
+		pkgs, err := packages.Load(cfg, "./...")
+		if err != nil {
+			return nil, errors.Wrapf(err, "loading packages of module %s", module.Path)
+		}
+
+		project := make(map[string]bool) // import paths of the packages of the module, without generated test mains
+		for _, pkg := range pkgs {
+			for _, pkgErr := range pkg.Errors {
+				log.Warnf("Error loading package %s: %v", pkg.ID, pkgErr)
+			}
+			if !strings.HasSuffix(pkg.PkgPath, ".test") {
+				project[pkg.PkgPath] = true
+			}
+		}
+
+		prog, _ := ssautil.Packages(pkgs, ssa.InstantiateGenerics)
+		prog.Build()
+		functions := ssautil.AllFunctions(prog)
+
+		// declarations first, test variants of a package declare the same functions again
+		for fn := range functions {
+			decl, ok := fn.Syntax().(*ast.FuncDecl)
+			if !ok || fn.Synthetic != "" || fn.Pkg == nil || !project[fn.Pkg.Pkg.Path()] {
+				continue
+			}
+			obj, ok := fn.Object().(*types.Func)
+			if !ok || graph.Funcs[funcKey(obj)] != nil {
+				continue
+			}
+			node := &funcNode{
+				Key:     funcKey(obj),
+				File:    prog.Fset.Position(decl.Pos()).Filename,
+				Start:   prog.Fset.Position(decl.Pos()).Line,
+				End:     prog.Fset.Position(decl.End()).Line,
+				Callees: make(map[string]bool),
+			}
+			graph.Funcs[node.Key] = node
+			graph.Files[node.File] = append(graph.Files[node.File], node)
+		}
+
+		for fn, cgNode := range cha.CallGraph(prog).Nodes {
+			caller := graph.Funcs[declaredFuncKey(fn)]
+			if caller == nil {
+				continue
+			}
+			for _, edge := range cgNode.Out {
+				graph.addEdge(caller, declaredFuncKey(edge.Callee.Func))
+			}
+			for _, block := range fn.Blocks {
+				for _, instr := range block.Instrs {
+					for _, operand := range instr.Operands(nil) {
+						if referenced, ok := (*operand).(*ssa.Function); ok {
+							graph.addEdge(caller, declaredFuncKey(referenced))
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return graph, nil
+}
+
+// funcKey identifies a declared function, methods are keyed by their receiver type name.
+func funcKey(obj *types.Func) string {
+	if obj.Pkg() == nil {
+		return obj.Name()
+	}
+	recv := obj.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return obj.Pkg().Path() + "." + obj.Name()
+	}
+	t := recv.Type()
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	if named, ok := t.(*types.Named); ok {
+		return obj.Pkg().Path() + "." + named.Obj().Name() + "." + obj.Name()
+	}
+	return obj.Pkg().Path() + ".?." + obj.Name()
+}
+
+// declaredFuncKey returns the key of the declaration an SSA function belongs to. Function literals belong to the
+// enclosing declaration, instantiations to the generic function and wrappers to the wrapped method.
+func declaredFuncKey(fn *ssa.Function) string {
+	if fn == nil {
+		return "" // root of the call graph
+	}
+	for fn.Parent() != nil {
+		fn = fn.Parent()
+	}
+	if origin := fn.Origin(); origin != nil {
+		fn = origin
+	}
+	obj, ok := fn.Object().(*types.Func)
+	if !ok {
+		return ""
+	}
+	return funcKey(obj.Origin())
+}
+
+// addEdge adds a call edge, if the callee is a function of the project.
+func (graph *callGraph) addEdge(caller *funcNode, callee string) {
+	if _, ok := graph.Funcs[callee]; ok && callee != caller.Key {
+		caller.Callees[callee] = true
+	}
+}
+
+// reach searches the graph from the given function for changed functions. It returns the path
+// to the first changed function found, or the number of reachable functions if none is changed.
+func (graph *callGraph) reach(from string, changed map[string]bool) ([]string, int) {
+	parent := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		curr := queue[0]
+		queue = queue[1:]
+
+		if changed[curr] {
+			path := []string{}
+			for k := curr; k != ""; k = parent[k] {
+				path = append([]string{k}, path...)
+			}
+			return path, len(parent)
+		}
+
+		node := graph.Funcs[curr]
+		if node == nil {
+			continue
+		}
+		callees := make([]string, 0, len(node.Callees))
+		for callee := range node.Callees {
+			callees = append(callees, callee)
+		}
+		sort.Strings(callees) // deterministic paths in the report
+		for _, callee := range callees {
+			if _, visited := parent[callee]; !visited {
+				parent[callee] = curr
+				queue = append(queue, callee)
+			}
+		}
+	}
+	return nil, len(parent)
+}
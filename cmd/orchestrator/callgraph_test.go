@@ -0,0 +1,43 @@
+package main
+
+import (
+	"cloud-benchmark-tool/common"
+	"path/filepath"
+	"testing"
+)
+
+// TestCallGraphSameNamedMethods checks that a call on a concrete type only reaches the method of that type,
+// while an interface call reaches the methods of all implementations.
+func TestCallGraphSameNamedMethods(t *testing.T) {
+	projPath, err := filepath.Abs("testdata/callgraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := buildCallGraph(projPath, []goModule{{Dir: "./", Path: "example.com/callgraph"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	circle := graph.Funcs["example.com/callgraph.Circle.Area"]
+	if circle == nil || circle.File != filepath.Join(projPath, "shapes.go") || circle.Start != 10 || circle.End != 10 {
+		t.Fatalf("Circle.Area = %+v, want declaration in line 10 of shapes.go", circle)
+	}
+
+	changed := map[string]bool{"example.com/callgraph.Circle.Area": true}
+	tests := []struct {
+		bench    string
+		selected bool
+		path     string
+	}{
+		{"BenchmarkSquareArea", false, ""},
+		{"BenchmarkTotalArea/mixed", true, "reaches changed example.com/callgraph.Circle.Area via example.com/callgraph.BenchmarkTotalArea" +
+			" -> example.com/callgraph.TotalArea -> example.com/callgraph.Circle.Area"},
+	}
+	for _, test := range tests {
+		bench := &common.Benchmark{Name: test.bench, Package: "./", ModulePath: "example.com/callgraph"}
+		result := graph.selectBenchmark(bench, common.ParseBenchmarkName(test.bench, 1).Function, changed)
+		if result.Selected != test.selected || test.selected && result.Reason != test.path {
+			t.Errorf("%s: selected %t (%s), want %t", test.bench, result.Selected, result.Reason, test.selected)
+		}
+	}
+}
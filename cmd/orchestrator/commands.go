@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// subcommands of the orchestrator, running an experiment is the default without a subcommand
+var subcommands = map[string]func(args []string){
+	"migrate":  migrateCommand,
+	"export":   exportCommand,
+	"import":   importCommand,
+	"db":       dbCommand,
+	"serve":    serveCommand,
+	"optimize": optimizeCommand,
+}
+
+// runSubcommand runs the subcommand named by the first argument, and reports whether there was one.
+func runSubcommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	command, ok := subcommands[args[0]]
+	if !ok {
+		return false
+	}
+	command(args[1:])
+	return true
+}
+
+// dbFlags registers the flags selecting the database on the flag set of a subcommand.
+func dbFlags(fs *flag.FlagSet) *DbConfig {
+	var dbConfig DbConfig
+	fs.StringVar(&(dbConfig.Type), "db-type", DB_SQLITE, "Database backend, sqlite or postgres.")
+	fs.StringVar(&(dbConfig.Uri), "db", "database.db", "Path to the sqlite3 database file, or the connection string of the postgres database.")
+	return &dbConfig
+}
+
+// migrateCommand applies pending schema migrations, or prints the applied ones with -status.
+func migrateCommand(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dbConfig := dbFlags(fs)
+	target := fs.Int("to", 0, "Schema version to migrate to, default is the latest version. Migrations cannot be reverted.")
+	status := fs.Bool("status", false, "Only print the applied migrations.")
+	fs.Parse(args)
+
+	openDB(dbConfig)
+	defer CloseDB()
+
+	if !*status {
+		if err := migrateDB(*target); err != nil {
+			fatalf("%v", err)
+		}
+	}
+
+	if err := ensureSchemaVersionTable(); err != nil {
+		fatalf("%v", err)
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	for _, m := range applied {
+		fmt.Printf("%4d  %s  %s\n", m.Version, m.AppliedAt, m.Description)
+	}
+	current, _ := currentSchemaVersion()
+	fmt.Printf("schema version %d, latest %d\n", current, latestSchemaVersion())
+}
+
+// openDB connects to the database of a subcommand without migrating it, and assigns the global variable db.
+func openDB(dbConfig *DbConfig) {
+	backend, err := newDbBackend(dbConfig.Type)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	conn, err := backend.Open(dbConfig.Uri)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	db = &database{DB: conn, backend: backend}
+}
+
+// requireLatestSchema stops subcommands which only read, if the database has to be migrated first.
+func requireLatestSchema() {
+	current, err := currentSchemaVersion()
+	if err != nil {
+		fatalf("%v, run migrate first", err)
+	}
+	if current != latestSchemaVersion() {
+		fatalf("database schema version %d does not match version %d of this orchestrator, run migrate first", current, latestSchemaVersion())
+	}
+}
+
+// fatalf prints the error of a subcommand and exits, subcommands report on the terminal instead of the log file.
+// The database is closed first, deferred calls do not run and SQLite would leave its WAL files behind.
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	if db != nil {
+		db.Close()
+	}
+	os.Exit(1)
+}
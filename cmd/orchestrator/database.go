@@ -3,16 +3,10 @@ package main
 import (
 	"cloud-benchmark-tool/common"
 	"database/sql"
-	"os"
-	"os/exec"
-	"regexp"
 	"strings"
-	"sync"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
-	benchparser "golang.org/x/tools/benchmark/parse"
-	_ "modernc.org/sqlite"
 )
 
 type (
@@ -20,360 +14,279 @@ type (
 		Type string
 		Uri  string
 	}
+)
 
-	queueElem struct {
-		benchmark *common.Benchmark
-		bedSetup  int
-		itSetup   int
-		srSetup   int
-		irSetup   int
-		irPos     int
-	}
+const (
+	insertMeasurementSQL = `INSERT INTO measurement(n, ns_per_op, bed_setup, it_setup, sr_setup, ir_setup, bed_pos, it_pos, sr_pos, ir_pos, b_name, tag, count_idx, cpu_set, runner_cpu_set, gomaxprocs, nice,
+		cpu_user_pct, cpu_system_pct, cpu_iowait_pct, cpu_steal_pct, ctx_switches, load_avg1, mem_available_kb, mem_pressure_avg10, profiled, e_id, bench_id, subpackage, p_name, h_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	insertProfileSQL = `INSERT INTO profile(b_name, subpackage, tag, kind, bed_pos, it_pos, sr_pos, ir_pos, bucket, object_key, e_id, bench_id, p_name) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 )
 
-var db *sql.DB
-var msrmntQueue chan queueElem
-var queueMu sync.Mutex
+var db *database
 
 // ConnectToDB creates a database connection.
 // dbConfig contains information on the type of database and location
 // cleanDb instructs the dropping of all relevant tables
-func ConnectToDB(dbConfig DbConfig, cleanDb bool) { // TODO finish
-	connectToSqlite()
-	initializeDB(cleanDb)
-}
-
-// TODO: Finish (does not clean up or handle existing DB)
-// TODO: error handling
-func connectToSqlite() {
-	if _, err := os.Stat("sqlite-database.db"); errors.Is(err, os.ErrNotExist) {
-		log.Debug("Creating sqlite-database.db")
-		file, err := os.Create("sqlite-database.db") // Create SQLite file
-		if err != nil {
-			log.Fatal(err.Error())
-		}
-		file.Close()
-		log.Debug("sqlite-database.db created")
+func ConnectToDB(dbConfig DbConfig, cleanDb bool) {
+	backend, err := newDbBackend(dbConfig.Type)
+	if err != nil {
+		log.Fatal(err.Error())
 	}
+	conn, err := backend.Open(dbConfig.Uri)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	db = &database{DB: conn, backend: backend} // save in global variable
+	log.Debugf("Connected to %s database", dbConfig.Type)
 
-	log.Debug("Connecting to sqlite-database.db")
-	sqliteDatabase, _ := sql.Open("sqlite", "./sqlite-database.db") // Open the created SQLite File
-	db = sqliteDatabase                                             // save in global variable
-	log.Debug("Finished connecting to sqlite-database.db")
+	initializeDB(cleanDb)
 }
 
 func CloseDB() {
 	db.Close()
 }
 
-// CollectBenchmarks runs all benchmarks of the given project, and gathers their names
-func CollectBenchmarks(projName string, projPath string, basePackage string, tags []string, benchRegex string) (*[]common.Benchmark, error) {
-
-	// register project in DB
-	insertProject(projName, basePackage)
-
-	// checkout tag
-	gitCheckout := exec.Command("git", "checkout", tags[0])
-	gitCheckout.Dir = projPath
-	gitCheckout_err := gitCheckout.Start()
-
-	if gitCheckout_err != nil {
-		return nil, errors.Wrapf(gitCheckout_err, "%#v", gitCheckout.Args)
+// initializeDB brings the schema to the latest version by applying the pending migrations.
+// If cleanDb is true, all tables are dropped first.
+func initializeDB(cleanDb bool) {
+	// --- clean DB ---
+	if cleanDb {
+		dropSchema()
 	}
 
-	// This works for topl level benchmarks but not for subbenchmarks
-	// cmd := exec.Command("go", "test", "./...", "-list", "^Benchmark.*", "-run", "^$", "-cpu", "1")
-
-	cmd := exec.Command("go", "test", "-timeout", "0", "-benchtime", "1ns", "-bench", benchRegex, "./...", "-run", "^$", "-cpu", "1")
-	cmd.Dir = projPath
-
-	out, err := cmd.CombinedOutput()
+	err := migrateDB(0)
 	if err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			log.Debugf("Exit Status: %d", exiterr.ExitCode())
-		} else {
-			return nil, errors.Wrapf(err, "%#v: output: %s", cmd.Args, out)
-		}
+		log.Fatal(err.Error())
 	}
+}
 
-	// allocate list for benchmarks
-	benchmarks := make([]common.Benchmark, 0, 10)
-
-	// split output into lines
-	lines := strings.Split(string(out), "\n")
-
-	// default package
-	pkg := "./"
-
-	// Regex for extracting benchmark configuration
-	// regex_config, _ := regexp.Compile(`/?-?\d{1-2}((-\d{1,2}){1,4})?$`)
-	regex_bench, _ := regexp.Compile(`^Benchmark`)
-
-	// parse output from go test
-	for i := 0; i < len(lines); i++ {
-		isBench := regex_bench.FindStringIndex(lines[i]) != nil
-
-		// isBench, err := regexp.MatchString("^Benchmark", lines[i])
-		// if err != nil {
-		// 	return nil, errors.Wrapf(err, "%#v: output: %s", cmd.Args, out)
-		// }
-
-		if isBench {
-			b, err := benchparser.ParseLine(lines[i])
-			if err != nil {
-				return nil, errors.Wrapf(err, "%#v: output: %s", cmd.Args, out)
-			}
-
-			// go test appends -#cpu to every name, and the parser does not remove this suffix
-			// since go test does not consider the suffix part of the name, it has to be removed
-			//configuration := regex_config.FindString(b.Name)
-			//nameTrimmed := strings.TrimSuffix(b.Name, configuration) // remove suffix
-			//configuration = strings.TrimPrefix(configuration, "/")   // remove leading /
-
-			nameTrimmed := b.Name
-			configuration := ""
-
-			err = insertBenchmark(nameTrimmed, pkg, projName, configuration)
-			if err != nil {
-				// Skip benchmark if it already exists
-				if !strings.Contains(err.Error(), "UNIQUE constraint failed") {
-					return nil, errors.Wrapf(err, "%#v: output: %s", cmd.Args, out)
-				}
-				continue // go to next iteration
-			}
-
-			benchmarks = append(benchmarks, common.Benchmark{
-				Name:        nameTrimmed,
-				NameRegexp:  common.MaskNameRegexp(nameTrimmed), // Name needs special format for execution
-				Package:     pkg,
-				ProjectPath: projPath,
-				Measurement: []common.Measurement{},
-			})
-
-			continue // go to next iteration
-		}
-
-		isPkg, err := regexp.MatchString("^pkg:", lines[i])
-		if err != nil {
-			return nil, errors.Wrapf(err, "%#v: output: %s", cmd.Args, out)
-		}
-
-		if isPkg {
-			_, after, found := strings.Cut(strings.Fields(lines[i])[1], basePackage)
-			if !found {
-				return nil, errors.New("Base package not found in subpackage string. Maybe misconfigured?")
-			}
-			if strings.HasPrefix(after, "/") {
-				after = "." + after
-			} else {
-				after = "./" + after
-			}
-			pkg = after
-		} // discard no match
+func insertProject(pName string, basePackage string) {
+	log.Debug("Inserting project record ...")
+	// registering a project again only updates its base package
+	insertProjectSQL := `INSERT INTO project(p_name, base_package) VALUES (?, ?)
+		ON CONFLICT(p_name) DO UPDATE SET base_package = excluded.base_package`
+	statement, err := db.Prepare(insertProjectSQL) // Prepare statement
+	// This is good to avoid SQL injections
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	_, err = statement.Exec(pName, basePackage)
+	if err != nil {
+		log.Fatalln(err.Error())
 	}
-
-	return &benchmarks, nil
 }
 
-// initializeDB ensures that the necessary tables are created. If cleanDb is true, the tables are emptied
-// by running drop statements as well.
-func initializeDB(cleanDb bool) {
-	// --- clean DB ---
-	if cleanDb {
-		// --- drop project table ---
-		dropProjectTableSQL := `DROP TABLE IF EXISTS project;`
-
-		log.Debug("Drop project table")
-		dropProjectStatement, err := db.Prepare(dropProjectTableSQL) // Prepare SQL Statement
-		if err != nil {
-			log.Fatal(err.Error())
-		}
-		dropProjectStatement.Exec() // Execute SQL Statements
-		log.Debug("project table dropped")
-
-		// --- drop benchmark table ---
-		dropBenchmarkTableSQL := `DROP TABLE IF EXISTS benchmark;`
+// insertBenchmark registers a benchmark and returns its ID, the sub-benchmark path is stored as config,
+// its parameters as JSON object and the GOMAXPROCS suffix as procs. Registering a benchmark again updates it and keeps its ID.
+func insertBenchmark(bName string, subPackage string, module string, pName string, name common.BenchmarkName, ann common.Annotations) (int64, error) {
+	insertBenchmarkSQL := `INSERT INTO benchmark(b_name, subpackage, module, p_name, config, function, params, procs, skip, timeout, bed, labels) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(b_name, subpackage, p_name) DO UPDATE SET module = excluded.module, config = excluded.config,
+		function = excluded.function, params = excluded.params, procs = excluded.procs,
+		skip = excluded.skip, timeout = excluded.timeout, bed = excluded.bed, labels = excluded.labels
+		RETURNING bench_id`
+	statement, err := db.Prepare(insertBenchmarkSQL) // Prepare statement
+	// This is good to avoid SQL injections
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
 
-		log.Debug("Drop benchmark table")
-		dropBenchmarkStatement, err := db.Prepare(dropBenchmarkTableSQL) // Prepare SQL Statement
-		if err != nil {
-			log.Fatal(err.Error())
-		}
-		dropBenchmarkStatement.Exec() // Execute SQL Statements
-		log.Debug("benchmark table dropped")
+	// Insert benchmark into DB
+	var benchId int64
+	err = statement.QueryRow(bName, subPackage, module, pName, name.Sub, name.Function, name.ParamsJSON(), name.Procs,
+		ann.Skip, ann.Timeout, ann.Bed, strings.Join(ann.Labels, ",")).Scan(&benchId)
+	if err != nil {
+		return 0, errors.Wrapf(err, "registering benchmark %s in %s", bName, subPackage)
+	}
 
-		// --- drop measurement table ---
-		dropMeasurementTableSQL := `DROP TABLE IF EXISTS measurement;`
+	return benchId, nil
+}
 
-		log.Debug("Drop measurement table")
-		dropMeasurementStatement, err := db.Prepare(dropMeasurementTableSQL) // Prepare SQL Statement
-		if err != nil {
-			log.Fatal(err.Error())
-		}
-		dropMeasurementStatement.Exec() // Execute SQL Statements
-		log.Debug("measurement table dropped")
+// selectBenchmarkId returns the ID of a registered benchmark, 0 if it is unknown.
+func selectBenchmarkId(bName string, subPackage string, pName string) int64 {
+	var benchId int64
+	err := db.QueryRow(`SELECT bench_id FROM benchmark WHERE b_name = ? AND subpackage = ? AND p_name = ?`,
+		bName, subPackage, pName).Scan(&benchId)
+	if err == sql.ErrNoRows {
+		return 0
+	} else if err != nil {
+		log.Fatalln(err.Error())
 	}
+	return benchId
+}
 
-	// --- create project table ---
-	createProjectTableSQL := `CREATE TABLE IF NOT EXISTS project (
-		"p_name" TEXT NOT NULL PRIMARY KEY,
-		"base_package" TEXT NOT NULL
-	  );`
-
-	log.Debug("Create project table")
-	createProjectStatement, err := db.Prepare(createProjectTableSQL) // Prepare SQL Statement
+func insertBenchmarkTag(benchId int64, tag string) {
+	insertBenchmarkTagSQL := `INSERT INTO benchmark_tag(bench_id, tag) VALUES (?, ?) ON CONFLICT DO NOTHING`
+	statement, err := db.Prepare(insertBenchmarkTagSQL) // Prepare statement
 	if err != nil {
-		log.Fatal(err.Error())
+		log.Fatalln(err.Error())
+	}
+	_, err = statement.Exec(benchId, tag)
+	if err != nil {
+		log.Fatalln(err.Error())
 	}
-	createProjectStatement.Exec() // Execute SQL Statements
-	log.Debug("project table created")
+}
 
-	// --- create benchmark table ---
-	createBenchmarkTableSQL := `CREATE TABLE IF NOT EXISTS benchmark (
-		"b_name" TEXT NOT NULL,
-		"subpackage" TEXT NOT NULL,
-		"p_name" TEXT NOT NULL,
-		"config" TEXT,
-		FOREIGN KEY(p_name) REFERENCES project(p_name),
-		CONSTRAINT PK_Bench PRIMARY KEY (b_name, subpackage, p_name)
-	  );`
+// selectDiscoveryCache returns the cached benchmarks (JSON) of a commit, if any.
+func selectDiscoveryCache(pName string, commitSha string, key string) (string, bool) {
+	var benchmarks string
+	err := db.QueryRow(`SELECT benchmarks FROM discovery_cache WHERE p_name = ? AND commit_sha = ? AND discovery_key = ?`,
+		pName, commitSha, key).Scan(&benchmarks)
+	if err == sql.ErrNoRows {
+		return "", false
+	} else if err != nil {
+		log.Fatalln(err.Error())
+	}
+	return benchmarks, true
+}
 
-	log.Debug("Create benchmark table")
-	createBenchmarkStatement, err := db.Prepare(createBenchmarkTableSQL) // Prepare SQL Statement
+func insertDiscoveryCache(pName string, tag string, commitSha string, key string, benchmarks string) {
+	insertDiscoveryCacheSQL := `INSERT INTO discovery_cache(p_name, commit_sha, discovery_key, tag, benchmarks) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(p_name, commit_sha, discovery_key) DO UPDATE SET tag = excluded.tag, benchmarks = excluded.benchmarks, discovered_at = CURRENT_TIMESTAMP`
+	statement, err := db.Prepare(insertDiscoveryCacheSQL) // Prepare statement
 	if err != nil {
-		log.Fatal(err.Error())
+		log.Fatalln(err.Error())
 	}
-	createBenchmarkStatement.Exec() // Execute SQL Statements
-	log.Debug("benchmark table created")
-
-	// --- create measurement table ---
-	createMeasurementTableSQL := `CREATE TABLE IF NOT EXISTS measurement (
-    	"m_id" INTEGER PRIMARY KEY AUTOINCREMENT,
-		"n" INT NOT NULL,
-		"ns_per_op" FLOAT NOT NULL,
-		"bed_setup" INT NOT NULL,
-		"it_setup" INT NOT NULL,
-		"sr_setup" INT NOT NULL,
-		"ir_setup" INT NOT NULL,
-		"bed_pos" INT NOT NULL,
-		"it_pos" INT NOT NULL,
-		"sr_pos" INT NOT NULL,
-		"ir_pos" INT NOT NULL,
-		"b_name" TEXT NOT NULL,
-		"tag" TEXT NOT NULL,
-		"count_idx" INT NOT NULL,
-		FOREIGN KEY(b_name) REFERENCES benchmark(b_name)
-	  );`
+	_, err = statement.Exec(pName, commitSha, key, tag, benchmarks)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+}
 
-	log.Debug("Create measurement table")
-	createMeasurementStatement, err := db.Prepare(createMeasurementTableSQL) // Prepare SQL Statement
+func insertExclusion(bName string, subPackage string, pName string, rule string) {
+	insertExclusionSQL := `INSERT INTO benchmark_exclusion(b_name, subpackage, p_name, rule, e_id) VALUES (?, ?, ?, ?, ?)`
+	statement, err := db.Prepare(insertExclusionSQL) // Prepare statement
 	if err != nil {
-		log.Fatal(err.Error())
+		log.Fatalln(err.Error())
 	}
-	res, err := createMeasurementStatement.Exec() // Execute SQL Statements
-	log.Debugln(res)
+	_, err = statement.Exec(bName, subPackage, pName, rule, experimentRef())
 	if err != nil {
-		log.Fatal(err.Error())
+		log.Fatalln(err.Error())
 	}
-	log.Debug("measurement table created")
 }
 
-func insertProject(pName string, basePackage string) {
-	log.Debug("Inserting project record ...")
-	insertProjectSQL := `INSERT INTO project(p_name, base_package) VALUES (?, ?)`
-	statement, err := db.Prepare(insertProjectSQL) // Prepare statement
-	// This is good to avoid SQL injections
+func insertSelection(bName string, subPackage string, pName string, baseTag string, headTag string, selected bool, reason string) {
+	insertSelectionSQL := `INSERT INTO benchmark_selection(b_name, subpackage, p_name, base_tag, head_tag, selected, reason, e_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	statement, err := db.Prepare(insertSelectionSQL) // Prepare statement
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
-	_, err = statement.Exec(pName, basePackage)
+	_, err = statement.Exec(bName, subPackage, pName, baseTag, headTag, selected, reason, experimentRef())
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
 }
 
-func insertBenchmark(bName string, subPackage string, pName string, config string) error {
-	insertBenchmarkSQL := `INSERT INTO benchmark(b_name, subpackage, p_name, config) VALUES (?, ?, ?, ?)`
-	statement, err := db.Prepare(insertBenchmarkSQL) // Prepare statement
-	// This is good to avoid SQL injections
+func insertRevision(pName string, position int, label string, commitSha string, selector string) {
+	insertRevisionSQL := `INSERT INTO revision(p_name, position, label, commit_sha, selector, e_id) VALUES (?, ?, ?, ?, ?, ?)`
+	statement, err := db.Prepare(insertRevisionSQL) // Prepare statement
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	_, err = statement.Exec(pName, position, label, commitSha, selector, experimentRef())
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
+}
 
-	// Insert benchmark into DB
-	_, err = statement.Exec(bName, subPackage, pName, config)
+func insertPilot(bName string, subPackage string, pName string, tag string, runs int, execTime float64, mean float64, cv float64, samples int, flagged bool, action string, reason string) {
+	insertPilotSQL := `INSERT INTO pilot(b_name, subpackage, p_name, tag, runs, exec_time_s, ns_per_op_mean, ns_per_op_cv, samples, flagged, action, reason, e_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	statement, err := db.Prepare(insertPilotSQL) // Prepare statement
 	if err != nil {
-		// log.Fatalln(err.Error())
-		// return erro could be that the benchmark already exists (different configurations)
-		return err
+		log.Fatalln(err.Error())
 	}
+	_, err = statement.Exec(bName, subPackage, pName, tag, runs, execTime, mean, cv, samples, flagged, action, reason, experimentRef())
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+}
 
-	return nil
+// insertMeasurement inserts a measurement with the prepared insertMeasurementSQL statement.
+func insertMeasurement(statement *sql.Stmt, benchId int64, bName string, subPackage string, pName string, n int, nsPerOp float64, bedSetup int, itSetup int, srSetup int, irSetup int, bedPos int, itPos int, srPos int, irPos int, hostId int64, tag string, countIndex int, isolation common.Isolation, noise common.SystemNoise, profiled bool) error {
+	args := []any{n, nsPerOp, bedSetup, itSetup, srSetup, irSetup, bedPos, itPos, srPos, irPos, bName, tag, countIndex, isolation.CpuSet, isolation.RunnerCpuSet, isolation.GoMaxProcs, isolation.Nice}
+	args = append(args, noise.Values()...)
+	args = append(args, profiled, experimentRef(), benchId, subPackage, pName, hostRef(hostId))
+	_, err := statement.Exec(args...)
+	return errors.Wrapf(err, "inserting measurement of %s in %s", bName, subPackage)
 }
 
-func insertMeasurement(bName string, n int, nsPerOp float64, bedSetup int, itSetup int, srSetup int, irSetup int, bedPos int, itPos int, srPos int, irPos int, tag string, countIndex int) {
-	insertMeasurementSQL := `INSERT INTO measurement(n, ns_per_op, bed_setup, it_setup, sr_setup, ir_setup, bed_pos, it_pos, sr_pos, ir_pos, b_name, tag, count_idx) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	statement, err := db.Prepare(insertMeasurementSQL) // Prepare statement
-	// This is good to avoid SQL injections
+// insertProfile inserts a profile with the prepared insertProfileSQL statement.
+func insertProfile(statement *sql.Stmt, benchId int64, bName string, subPackage string, pName string, irPos int, profile common.ProfileFile) error {
+	_, err := statement.Exec(bName, subPackage, profile.Tag, profile.Kind, profile.BedPos, profile.ItPos, profile.SrPos, irPos, profile.Bucket, profile.ObjectKey, experimentRef(), benchId, pName)
+	return errors.Wrapf(err, "inserting profile of %s in %s", bName, subPackage)
+}
+
+// insertHost stores the fingerprint of the host of a runner in the current experiment and returns its ID.
+func insertHost(irPos int, host common.HostInfo) int64 {
+	insertHostSQL := `INSERT INTO host(e_id, ir_pos, hostname, cpu_model, cpu_flags, microcode, cores, mem_total_kb, kernel, clocksource, go_version, go_env, machine_type, zone, instance_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING h_id`
+	var hId int64
+	err := db.QueryRow(insertHostSQL, experimentRef(), irPos, host.Hostname, host.CpuModel, host.CpuFlags, host.Microcode, host.Cores, int64(host.MemTotalKb),
+		host.Kernel, host.Clocksource, host.GoVersion, host.GoEnv, host.MachineType, host.Zone, host.InstanceId).Scan(&hId)
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
-	_, err = statement.Exec(n, nsPerOp, bedSetup, itSetup, srSetup, irSetup, bedPos, itPos, srPos, irPos, bName, tag, countIndex)
+	return hId
+}
+
+// hostRef returns the value of the h_id column of a measurement, NULL for runners which did not register a host.
+func hostRef(hostId int64) any {
+	if hostId == 0 {
+		return nil
+	}
+	return hostId
+}
+
+// insertExperiment registers a running experiment and returns its ID.
+func insertExperiment(pName string, config string, args string, orchestratorVersion string, runnerVersion string, bedSetup int, itSetup int, srSetup int, irSetup int) int64 {
+	insertExperimentSQL := `INSERT INTO experiment(p_name, status, config, args, orchestrator_version, runner_version, bed_setup, it_setup, sr_setup, ir_setup)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING e_id`
+	var eId int64
+	err := db.QueryRow(insertExperimentSQL, pName, EXPERIMENT_RUNNING, config, args, orchestratorVersion, runnerVersion, bedSetup, itSetup, srSetup, irSetup).Scan(&eId)
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
+	return eId
 }
 
-func RecordMeasurement(bench *common.Benchmark, bedSetup int, itSetup int, srSetup int, irSetup int, irPos int, wg *sync.WaitGroup) {
-	queueMu.Lock()
-	if msrmntQueue == nil {
-		msrmntQueue = make(chan queueElem, 500)
-		go dbQueueConsumer(wg)
+// insertExperimentBenchmark records that a benchmark is scheduled in the current experiment.
+func insertExperimentBenchmark(bName string, subPackage string, pName string) {
+	insertExperimentBenchmarkSQL := `INSERT INTO experiment_benchmark(e_id, b_name, subpackage, p_name) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`
+	statement, err := db.Prepare(insertExperimentBenchmarkSQL) // Prepare statement
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	_, err = statement.Exec(currExperiment.Id, bName, subPackage, pName)
+	if err != nil {
+		log.Fatalln(err.Error())
 	}
-	queueMu.Unlock()
+}
 
-	currMsrmnt := queueElem{
-		benchmark: bench,
-		bedSetup:  bedSetup,
-		itSetup:   itSetup,
-		srSetup:   srSetup,
-		irSetup:   irSetup,
-		irPos:     irPos,
+// updateExperimentSource records where the measurements of an experiment were imported from.
+func updateExperimentSource(eId int64, origin string, source string, checksum string) {
+	_, err := db.Exec(`UPDATE experiment SET origin = ?, source = ?, source_sha256 = ? WHERE e_id = ?`, origin, source, checksum, eId)
+	if err != nil {
+		log.Fatalln(err.Error())
 	}
-	msrmntQueue <- currMsrmnt
 }
 
-func CloseMeasurementQueue() {
-	if msrmntQueue != nil {
-		close(msrmntQueue)
+// selectImportedExperiment returns the finished experiment imported from a file with the checksum, if there is one.
+func selectImportedExperiment(checksum string) (int64, bool) {
+	var eId int64
+	err := db.QueryRow(`SELECT e_id FROM experiment WHERE source_sha256 = ? AND status = ? ORDER BY e_id LIMIT 1`, checksum, EXPERIMENT_FINISHED).Scan(&eId)
+	if err == sql.ErrNoRows {
+		return 0, false
+	} else if err != nil {
+		log.Fatalln(err.Error())
 	}
+	return eId, true
 }
 
-func dbQueueConsumer(wg *sync.WaitGroup) {
-	wg.Add(1)
-	defer wg.Done()
-	for {
-		elem, more := <-msrmntQueue
-		if !more {
-			return
-		}
-		for i := 0; i < len(elem.benchmark.Measurement); i++ {
-			currMsrmnt := elem.benchmark.Measurement[i]
-			insertMeasurement(
-				elem.benchmark.Name,
-				currMsrmnt.N,
-				currMsrmnt.NsPerOp,
-				elem.bedSetup,
-				elem.itSetup,
-				elem.srSetup,
-				elem.irSetup,
-				currMsrmnt.BedPos,
-				currMsrmnt.ItPos,
-				currMsrmnt.SrPos,
-				elem.irPos,
-				currMsrmnt.Tag,
-				currMsrmnt.CountIndex,
-			)
-		}
+// selectBasePackage returns the base package of a registered project, empty if the project is unknown.
+func selectBasePackage(pName string) string {
+	var basePackage string
+	err := db.QueryRow(`SELECT base_package FROM project WHERE p_name = ?`, pName).Scan(&basePackage)
+	if err != nil && err != sql.ErrNoRows {
+		log.Fatalln(err.Error())
 	}
+	return basePackage
 }
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestPostgresTranslate(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{`CREATE TABLE t ("id" INTEGER PRIMARY KEY AUTOINCREMENT, "n" INT NOT NULL, "at" DATETIME, "pos" INTEGER)`,
+			`CREATE TABLE t ("id" BIGSERIAL PRIMARY KEY, "n" BIGINT NOT NULL, "at" TIMESTAMP, "pos" INTEGER)`},
+		{`SELECT * FROM t WHERE a = ? AND b = '?' AND c IN (?, ?)`, `SELECT * FROM t WHERE a = $1 AND b = '?' AND c IN ($2, $3)`},
+		// tables rebuilt by migrations are referenced by foreign keys
+		{`DROP TABLE IF EXISTS benchmark;`, `DROP TABLE IF EXISTS benchmark CASCADE`},
+		{`DROP TABLE benchmark;`, `DROP TABLE benchmark CASCADE`},
+		{`ALTER TABLE benchmark_new RENAME TO benchmark;`, `ALTER TABLE benchmark_new RENAME TO benchmark;`},
+	}
+	for _, test := range tests {
+		if got := (postgresBackend{}).Translate(test.query); got != test.want {
+			t.Errorf("Translate(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"cloud-benchmark-tool/common"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	benchparser "golang.org/x/tools/benchmark/parse"
+)
+
+// Discovery modes, dynamic runs every benchmark once, static parses the test files
+const (
+	DISCOVERY_DYNAMIC = "dynamic"
+	DISCOVERY_STATIC  = "static"
+)
+
+// CollectBenchmarks runs all benchmarks of the given project on every revision, and gathers their names. Revisions are
+// checked out by the commit they resolved to at plan time. Each returned benchmark lists the labels of the revisions
+// it exists on, the availability is stored in the DB as well.
+// Benchmarks excluded by the filter are not returned, but recorded together with the rule excluding them.
+// Discovery results are cached per commit, unless rediscover is set the cached results are reused.
+// Source annotations are taken from the first tag a benchmark exists on.
+func CollectBenchmarks(projName string, projPath string, basePackage string, revisions []revision, benchRegex string, discoveryMode string, filter *benchmarkFilter, rediscover bool) (*[]common.Benchmark, error) {
+
+	// register project in DB
+	insertProject(projName, basePackage)
+
+	// allocate list for benchmarks, benchmarks are identified by package and name across tags
+	benchmarks := make([]common.Benchmark, 0, 10)
+	index := make(map[string]int)
+	cacheKey := discoveryKey(benchRegex, discoveryMode, filter)
+	checkedOut := ""
+
+	for _, r := range revisions {
+		tag, commitSha := r.Label, r.Commit
+		found, cached := loadCachedDiscovery(projName, commitSha, cacheKey)
+		if cached && !rediscover {
+			log.Debugf("Using cached discovery of tag %s (%s)", tag, commitSha)
+		} else {
+			err := checkoutTag(projPath, commitSha)
+			if err != nil {
+				return nil, err
+			}
+			checkedOut = commitSha
+
+			found, err = discoverModules(projPath, benchRegex, discoveryMode)
+			if err != nil {
+				return nil, errors.Wrapf(err, "discovering benchmarks on tag %s", tag)
+			}
+			storeCachedDiscovery(projName, tag, commitSha, cacheKey, found)
+		}
+		log.Debugf("Found %d benchmarks on tag %s", len(found), tag)
+
+		for _, b := range found {
+			key := b.ProjectPackage() + " " + b.Name
+			i, known := index[key]
+			if !known {
+				i = len(benchmarks)
+				index[key] = i
+				benchmarks = append(benchmarks, b)
+			}
+			benchmarks[i].Tags = append(benchmarks[i].Tags, tag)
+		}
+	}
+
+	// leave the project checked out on the first tag
+	if checkedOut != "" && checkedOut != revisions[0].Commit {
+		err := checkoutTag(projPath, revisions[0].Commit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	benchmarks, excluded := filter.apply(benchmarks)
+	benchmarks, skipped := applySkipAnnotations(benchmarks)
+	excluded = append(excluded, skipped...)
+	for _, e := range excluded {
+		insertExclusion(e.Benchmark.Name, e.Benchmark.ProjectPackage(), projName, e.Rule)
+	}
+
+	registered := make([]common.Benchmark, 0, len(benchmarks))
+	for _, b := range benchmarks {
+		// discovery runs with -cpu 1, so names never carry a GOMAXPROCS suffix
+		benchId, err := insertBenchmark(b.Name, b.ProjectPackage(), b.Module, projName, common.ParseBenchmarkName(b.Name, 1), b.Annotations)
+		if err != nil {
+			return nil, err
+		}
+		b.Id = benchId
+
+		for _, tag := range b.Tags {
+			insertBenchmarkTag(benchId, tag)
+		}
+
+		b.ProjectPath = projPath
+		registered = append(registered, b)
+	}
+
+	return &registered, nil
+}
+
+// discoverModules discovers the benchmarks of every module of the checked out revision. go test is run
+// from the respective module root, so that nested modules and go workspaces are supported.
+func discoverModules(projPath string, benchRegex string, discoveryMode string) ([]common.Benchmark, error) {
+	modules, err := findModules(projPath)
+	if err != nil {
+		return nil, err
+	}
+
+	benchmarks := make([]common.Benchmark, 0, 10)
+	for _, module := range modules {
+		log.Debugf("Discovering benchmarks of module %s in %s", module.Path, module.Dir)
+		moduleDir := filepath.Join(projPath, module.Dir)
+
+		var found []common.Benchmark
+		switch discoveryMode {
+		case DISCOVERY_STATIC:
+			found, err = discoverBenchmarksStatic(projPath, module, modules, benchRegex)
+		case DISCOVERY_DYNAMIC, "":
+			found, err = discoverBenchmarks(moduleDir, module.Path, benchRegex, "./...")
+		default:
+			return nil, errors.Errorf("unknown discovery mode %q", discoveryMode)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "module %s", module.Path)
+		}
+
+		for i := range found {
+			found[i].Module = module.Dir
+			found[i].ModulePath = module.Path
+		}
+		err = readAnnotations(projPath, found)
+		if err != nil {
+			return nil, errors.Wrapf(err, "module %s", module.Path)
+		}
+		benchmarks = append(benchmarks, found...)
+	}
+	return benchmarks, nil
+}
+
+// checkoutTag checks out the given tag and waits for git to finish.
+func checkoutTag(projPath string, tag string) error {
+	log.Debug("Checking out tag: ", tag)
+	gitCheckout := exec.Command("git", "checkout", tag)
+	gitCheckout.Dir = projPath
+	out, err := gitCheckout.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "%#v: output: %s", gitCheckout.Args, out)
+	}
+	return nil
+}
+
+// currentCheckout returns the checked out branch, or the commit if the HEAD is detached.
+func currentCheckout(projPath string) (string, error) {
+	cmd := exec.Command("git", "symbolic-ref", "-q", "--short", "HEAD")
+	cmd.Dir = projPath
+	if out, err := cmd.Output(); err == nil {
+		return strings.TrimSpace(string(out)), nil
+	}
+	return resolveCommit(projPath, "HEAD")
+}
+
+// discoverBenchmarks runs all benchmarks of the packages matching pkgPattern in the module once, and parses their names.
+// Packages are returned relative to the module root, packages of other modules (in a workspace) are skipped.
+func discoverBenchmarks(moduleDir string, modulePath string, benchRegex string, pkgPattern string) ([]common.Benchmark, error) {
+	// This works for topl level benchmarks but not for subbenchmarks
+	// cmd := exec.Command("go", "test", "./...", "-list", "^Benchmark.*", "-run", "^$", "-cpu", "1")
+
+	cmd := exec.Command("go", "test", "-timeout", "0", "-benchtime", "1ns", "-bench", benchRegex, pkgPattern, "-run", "^$", "-cpu", "1")
+	cmd.Dir = moduleDir
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			log.Debugf("Exit Status: %d", exiterr.ExitCode())
+		} else {
+			return nil, errors.Wrapf(err, "%#v: output: %s", cmd.Args, out)
+		}
+	}
+
+	benchmarks := make([]common.Benchmark, 0, 10)
+
+	// split output into lines
+	lines := strings.Split(string(out), "\n")
+
+	// default package
+	pkg := "./"
+
+	regex_bench, _ := regexp.Compile(`^Benchmark`)
+
+	// parse output from go test
+	for i := 0; i < len(lines); i++ {
+		isBench := regex_bench.FindStringIndex(lines[i]) != nil
+
+		if isBench && pkg != "" {
+			b, err := benchparser.ParseLine(lines[i])
+			if err != nil {
+				return nil, errors.Wrapf(err, "%#v: output: %s", cmd.Args, out)
+			}
+
+			// go test only appends -#cpu to names if GOMAXPROCS is not 1, which -cpu 1 avoids
+			nameTrimmed := b.Name
+
+			benchmarks = append(benchmarks, common.Benchmark{
+				Name:        nameTrimmed,
+				NameRegexp:  common.MaskNameRegexp(nameTrimmed), // Name needs special format for execution
+				Package:     pkg,
+				Measurement: []common.Measurement{},
+			})
+
+			continue // go to next iteration
+		}
+
+		isPkg, err := regexp.MatchString("^pkg:", lines[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "%#v: output: %s", cmd.Args, out)
+		}
+
+		if isPkg {
+			importPath := strings.Fields(lines[i])[1]
+			if importPath == modulePath {
+				pkg = "./"
+			} else if strings.HasPrefix(importPath, modulePath+"/") {
+				pkg = "." + strings.TrimPrefix(importPath, modulePath)
+			} else {
+				log.Warnf("Skipping package %s, not part of module %s", importPath, modulePath)
+				pkg = ""
+			}
+		} // discard no match
+	}
+
+	return benchmarks, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"cloud-benchmark-tool/common"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// cachedBenchmark is the part of a discovered benchmark stored in the discovery cache.
+	cachedBenchmark struct {
+		Name        string
+		Package     string
+		Module      string
+		ModulePath  string
+		Annotations common.Annotations
+	}
+)
+
+// DISCOVERY_CACHE_VERSION is part of the discovery key, it invalidates entries stored in an older format.
+const DISCOVERY_CACHE_VERSION = "3"
+
+// discoveryKey identifies the settings influencing which benchmarks are discovered,
+// i.e., discovery mode, -bench regex and the filter rules.
+func discoveryKey(benchRegex string, discoveryMode string, filter *benchmarkFilter) string {
+	parts := []string{"version=" + DISCOVERY_CACHE_VERSION, "mode=" + discoveryMode, "bench=" + benchRegex}
+	for _, rule := range filter.Include {
+		parts = append(parts, "include="+rule.Rule)
+	}
+	for _, rule := range filter.Exclude {
+		parts = append(parts, "exclude="+rule.Rule)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// resolveCommit returns the SHA of the commit the tag points to.
+func resolveCommit(projPath string, tag string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--verify", tag+"^{commit}")
+	cmd.Dir = projPath
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.Wrapf(err, "%#v: output: %s", cmd.Args, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// loadCachedDiscovery returns the benchmarks discovered earlier for the commit and discovery key.
+func loadCachedDiscovery(pName string, commitSha string, key string) ([]common.Benchmark, bool) {
+	encoded, found := selectDiscoveryCache(pName, commitSha, key)
+	if !found {
+		return nil, false
+	}
+
+	var cached []cachedBenchmark
+	err := json.Unmarshal([]byte(encoded), &cached)
+	if err != nil {
+		log.Warnf("Ignoring invalid discovery cache entry for %s: %v", commitSha, err)
+		return nil, false
+	}
+
+	benchmarks := make([]common.Benchmark, 0, len(cached))
+	for _, c := range cached {
+		benchmarks = append(benchmarks, common.Benchmark{
+			Name:        c.Name,
+			NameRegexp:  common.MaskNameRegexp(c.Name), // Name needs special format for execution
+			Package:     c.Package,
+			Module:      c.Module,
+			ModulePath:  c.ModulePath,
+			Annotations: c.Annotations,
+			Measurement: []common.Measurement{},
+		})
+	}
+	return benchmarks, true
+}
+
+// storeCachedDiscovery saves the benchmarks discovered for the commit and discovery key.
+func storeCachedDiscovery(pName string, tag string, commitSha string, key string, benchmarks []common.Benchmark) {
+	cached := make([]cachedBenchmark, 0, len(benchmarks))
+	for _, b := range benchmarks {
+		cached = append(cached, cachedBenchmark{
+			Name:        b.Name,
+			Package:     b.Package,
+			Module:      b.Module,
+			ModulePath:  b.ModulePath,
+			Annotations: b.Annotations,
+		})
+	}
+
+	encoded, err := json.Marshal(cached)
+	if err != nil {
+		log.Warnf("Could not cache discovery of %s: %v", commitSha, err)
+		return
+	}
+	insertDiscoveryCache(pName, tag, commitSha, key, string(encoded))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"cloud-benchmark-tool/common"
+	"reflect"
+	"testing"
+)
+
+func TestDiscoveryKey(t *testing.T) {
+	filter := func(include []string, exclude []string) *benchmarkFilter {
+		f, err := newBenchmarkFilter(include, exclude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	base := discoveryKey(".", DISCOVERY_STATIC, filter([]string{"BenchmarkA*"}, []string{"pkg:./internal"}))
+	if again := discoveryKey(".", DISCOVERY_STATIC, filter([]string{"BenchmarkA*"}, []string{"pkg:./internal"})); again != base {
+		t.Errorf("discoveryKey is not deterministic: %s, %s", base, again)
+	}
+
+	// every setting influencing the discovered benchmarks changes the key
+	others := map[string]string{
+		"bench regex":         discoveryKey("Encode", DISCOVERY_STATIC, filter([]string{"BenchmarkA*"}, []string{"pkg:./internal"})),
+		"discovery mode":      discoveryKey(".", DISCOVERY_DYNAMIC, filter([]string{"BenchmarkA*"}, []string{"pkg:./internal"})),
+		"include rule":        discoveryKey(".", DISCOVERY_STATIC, filter([]string{"BenchmarkB*"}, []string{"pkg:./internal"})),
+		"no exclude rule":     discoveryKey(".", DISCOVERY_STATIC, filter([]string{"BenchmarkA*"}, nil)),
+		"include as exclude":  discoveryKey(".", DISCOVERY_STATIC, filter(nil, []string{"BenchmarkA*", "pkg:./internal"})),
+		"additional includes": discoveryKey(".", DISCOVERY_STATIC, filter([]string{"BenchmarkA*", "pkg:./internal"}, nil)),
+	}
+	for setting, key := range others {
+		if key == base {
+			t.Errorf("changing the %s keeps the discovery key", setting)
+		}
+	}
+}
+
+// TestDiscoveryCache checks hits and misses of stored discoveries, which are specific to project, commit and key.
+func TestDiscoveryCache(t *testing.T) {
+	openMigratedDB(t, "")
+
+	stored := []common.Benchmark{
+		{Name: "BenchmarkEncode/small", Package: "./codec", Module: "./api", ModulePath: "example.com/api",
+			Annotations: common.Annotations{Labels: []string{"slow"}, Bed: 3}, Failing: true},
+		{Name: "BenchmarkDecode", Package: "./", Module: "./", ModulePath: "example.com/root"},
+	}
+	storeCachedDiscovery("proj", "v1.0.0", "abc123", "key", stored)
+
+	found, hit := loadCachedDiscovery("proj", "abc123", "key")
+	if !hit || len(found) != len(stored) {
+		t.Fatalf("loadCachedDiscovery = %v, %t, want %d benchmarks", found, hit, len(stored))
+	}
+	for i, b := range found {
+		want := stored[i]
+		// only the discovery result is cached, not the run state
+		want.Failing = false
+		want.NameRegexp = common.MaskNameRegexp(want.Name)
+		want.Measurement = []common.Measurement{}
+		if !reflect.DeepEqual(b, want) {
+			t.Errorf("cached benchmark %+v, want %+v", b, want)
+		}
+	}
+
+	misses := []struct{ project, commit, key string }{
+		{"other", "abc123", "key"},
+		{"proj", "def456", "key"},
+		{"proj", "abc123", "other"},
+	}
+	for _, miss := range misses {
+		if found, hit := loadCachedDiscovery(miss.project, miss.commit, miss.key); hit {
+			t.Errorf("loadCachedDiscovery(%q, %q, %q) hit %v", miss.project, miss.commit, miss.key, found)
+		}
+	}
+
+	// storing again replaces the entry, e.g., after the tag moved to an already discovered commit
+	storeCachedDiscovery("proj", "v1.0.1", "abc123", "key", stored[1:])
+	if found, hit := loadCachedDiscovery("proj", "abc123", "key"); !hit || len(found) != 1 || found[0].Name != "BenchmarkDecode" {
+		t.Errorf("loadCachedDiscovery after replacing = %v, %t, want BenchmarkDecode", found, hit)
+	}
+
+	// entries which cannot be decoded are misses
+	insertDiscoveryCache("proj", "v2.0.0", "bad", "key", "{")
+	if found, hit := loadCachedDiscovery("proj", "bad", "key"); hit {
+		t.Errorf("invalid cache entry hit %v", found)
+	}
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"cloud-benchmark-tool/common"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Export formats
+const (
+	EXPORT_CSV     = "csv"
+	EXPORT_JSONL   = "jsonl"
+	EXPORT_PARQUET = "parquet"
+)
+
+// Kinds of exported columns, which determine how values are scanned and written.
+const (
+	COLUMN_INT    = "int"
+	COLUMN_FLOAT  = "float"
+	COLUMN_STRING = "string"
+	COLUMN_BOOL   = "bool"
+)
+
+type (
+	// exportColumn is a column available for export, Expr selects it from measurement m,
+	// its benchmark b and its host h.
+	exportColumn struct {
+		Name string
+		Expr string
+		Kind string
+	}
+
+	// exportFilter restricts the exported measurements, empty fields do not restrict.
+	exportFilter struct {
+		Experiments []int64
+		Project     string
+		Tags        []string
+		Benchmarks  *benchmarkFilter // include rules on name, params and pkg
+	}
+
+	// resultWriter writes exported rows in one of the export formats.
+	resultWriter interface {
+		WriteRow(values []any) error
+		Close() error
+	}
+
+	csvResultWriter struct {
+		w *csv.Writer
+	}
+
+	jsonlResultWriter struct {
+		w       io.Writer
+		columns []exportColumn
+	}
+
+	parquetResultWriter struct {
+		pw *writer.CSVWriter
+	}
+
+	// listFlag is a flag which can be given multiple times, values may also be comma separated.
+	listFlag []string
+)
+
+// exportColumns lists all exportable columns, OPTIMIZER_COLUMNS are the ones optimizer.py reads.
+var exportColumns = []exportColumn{
+	{"m_id", "m.m_id", COLUMN_INT},
+	{"n", "m.n", COLUMN_INT},
+	{"ns_per_op", "m.ns_per_op", COLUMN_FLOAT},
+	{"bed_setup", "m.bed_setup", COLUMN_INT},
+	{"it_setup", "m.it_setup", COLUMN_INT},
+	{"sr_setup", "m.sr_setup", COLUMN_INT},
+	{"ir_setup", "m.ir_setup", COLUMN_INT},
+	{"bed_pos", "m.bed_pos", COLUMN_INT},
+	{"it_pos", "m.it_pos", COLUMN_INT},
+	{"sr_pos", "m.sr_pos", COLUMN_INT},
+	{"ir_pos", "m.ir_pos", COLUMN_INT},
+	{"b_name", "m.b_name", COLUMN_STRING},
+	{"subpackage", "m.subpackage", COLUMN_STRING},
+	{"p_name", "m.p_name", COLUMN_STRING},
+	{"tag", "m.tag", COLUMN_STRING},
+	{"count_idx", "m.count_idx", COLUMN_INT},
+	{"e_id", "m.e_id", COLUMN_INT},
+	{"bench_id", "m.bench_id", COLUMN_INT},
+	{"h_id", "m.h_id", COLUMN_INT},
+	{"function", "b.function", COLUMN_STRING},
+	{"params", "b.params", COLUMN_STRING},
+	{"procs", "b.procs", COLUMN_INT},
+	{"cpu_set", "m.cpu_set", COLUMN_STRING},
+	{"runner_cpu_set", "m.runner_cpu_set", COLUMN_STRING},
+	{"gomaxprocs", "m.gomaxprocs", COLUMN_INT},
+	{"nice", "m.nice", COLUMN_INT},
+	{"cpu_user_pct", "m.cpu_user_pct", COLUMN_FLOAT},
+	{"cpu_system_pct", "m.cpu_system_pct", COLUMN_FLOAT},
+	{"cpu_iowait_pct", "m.cpu_iowait_pct", COLUMN_FLOAT},
+	{"cpu_steal_pct", "m.cpu_steal_pct", COLUMN_FLOAT},
+	{"ctx_switches", "m.ctx_switches", COLUMN_INT},
+	{"load_avg1", "m.load_avg1", COLUMN_FLOAT},
+	{"mem_available_kb", "m.mem_available_kb", COLUMN_INT},
+	{"mem_pressure_avg10", "m.mem_pressure_avg10", COLUMN_FLOAT},
+	{"profiled", "m.profiled", COLUMN_BOOL},
+	{"cpu_model", "h.cpu_model", COLUMN_STRING},
+	{"machine_type", "h.machine_type", COLUMN_STRING},
+	{"zone", "h.zone", COLUMN_STRING},
+}
+
+// OPTIMIZER_COLUMNS is the column layout of the CSVs in optimizer/, e.g., zap.csv.
+var OPTIMIZER_COLUMNS = []string{"m_id", "n", "ns_per_op", "bed_setup", "it_setup", "sr_setup", "ir_setup", "bed_pos", "it_pos", "sr_pos", "ir_pos", "b_name"}
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// exportCommand writes the measurements matching the filters as CSV, JSON Lines or Parquet.
+func exportCommand(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dbConfig := dbFlags(fs)
+	output := fs.String("o", "-", "Output file, - writes to stdout.")
+	format := fs.String("format", "", "Output format, csv, jsonl or parquet. Default is derived from the extension of -o, otherwise csv.")
+	columns := fs.String("columns", strings.Join(OPTIMIZER_COLUMNS, ","), "Comma separated columns to export, or all. Default is the layout optimizer.py reads.")
+	renumber := fs.Bool("renumber", false, "Number the exported measurements from 1 in m_id, optimizer.py reads the setup from m_id 1. Default is true for the optimizer layout.")
+	project := fs.String("project", "", "Only export measurements of this project.")
+	var experiments, tags, benchmarks listFlag
+	fs.Var(&experiments, "experiment", "Only export measurements of these experiment IDs (repeatable, comma separated).")
+	fs.Var(&tags, "tag", "Only export measurements of these tags (repeatable, comma separated).")
+	fs.Var(&benchmarks, "bench", "Only export benchmarks matching the filter rule, e.g., BenchmarkEncode* or pkg:./codec/* (repeatable).")
+	fs.Parse(args)
+
+	selected, err := selectExportColumns(*columns)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	filter, err := newExportFilter(experiments, *project, tags, benchmarks)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if *format == "" {
+		*format = exportFormatOf(*output)
+	}
+	renumberSet := false
+	fs.Visit(func(f *flag.Flag) { renumberSet = renumberSet || f.Name == "renumber" })
+	if !renumberSet {
+		*renumber = isOptimizerLayout(selected)
+	}
+
+	openDB(dbConfig)
+	defer CloseDB()
+	requireLatestSchema()
+
+	out := os.Stdout
+	if *output != "-" {
+		out, err = os.Create(*output)
+		if err != nil {
+			fatalf("%v", err)
+		}
+	}
+	rw, err := newResultWriter(*format, out, selected)
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	n, err := exportMeasurements(rw, selected, filter, *renumber)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if err := rw.Close(); err != nil {
+		fatalf("%v", err)
+	}
+	if out != os.Stdout {
+		if err := out.Close(); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "exported %d measurements\n", n)
+}
+
+// selectExportColumns resolves the comma separated column names.
+func selectExportColumns(names string) ([]exportColumn, error) {
+	if names == "all" {
+		return exportColumns, nil
+	}
+	selected := make([]exportColumn, 0)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, c := range exportColumns {
+			if c.Name == name {
+				selected = append(selected, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("unknown column %q", name)
+		}
+	}
+	return selected, nil
+}
+
+// isOptimizerLayout returns whether the columns are OPTIMIZER_COLUMNS in their order.
+func isOptimizerLayout(columns []exportColumn) bool {
+	if len(columns) != len(OPTIMIZER_COLUMNS) {
+		return false
+	}
+	for i, c := range columns {
+		if c.Name != OPTIMIZER_COLUMNS[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// newExportFilter parses the experiment IDs and benchmark rules.
+func newExportFilter(experiments []string, project string, tags []string, benchmarks []string) (*exportFilter, error) {
+	filter := exportFilter{Project: project, Tags: splitList(tags)}
+	for _, e := range splitList(experiments) {
+		id, err := strconv.ParseInt(e, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid experiment ID %q", e)
+		}
+		filter.Experiments = append(filter.Experiments, id)
+	}
+	var err error
+	filter.Benchmarks, err = newBenchmarkFilter(benchmarks, nil)
+	return &filter, err
+}
+
+// exportFormatOf derives the format from the extension of the output file.
+func exportFormatOf(output string) string {
+	switch strings.ToLower(filepath.Ext(output)) {
+	case ".jsonl", ".ndjson":
+		return EXPORT_JSONL
+	case ".parquet":
+		return EXPORT_PARQUET
+	default:
+		return EXPORT_CSV
+	}
+}
+
+// exportMeasurements queries the measurements matching the filter ordered by m_id, and writes the selected columns.
+// It returns the number of exported measurements.
+func exportMeasurements(rw resultWriter, columns []exportColumn, filter *exportFilter, renumber bool) (int, error) {
+	exprs := make([]string, 0, len(columns)+2)
+	for _, c := range columns {
+		exprs = append(exprs, c.Expr)
+	}
+	// name and package are always selected for the benchmark rules
+	exprs = append(exprs, "m.b_name", "COALESCE(m.subpackage, '')")
+
+	query := `SELECT ` + strings.Join(exprs, ", ") + ` FROM measurement m
+		LEFT JOIN benchmark b ON b.bench_id = m.bench_id
+		LEFT JOIN host h ON h.h_id = m.h_id`
+	where, params := filter.where()
+	query += where + ` ORDER BY m.m_id`
+
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		return 0, errors.Wrap(err, "querying measurements")
+	}
+	defer rows.Close()
+
+	n := 0
+	matched := make(map[string]bool) // benchmark rules per package and name
+	for rows.Next() {
+		dest := make([]any, len(columns)+2)
+		for i, c := range columns {
+			dest[i] = scanTarget(c.Kind)
+		}
+		var bName, subPackage string
+		dest[len(columns)] = &bName
+		dest[len(columns)+1] = &subPackage
+		if err := rows.Scan(dest...); err != nil {
+			return n, err
+		}
+
+		key := subPackage + " " + bName
+		match, known := matched[key]
+		if !known {
+			match = filter.Benchmarks.excludedBy(&common.Benchmark{Name: bName, Package: subPackage}) == ""
+			matched[key] = match
+		}
+		if !match {
+			continue
+		}
+
+		n++
+		values := make([]any, len(columns))
+		for i, c := range columns {
+			values[i] = scannedValue(dest[i])
+			if renumber && c.Name == "m_id" {
+				values[i] = int64(n)
+			}
+		}
+		if err := rw.WriteRow(values); err != nil {
+			return n, err
+		}
+	}
+	return n, rows.Err()
+}
+
+// where returns the WHERE clause and its parameters.
+func (filter *exportFilter) where() (string, []any) {
+	conditions := make([]string, 0)
+	params := make([]any, 0)
+	if len(filter.Experiments) > 0 {
+		conditions = append(conditions, "m.e_id IN ("+placeholders(len(filter.Experiments))+")")
+		for _, e := range filter.Experiments {
+			params = append(params, e)
+		}
+	}
+	if filter.Project != "" {
+		conditions = append(conditions, "m.p_name = ?")
+		params = append(params, filter.Project)
+	}
+	if len(filter.Tags) > 0 {
+		conditions = append(conditions, "m.tag IN ("+placeholders(len(filter.Tags))+")")
+		for _, t := range filter.Tags {
+			params = append(params, t)
+		}
+	}
+	if len(conditions) == 0 {
+		return "", params
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), params
+}
+
+// placeholders returns n comma separated ? placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// splitList splits the comma separated values of a listFlag.
+func splitList(values []string) []string {
+	list := make([]string, 0, len(values))
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				list = append(list, part)
+			}
+		}
+	}
+	return list
+}
+
+// scanTarget returns the nullable scan destination of a column kind.
+func scanTarget(kind string) any {
+	switch kind {
+	case COLUMN_INT:
+		return &sql.NullInt64{}
+	case COLUMN_FLOAT:
+		return &sql.NullFloat64{}
+	case COLUMN_BOOL:
+		return &sql.NullBool{}
+	default:
+		return &sql.NullString{}
+	}
+}
+
+// scannedValue returns the value of a scan destination, nil for NULL.
+func scannedValue(dest any) any {
+	switch v := dest.(type) {
+	case *sql.NullInt64:
+		if v.Valid {
+			return v.Int64
+		}
+	case *sql.NullFloat64:
+		if v.Valid {
+			return v.Float64
+		}
+	case *sql.NullBool:
+		if v.Valid {
+			return v.Bool
+		}
+	case *sql.NullString:
+		if v.Valid {
+			return v.String
+		}
+	}
+	return nil
+}
+
+// newResultWriter creates the writer of the format, and writes the header if the format has one.
+func newResultWriter(format string, out io.Writer, columns []exportColumn) (resultWriter, error) {
+	switch format {
+	case EXPORT_CSV:
+		w := csv.NewWriter(out)
+		header := make([]string, 0, len(columns))
+		for _, c := range columns {
+			header = append(header, c.Name)
+		}
+		return &csvResultWriter{w: w}, w.Write(header)
+	case EXPORT_JSONL:
+		return &jsonlResultWriter{w: out, columns: columns}, nil
+	case EXPORT_PARQUET:
+		schema := make([]string, 0, len(columns))
+		for _, c := range columns {
+			schema = append(schema, "name="+c.Name+", "+parquetType(c.Kind)+", repetitiontype=OPTIONAL")
+		}
+		pw, err := writer.NewCSVWriterFromWriter(schema, out, 1)
+		if err != nil {
+			return nil, errors.Wrap(err, "creating parquet writer")
+		}
+		return &parquetResultWriter{pw: pw}, nil
+	default:
+		return nil, errors.Errorf("unknown export format %q", format)
+	}
+}
+
+// parquetType returns the parquet schema type of a column kind.
+func parquetType(kind string) string {
+	switch kind {
+	case COLUMN_INT:
+		return "type=INT64"
+	case COLUMN_FLOAT:
+		return "type=DOUBLE"
+	case COLUMN_BOOL:
+		return "type=BOOLEAN"
+	default:
+		return "type=BYTE_ARRAY, convertedtype=UTF8"
+	}
+}
+
+// WriteRow writes the values as CSV record, NULL as empty field. Whole floats keep a decimal point like
+// in the CSVs pandas wrote, e.g., 706.0 in optimizer/zap.csv.
+func (rw *csvResultWriter) WriteRow(values []any) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case nil:
+			record[i] = ""
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+			if !strings.ContainsAny(record[i], ".NI") { // not NaN or Inf
+				record[i] += ".0"
+			}
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return rw.w.Write(record)
+}
+
+func (rw *csvResultWriter) Close() error {
+	rw.w.Flush()
+	return rw.w.Error()
+}
+
+// WriteRow writes the values as JSON object keyed by column name, in the order of the columns.
+// NaN and Inf have no JSON representation and are written as null.
+func (rw *jsonlResultWriter) WriteRow(values []any) error {
+	var sb strings.Builder
+	sb.WriteString("{")
+	for i, v := range values {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		key, _ := json.Marshal(rw.columns[i].Name)
+		if f, ok := v.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			v = nil
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		sb.Write(key)
+		sb.WriteString(":")
+		sb.Write(value)
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(rw.w, sb.String())
+	return err
+}
+
+func (rw *jsonlResultWriter) Close() error {
+	return nil
+}
+
+func (rw *parquetResultWriter) WriteRow(values []any) error {
+	return rw.pw.Write(values)
+}
+
+// Close writes the footer of the parquet file.
+func (rw *parquetResultWriter) Close() error {
+	return rw.pw.WriteStop()
+}
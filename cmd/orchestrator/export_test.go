@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// TestExportOptimizerCSV checks that the default columns reproduce optimizer/zap.csv from the database it was exported from.
+func TestExportOptimizerCSV(t *testing.T) {
+	openMigratedDB(t, "../../optimizer/final_data_with_config/zap/zap.db")
+	want, err := os.ReadFile("../../optimizer/zap.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := exportTo(t, EXPORT_CSV, strings.Join(OPTIMIZER_COLUMNS, ","))
+	// zap.csv was written on Windows
+	if !bytes.Equal(got, bytes.ReplaceAll(want, []byte("\r\n"), []byte("\n"))) {
+		gotLines, wantLines := strings.Split(string(got), "\n"), strings.Split(string(want), "\r\n")
+		for i := 0; i < len(gotLines) && i < len(wantLines); i++ {
+			if gotLines[i] != wantLines[i] {
+				t.Fatalf("line %d = %q, want %q", i+1, gotLines[i], wantLines[i])
+			}
+		}
+		t.Fatalf("exported %d lines, want %d", len(gotLines), len(wantLines))
+	}
+}
+
+// TestExportRoundTrip reads the measurements of a small database back from every format, including NULLs.
+func TestExportRoundTrip(t *testing.T) {
+	openMigratedDB(t, "")
+	for _, statement := range []string{
+		`INSERT INTO project(p_name, base_package) VALUES ('zap', 'go.uber.org/zap')`,
+		`INSERT INTO benchmark(b_name, subpackage, p_name, function, params, procs) VALUES ('BenchmarkEncode/size=10', './', 'zap', 'BenchmarkEncode', '{"size":"10"}', 4)`,
+		`INSERT INTO measurement(n, ns_per_op, bed_setup, it_setup, sr_setup, ir_setup, bed_pos, it_pos, sr_pos, ir_pos, b_name, subpackage, p_name, bench_id,
+			cpu_user_pct, ctx_switches, profiled) VALUES (1000, 706.0, 1, 1, 1, 1, 1, 1, 1, 1, 'BenchmarkEncode/size=10', './', 'zap', 1, 12.5, 300, TRUE)`,
+		`INSERT INTO measurement(n, ns_per_op, bed_setup, it_setup, sr_setup, ir_setup, bed_pos, it_pos, sr_pos, ir_pos, b_name, subpackage, p_name, bench_id)
+			VALUES (1000, 708.8, 1, 1, 1, 1, 1, 2, 1, 1, 'BenchmarkEncode/size=10', './', 'zap', 1)`,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+
+	names := "m_id,ns_per_op,b_name,params,procs,cpu_user_pct,ctx_switches,profiled"
+	columns, err := selectExportColumns(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]any{
+		{int64(1), 706.0, "BenchmarkEncode/size=10", `{"size":"10"}`, int64(4), 12.5, int64(300), true},
+		{int64(2), 708.8, "BenchmarkEncode/size=10", `{"size":"10"}`, int64(4), nil, nil, false},
+	}
+
+	for _, format := range []string{EXPORT_CSV, EXPORT_JSONL, EXPORT_PARQUET} {
+		var got [][]any
+		switch out := exportTo(t, format, names); format {
+		case EXPORT_CSV:
+			got = readCsvExport(t, out, columns)
+		case EXPORT_JSONL:
+			got = readJsonlExport(t, out, columns)
+		case EXPORT_PARQUET:
+			got = readParquetExport(t, out, columns)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: read back %v, want %v", format, got, want)
+		}
+	}
+}
+
+// TestExportRenumber exports a subset of the measurements, which keeps the m_id of the database unless renumbered.
+func TestExportRenumber(t *testing.T) {
+	openMigratedDB(t, "")
+	for _, tag := range []string{"v1", "v2", "v2"} {
+		_, err := db.Exec(`INSERT INTO measurement(n, ns_per_op, bed_setup, it_setup, sr_setup, ir_setup, bed_pos, it_pos, sr_pos, ir_pos, b_name, subpackage, p_name, tag)
+			VALUES (1000, 706.0, 1, 1, 1, 1, 1, 1, 1, 1, 'BenchmarkA', './', 'zap', ?)`, tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	columns, err := selectExportColumns("m_id,tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := newExportFilter(nil, "", []string{"v2"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for renumber, want := range map[bool]string{false: "m_id,tag\n2,v2\n3,v2\n", true: "m_id,tag\n1,v2\n2,v2\n"} {
+		var out bytes.Buffer
+		rw, err := newResultWriter(EXPORT_CSV, &out, columns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := exportMeasurements(rw, columns, filter, renumber); err != nil || n != 2 {
+			t.Fatalf("exportMeasurements = %d, %v, want 2 measurements", n, err)
+		}
+		rw.Close()
+		if out.String() != want {
+			t.Errorf("renumber %t exported %q, want %q", renumber, out.String(), want)
+		}
+	}
+}
+
+func TestIsOptimizerLayout(t *testing.T) {
+	tests := map[string]bool{
+		strings.Join(OPTIMIZER_COLUMNS, ","): true,
+		"all":                                false,
+		"m_id,n,ns_per_op":                   false,
+		"n,m_id,ns_per_op,bed_setup,it_setup,sr_setup,ir_setup,bed_pos,it_pos,sr_pos,ir_pos,b_name": false,
+	}
+	for names, want := range tests {
+		columns, err := selectExportColumns(names)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := isOptimizerLayout(columns); got != want {
+			t.Errorf("isOptimizerLayout(%s) = %t, want %t", names, got, want)
+		}
+	}
+}
+
+// TestJsonlNonFinite checks that NaN and Inf, which JSON cannot represent, are written as null.
+func TestJsonlNonFinite(t *testing.T) {
+	columns, err := selectExportColumns("ns_per_op,cpu_user_pct,load_avg1,b_name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	rw, err := newResultWriter(EXPORT_JSONL, &out, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.WriteRow([]any{math.NaN(), math.Inf(1), math.Inf(-1), "BenchmarkA"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.WriteRow([]any{706.5, nil, 0.25, "BenchmarkB"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"ns_per_op":null,"cpu_user_pct":null,"load_avg1":null,"b_name":"BenchmarkA"}` + "\n" +
+		`{"ns_per_op":706.5,"cpu_user_pct":null,"load_avg1":0.25,"b_name":"BenchmarkB"}` + "\n"
+	if out.String() != want {
+		t.Errorf("jsonl export %q, want %q", out.String(), want)
+	}
+}
+
+// exportTo exports all measurements of db with the comma separated columns in the format.
+func exportTo(t *testing.T, format string, names string) []byte {
+	t.Helper()
+	columns, err := selectExportColumns(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := newExportFilter(nil, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	rw, err := newResultWriter(format, &out, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exportMeasurements(rw, columns, filter, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func readCsvExport(t *testing.T, out []byte, columns []exportColumn) [][]any {
+	records, err := csv.NewReader(bytes.NewReader(out)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := make([][]any, 0)
+	for _, record := range records[1:] {
+		row := make([]any, len(columns))
+		for i, c := range columns {
+			if records[0][i] != c.Name {
+				t.Fatalf("csv header %v", records[0])
+			}
+			row[i] = parseExported(t, c.Kind, record[i])
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func readJsonlExport(t *testing.T, out []byte, columns []exportColumn) [][]any {
+	rows := make([][]any, 0)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		var object map[string]any
+		if err := decoder.Decode(&object); err != nil {
+			t.Fatal(err)
+		}
+		row := make([]any, len(columns))
+		for i, c := range columns {
+			switch v := object[c.Name].(type) {
+			case json.Number:
+				row[i] = parseExported(t, c.Kind, v.String())
+			default:
+				row[i] = v
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func readParquetExport(t *testing.T, out []byte, columns []exportColumn) [][]any {
+	file, err := buffer.NewBufferFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := reader.NewParquetReader(file, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+	objects, err := pr.ReadByNumber(int(pr.GetNumRows()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := make([][]any, 0)
+	for _, object := range objects {
+		row := make([]any, len(columns))
+		for i, c := range columns {
+			// optional columns are read as pointers into a struct with capitalized field names
+			field := reflect.ValueOf(object).FieldByName(strings.ToUpper(c.Name[:1]) + c.Name[1:])
+			if !field.IsValid() {
+				t.Fatalf("parquet file has no column %s", c.Name)
+			}
+			if !field.IsNil() {
+				row[i] = field.Elem().Interface()
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// parseExported parses a value written as text, empty is NULL.
+func parseExported(t *testing.T, kind string, value string) any {
+	if value == "" {
+		return nil
+	}
+	var v any
+	var err error
+	switch kind {
+	case COLUMN_INT:
+		v, err = strconv.ParseInt(value, 10, 64)
+	case COLUMN_FLOAT:
+		v, err = strconv.ParseFloat(value, 64)
+	case COLUMN_BOOL:
+		v, err = strconv.ParseBool(value)
+	default:
+		v = value
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
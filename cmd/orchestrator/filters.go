@@ -0,0 +1,165 @@
+package main
+
+import (
+	"cloud-benchmark-tool/common"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// filterRule matches one field of a benchmark against a glob or regular expression.
+	// Rules are written as [field:][re:]pattern, field is one of name (default), params, pkg or label.
+	// Patterns are globs (* matches any sequence, ? a single character) unless prefixed with re:.
+	filterRule struct {
+		Rule    string
+		Field   string
+		Pattern *regexp.Regexp
+	}
+
+	// benchmarkFilter holds the include and exclude rules of the config file.
+	benchmarkFilter struct {
+		Include []filterRule
+		Exclude []filterRule
+	}
+
+	// exclusion records why a benchmark was not scheduled.
+	exclusion struct {
+		Benchmark common.Benchmark
+		Rule      string
+	}
+)
+
+const (
+	FILTER_FIELD_NAME   = "name"
+	FILTER_FIELD_PARAMS = "params"
+	FILTER_FIELD_PKG    = "pkg"
+	FILTER_FIELD_LABEL  = "label"
+
+	RULE_NOT_INCLUDED = "not matched by any include rule"
+)
+
+// newBenchmarkFilter parses the include and exclude rules.
+func newBenchmarkFilter(include []string, exclude []string) (*benchmarkFilter, error) {
+	var filter benchmarkFilter
+	for _, rule := range include {
+		parsed, err := parseFilterRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		filter.Include = append(filter.Include, parsed)
+	}
+	for _, rule := range exclude {
+		parsed, err := parseFilterRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		filter.Exclude = append(filter.Exclude, parsed)
+	}
+	return &filter, nil
+}
+
+func parseFilterRule(rule string) (filterRule, error) {
+	parsed := filterRule{Rule: rule, Field: FILTER_FIELD_NAME}
+	pattern := rule
+
+	for _, field := range []string{FILTER_FIELD_NAME, FILTER_FIELD_PARAMS, FILTER_FIELD_PKG, FILTER_FIELD_LABEL} {
+		if strings.HasPrefix(pattern, field+":") {
+			parsed.Field = field
+			pattern = strings.TrimPrefix(pattern, field+":")
+			break
+		}
+	}
+
+	var err error
+	if strings.HasPrefix(pattern, "re:") {
+		parsed.Pattern, err = regexp.Compile(strings.TrimPrefix(pattern, "re:"))
+	} else {
+		parsed.Pattern, err = regexp.Compile(globToRegexp(pattern))
+	}
+	if err != nil {
+		return parsed, errors.Wrapf(err, "invalid filter rule %q", rule)
+	}
+	return parsed, nil
+}
+
+// globToRegexp converts a glob into an anchored regular expression. Unlike path.Match, * also matches '/',
+// so that globs can span sub-benchmark levels.
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+// matches checks the rule against the respective field of the benchmark.
+func (rule *filterRule) matches(bench *common.Benchmark) bool {
+	switch rule.Field {
+	case FILTER_FIELD_PARAMS:
+		_, params, found := strings.Cut(bench.Name, "/")
+		return found && rule.Pattern.MatchString(params)
+	case FILTER_FIELD_PKG:
+		return rule.Pattern.MatchString(bench.ProjectPackage())
+	case FILTER_FIELD_LABEL:
+		for _, label := range bench.Annotations.Labels {
+			if rule.Pattern.MatchString(label) {
+				return true
+			}
+		}
+		return false
+	default:
+		return rule.Pattern.MatchString(bench.Name)
+	}
+}
+
+// excludedBy returns the rule excluding the benchmark, or an empty string if the benchmark is scheduled.
+// With include rules, a benchmark has to match at least one of them. Exclude rules always take precedence.
+func (filter *benchmarkFilter) excludedBy(bench *common.Benchmark) string {
+	if len(filter.Include) > 0 {
+		included := false
+		for i := range filter.Include {
+			if filter.Include[i].matches(bench) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return RULE_NOT_INCLUDED
+		}
+	}
+
+	for i := range filter.Exclude {
+		if filter.Exclude[i].matches(bench) {
+			return filter.Exclude[i].Rule
+		}
+	}
+	return ""
+}
+
+// apply splits the benchmarks into the scheduled ones and the exclusions, logging each exclusion.
+func (filter *benchmarkFilter) apply(benchmarks []common.Benchmark) ([]common.Benchmark, []exclusion) {
+	kept := make([]common.Benchmark, 0, len(benchmarks))
+	excluded := make([]exclusion, 0)
+	for _, b := range benchmarks {
+		rule := filter.excludedBy(&b)
+		if rule == "" {
+			kept = append(kept, b)
+			continue
+		}
+		log.Infof("Excluding benchmark %s in %s, rule: %s", b.Name, b.ProjectPackage(), rule)
+		excluded = append(excluded, exclusion{Benchmark: b, Rule: rule})
+	}
+	return kept, excluded
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"cloud-benchmark-tool/common"
+	"reflect"
+	"testing"
+)
+
+func TestFilterRuleMatches(t *testing.T) {
+	bench := &common.Benchmark{
+		Name:        "BenchmarkEncode/size=1024/json",
+		Package:     "./codec",
+		Module:      "./api",
+		Annotations: common.Annotations{Labels: []string{"slow", "io"}},
+	}
+	tests := []struct {
+		rule  string
+		match bool
+	}{
+		{"BenchmarkEncode*", true},
+		{"BenchmarkEncode", false},
+		// * spans sub-benchmark levels, ? matches a single character
+		{"*/json", true},
+		{"BenchmarkEncod?/size=1024/json", true},
+		{"BenchmarkEncod?", false},
+		{"name:re:^BenchmarkEnc", true},
+		{"re:json$", true},
+		{"re:^json", false},
+		// glob characters of regular expressions are quoted
+		{"BenchmarkEncode/size=1024/js.n", false},
+		{"params:size=*", true},
+		{"params:json", false},
+		{"params:re:json", true},
+		{"pkg:./api/codec", true},
+		{"pkg:./codec", false},
+		{"pkg:*codec", true},
+		{"label:slow", true},
+		{"label:s*", true},
+		{"label:fast", false},
+	}
+	for _, test := range tests {
+		rule, err := parseFilterRule(test.rule)
+		if err != nil {
+			t.Fatalf("parseFilterRule(%q): %v", test.rule, err)
+		}
+		if got := rule.matches(bench); got != test.match {
+			t.Errorf("%q matches %s = %t, want %t", test.rule, bench.Name, got, test.match)
+		}
+	}
+
+	// a benchmark without sub-benchmarks has no params
+	rule, _ := parseFilterRule("params:*")
+	if rule.matches(&common.Benchmark{Name: "BenchmarkEncode"}) {
+		t.Errorf("params:* matches BenchmarkEncode without params")
+	}
+	if _, err := parseFilterRule("re:("); err == nil {
+		t.Errorf("parseFilterRule(%q) returned no error", "re:(")
+	}
+}
+
+func TestBenchmarkFilterApply(t *testing.T) {
+	benchmarks := []common.Benchmark{
+		{Name: "BenchmarkEncode/small", Package: "./"},
+		{Name: "BenchmarkEncode/large", Package: "./"},
+		{Name: "BenchmarkDecode", Package: "./"},
+		{Name: "BenchmarkParse", Package: "./internal"},
+	}
+	tests := []struct {
+		name             string
+		include, exclude []string
+		kept             []string
+		rules            []string
+	}{
+		{"no rules", nil, nil, []string{"BenchmarkEncode/small", "BenchmarkEncode/large", "BenchmarkDecode", "BenchmarkParse"}, []string{}},
+		{"include", []string{"BenchmarkEncode*", "BenchmarkDecode"}, nil,
+			[]string{"BenchmarkEncode/small", "BenchmarkEncode/large", "BenchmarkDecode"}, []string{RULE_NOT_INCLUDED}},
+		{"exclude", nil, []string{"pkg:./internal", "*/large"},
+			[]string{"BenchmarkEncode/small", "BenchmarkDecode"}, []string{"*/large", "pkg:./internal"}},
+		// exclude rules take precedence over include rules
+		{"include and exclude", []string{"BenchmarkEncode*"}, []string{"params:small"},
+			[]string{"BenchmarkEncode/large"}, []string{"params:small", RULE_NOT_INCLUDED, RULE_NOT_INCLUDED}},
+	}
+	for _, test := range tests {
+		filter, err := newBenchmarkFilter(test.include, test.exclude)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		kept, excluded := filter.apply(benchmarks)
+		keptNames := make([]string, 0, len(kept))
+		for _, b := range kept {
+			keptNames = append(keptNames, b.Name)
+		}
+		rules := make([]string, 0, len(excluded))
+		for _, e := range excluded {
+			rules = append(rules, e.Rule)
+		}
+		if !reflect.DeepEqual(keptNames, test.kept) || !reflect.DeepEqual(rules, test.rules) {
+			t.Errorf("%s: kept %v, excluded by %v, want %v, %v", test.name, keptNames, rules, test.kept, test.rules)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cloud-benchmark-tool/common"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	benchparser "golang.org/x/tools/benchmark/parse"
+)
+
+// Origins of imported experiments, experiments run by the orchestrator have the origin orchestrator
+const (
+	ORIGIN_IMPORT_CSV    = "import-csv"
+	ORIGIN_IMPORT_GOTEST = "import-gotest"
+)
+
+// Import formats
+const (
+	IMPORT_CSV    = "csv"
+	IMPORT_GOTEST = "gotest"
+)
+
+type (
+	// importedMeasurement is a measurement read from an imported file, with the setup of its experiment.
+	importedMeasurement struct {
+		Name        string // without GOMAXPROCS suffix
+		Package     string
+		Procs       int
+		BedSetup    int
+		ItSetup     int
+		SrSetup     int
+		IrSetup     int
+		IrPos       int
+		Measurement common.Measurement
+	}
+
+	// importedRun is the content of an imported file, which is stored as one experiment.
+	importedRun struct {
+		Origin       string
+		Host         *common.HostInfo // nil if the file does not describe the host
+		Measurements []importedMeasurement
+	}
+)
+
+// legacyRequiredColumns are the columns of the CSVs in optimizer/, legacyOptionalColumns were added to later exports.
+var legacyRequiredColumns = []string{"n", "ns_per_op", "bed_setup", "it_setup", "sr_setup", "ir_setup", "bed_pos", "it_pos", "sr_pos", "ir_pos", "b_name"}
+var legacyOptionalColumns = []string{"m_id", "tag", "count_idx", "subpackage"}
+
+// importCommand stores measurement CSVs and go test -bench output as experiments, one per file.
+// Files which were imported before, identified by their SHA-256, are skipped.
+func importCommand(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dbConfig := dbFlags(fs)
+	format := fs.String("format", "", "Input format, csv or gotest. Default is csv for .csv files, otherwise gotest.")
+	project := fs.String("project", "", "Project of the measurements, default is the file name without extension.")
+	basePackage := fs.String("base-package", "", "Base package of the project, go test packages are stored relative to it. Default is the base package already registered.")
+	tag := fs.String("tag", "", "Tag of measurements without a tag column, and of go test output.")
+	pkg := fs.String("package", "./", "Package of CSV measurements without a subpackage column.")
+	configFile := fs.String("config", "", "Config file the measurements were recorded with, stored as the config of the experiment.")
+	force := fs.Bool("force", false, "Import files again, even if they were imported before.")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fatalf("usage: import [flags] file...")
+	}
+	var config []byte
+	if *configFile != "" {
+		var err error
+		config, err = os.ReadFile(*configFile)
+		if err != nil {
+			fatalf("%v", err)
+		}
+	}
+
+	openDB(dbConfig)
+	defer CloseDB()
+	if err := migrateDB(0); err != nil {
+		fatalf("%v", err)
+	}
+
+	for _, fileName := range fs.Args() {
+		content, err := os.ReadFile(fileName)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		sum := sha256.Sum256(content)
+		checksum := hex.EncodeToString(sum[:])
+		if eId, found := selectImportedExperiment(checksum); found && !*force {
+			fmt.Printf("skipping %s, imported before as experiment %d\n", fileName, eId)
+			continue
+		}
+
+		pName := *project
+		if pName == "" {
+			pName = strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+		}
+		base := *basePackage
+		if base == "" {
+			base = selectBasePackage(pName)
+		}
+
+		fileFormat := *format
+		if fileFormat == "" {
+			fileFormat = IMPORT_GOTEST
+			if strings.EqualFold(filepath.Ext(fileName), ".csv") {
+				fileFormat = IMPORT_CSV
+			}
+		}
+
+		var run *importedRun
+		switch fileFormat {
+		case IMPORT_CSV:
+			run, err = parseMeasurementCSV(bytes.NewReader(content), *tag, *pkg)
+		case IMPORT_GOTEST:
+			run, err = parseGoTestOutput(bytes.NewReader(content), base, *tag)
+		default:
+			err = errors.Errorf("unknown import format %q", fileFormat)
+		}
+		if err != nil {
+			fatalf("%s: %v", fileName, err)
+		}
+
+		source, _ := filepath.Abs(fileName)
+		importArgs, _ := json.Marshal(map[string]string{"format": fileFormat, "project": pName, "tag": *tag, "package": *pkg, "config": *configFile})
+		eId, benchmarks, err := storeImportedRun(pName, base, source, checksum, string(config), string(importArgs), run)
+		if err != nil {
+			fatalf("%s: %v", fileName, err)
+		}
+		fmt.Printf("imported %s: %d measurements of %d benchmarks as experiment %d of project %s\n",
+			fileName, len(run.Measurements), benchmarks, eId, pName)
+	}
+}
+
+// parseMeasurementCSV reads a CSV with the columns of the measurement table as exported for optimizer/, e.g., zap.csv.
+// Columns may be in any order, tag, count_idx and subpackage are optional and default to tag and pkg.
+func parseMeasurementCSV(r io.Reader, tag string, pkg string) (*importedRun, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading header")
+	}
+	index := make(map[string]int, len(header))
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		if !containsString(legacyRequiredColumns, column) && !containsString(legacyOptionalColumns, column) {
+			return nil, errors.Errorf("unsupported column %q, expected the columns %s", column, strings.Join(legacyRequiredColumns, ","))
+		}
+		index[column] = i
+	}
+	for _, column := range legacyRequiredColumns {
+		if _, found := index[column]; !found {
+			return nil, errors.Errorf("missing column %q", column)
+		}
+	}
+
+	run := importedRun{Origin: ORIGIN_IMPORT_CSV}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+
+		var parseErr error
+		intValue := func(column string) int {
+			i, found := index[column]
+			if !found {
+				return 0
+			}
+			v, err := strconv.Atoi(strings.TrimSpace(record[i]))
+			if err != nil && parseErr == nil {
+				parseErr = errors.Wrapf(err, "line %d, column %s", line, column)
+			}
+			return v
+		}
+		stringValue := func(column string, defaultValue string) string {
+			if i, found := index[column]; found && record[i] != "" {
+				return record[i]
+			}
+			return defaultValue
+		}
+
+		nsPerOp, err := strconv.ParseFloat(strings.TrimSpace(record[index["ns_per_op"]]), 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d, column ns_per_op", line)
+		}
+		m := importedMeasurement{
+			Name:     record[index["b_name"]],
+			Package:  stringValue("subpackage", pkg),
+			Procs:    1,
+			BedSetup: intValue("bed_setup"),
+			ItSetup:  intValue("it_setup"),
+			SrSetup:  intValue("sr_setup"),
+			IrSetup:  intValue("ir_setup"),
+			IrPos:    intValue("ir_pos"),
+			Measurement: common.Measurement{
+				N:          intValue("n"),
+				NsPerOp:    nsPerOp,
+				BedPos:     intValue("bed_pos"),
+				ItPos:      intValue("it_pos"),
+				SrPos:      intValue("sr_pos"),
+				Tag:        stringValue("tag", tag),
+				CountIndex: intValue("count_idx"),
+			},
+		}
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		run.Measurements = append(run.Measurements, m)
+	}
+
+	if len(run.Measurements) == 0 {
+		return nil, errors.New("no measurements")
+	}
+	return &run, nil
+}
+
+// parseGoTestOutput reads the benchmark results of plain go test -bench output, e.g., CI logs. pkg: lines set the package
+// of the following results, stored relative to the base package, goos, goarch and cpu lines describe the host.
+// Every result line is one measurement, repeated results of a benchmark (-count) are numbered by count_idx.
+// Benchmarks are stored without GOMAXPROCS suffix, output of a benchmark run with several -cpu values is rejected.
+func parseGoTestOutput(r io.Reader, basePackage string, tag string) (*importedRun, error) {
+	run := importedRun{Origin: ORIGIN_IMPORT_GOTEST}
+	var host common.HostInfo
+	goEnv := make(map[string]string)
+	pkg := "./"
+	counts := make(map[string]int)
+	procs := make(map[string]int) // -cpu value per package and benchmark
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "pkg: "):
+			pkg = relativePackage(strings.TrimSpace(strings.TrimPrefix(line, "pkg: ")), basePackage)
+		case strings.HasPrefix(line, "goos: "):
+			goEnv["GOOS"] = strings.TrimSpace(strings.TrimPrefix(line, "goos: "))
+		case strings.HasPrefix(line, "goarch: "):
+			goEnv["GOARCH"] = strings.TrimSpace(strings.TrimPrefix(line, "goarch: "))
+		case strings.HasPrefix(line, "cpu: "):
+			host.CpuModel = strings.TrimSpace(strings.TrimPrefix(line, "cpu: "))
+		case common.REGEX_BENCH.MatchString(line):
+			// lines of go test -v only announcing a benchmark carry no result
+			b, err := benchparser.ParseLine(line)
+			if err != nil {
+				continue
+			}
+			name := common.ParseBenchmarkName(b.Name, 0)
+			key := pkg + " " + name.Name()
+			if p, seen := procs[key]; seen && p != name.Procs {
+				return nil, errors.Errorf("%s in %s ran with -cpu %d and %d, import the output of each -cpu value separately",
+					name.Name(), pkg, p, name.Procs)
+			}
+			procs[key] = name.Procs
+
+			m := importedMeasurement{
+				Name:     name.Name(),
+				Package:  pkg,
+				Procs:    name.Procs,
+				BedSetup: 1,
+				ItSetup:  1,
+				SrSetup:  1,
+				IrSetup:  1,
+				IrPos:    1,
+				Measurement: common.Measurement{
+					N:          b.N,
+					NsPerOp:    b.NsPerOp,
+					BedPos:     1,
+					ItPos:      1,
+					SrPos:      1,
+					Tag:        tag,
+					CountIndex: counts[key],
+				},
+			}
+			if name.Procs != 1 {
+				m.Measurement.Isolation.GoMaxProcs = name.Procs
+			}
+			counts[key]++
+			run.Measurements = append(run.Measurements, m)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(run.Measurements) == 0 {
+		return nil, errors.New("no benchmark results")
+	}
+	if host.CpuModel != "" || len(goEnv) > 0 {
+		encoded, _ := json.Marshal(goEnv)
+		host.GoEnv = string(encoded)
+		run.Host = &host
+	}
+	return &run, nil
+}
+
+// relativePackage returns the import path relative to the base package, e.g., ./sub, or unchanged if it is outside of it.
+func relativePackage(importPath string, basePackage string) string {
+	if basePackage == "" {
+		return importPath
+	}
+	if importPath == basePackage {
+		return "./"
+	}
+	if strings.HasPrefix(importPath, basePackage+"/") {
+		return "./" + strings.TrimPrefix(importPath, basePackage+"/")
+	}
+	return importPath
+}
+
+// storeImportedRun stores the run as finished experiment, and registers its benchmarks and host.
+// It returns the ID of the experiment and the number of benchmarks.
+func storeImportedRun(pName string, basePackage string, source string, checksum string, config string, args string, run *importedRun) (int64, int, error) {
+	first := run.Measurements[0]
+	insertProject(pName, basePackage)
+	currExperiment = runningExperiment{Project: pName}
+	currExperiment.Id = insertExperiment(pName, config, args, common.BuildVersion(), "", first.BedSetup, first.ItSetup, first.SrSetup, first.IrSetup)
+	updateExperimentSource(currExperiment.Id, run.Origin, source, checksum)
+	eId := currExperiment.Id
+
+	var hostId int64
+	if run.Host != nil {
+		hostId = insertHost(1, *run.Host)
+	}
+
+	// register the benchmarks before writing the measurements in one transaction
+	benchIds := make(map[string]int64)
+	for _, m := range run.Measurements {
+		key := m.Package + " " + m.Name
+		benchId, known := benchIds[key]
+		if !known {
+			name := common.ParseBenchmarkName(m.Name, 1)
+			name.Procs = m.Procs
+			var err error
+			benchId, err = insertBenchmark(m.Name, m.Package, "./", pName, name, common.Annotations{})
+			if err != nil {
+				finishExperiment(EXPERIMENT_FAILED)
+				return eId, 0, err
+			}
+			benchIds[key] = benchId
+			insertExperimentBenchmark(m.Name, m.Package, pName)
+		}
+		if m.Measurement.Tag != "" {
+			insertBenchmarkTag(benchId, m.Measurement.Tag)
+		}
+	}
+
+	err := insertImportedMeasurements(pName, hostId, benchIds, run.Measurements)
+	if err != nil {
+		finishExperiment(EXPERIMENT_FAILED)
+		return eId, 0, err
+	}
+	finishExperiment(EXPERIMENT_FINISHED)
+	return eId, len(benchIds), nil
+}
+
+// insertImportedMeasurements writes the measurements of the current experiment in one transaction.
+func insertImportedMeasurements(pName string, hostId int64, benchIds map[string]int64, measurements []importedMeasurement) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op after commit
+	statement, err := tx.Prepare(insertMeasurementSQL)
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	for _, m := range measurements {
+		msrmnt := m.Measurement
+		err = insertMeasurement(statement, benchIds[m.Package+" "+m.Name], m.Name, m.Package, pName, msrmnt.N, msrmnt.NsPerOp,
+			m.BedSetup, m.ItSetup, m.SrSetup, m.IrSetup, msrmnt.BedPos, msrmnt.ItPos, msrmnt.SrPos, m.IrPos, hostId,
+			msrmnt.Tag, msrmnt.CountIndex, msrmnt.Isolation, msrmnt.Noise, msrmnt.Profiled)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// importedFields are the fields of an imported measurement the tests compare.
+type importedFields struct {
+	Name       string
+	Package    string
+	Procs      int
+	Tag        string
+	CountIndex int
+	N          int
+	NsPerOp    float64
+	BedPos     int
+}
+
+func fieldsOf(run *importedRun) []importedFields {
+	fields := make([]importedFields, 0, len(run.Measurements))
+	for _, m := range run.Measurements {
+		fields = append(fields, importedFields{m.Name, m.Package, m.Procs, m.Measurement.Tag, m.Measurement.CountIndex,
+			m.Measurement.N, m.Measurement.NsPerOp, m.Measurement.BedPos})
+	}
+	return fields
+}
+
+func TestParseMeasurementCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want []importedFields // nil if the CSV is rejected
+	}{
+		{
+			name: "legacy header without tag",
+			csv: "m_id,n,ns_per_op,bed_setup,it_setup,sr_setup,ir_setup,bed_pos,it_pos,sr_pos,ir_pos,b_name\r\n" +
+				"1,1689104,708.8,5,5,3,3,1,1,1,1,BenchmarkBoolsArrayMarshaler\r\n" +
+				"6,1699494,706.0,5,5,3,3,2,2,1,1,BenchmarkBoolsArrayMarshaler\r\n",
+			want: []importedFields{
+				{"BenchmarkBoolsArrayMarshaler", "./", 1, "v1.21.0", 0, 1689104, 708.8, 1},
+				{"BenchmarkBoolsArrayMarshaler", "./", 1, "v1.21.0", 0, 1699494, 706, 2},
+			},
+		},
+		{
+			name: "header with tag in any order",
+			csv: "b_name,tag,count_idx,subpackage,n,ns_per_op,bed_setup,it_setup,sr_setup,ir_setup,bed_pos,it_pos,sr_pos,ir_pos\n" +
+				"BenchmarkWriter,v1.20.0,0,./zapcore,100,10.5,1,1,1,1,1,1,1,1\n" +
+				"BenchmarkWriter,v1.20.0,1,./zapcore,100,11,1,1,1,1,1,1,1,1\n" +
+				"BenchmarkWriter,,0,,100,12,1,1,1,1,2,1,1,1\n",
+			want: []importedFields{
+				{"BenchmarkWriter", "./zapcore", 1, "v1.20.0", 0, 100, 10.5, 1},
+				{"BenchmarkWriter", "./zapcore", 1, "v1.20.0", 1, 100, 11, 1},
+				{"BenchmarkWriter", "./", 1, "v1.21.0", 0, 100, 12, 2},
+			},
+		},
+		{
+			name: "missing column",
+			csv:  "n,ns_per_op,bed_setup,it_setup,sr_setup,ir_setup,bed_pos,it_pos,sr_pos,b_name\n1,1,1,1,1,1,1,1,1,BenchmarkA\n",
+		},
+		{
+			name: "unsupported column",
+			csv:  "n,ns_per_op,bed_setup,it_setup,sr_setup,ir_setup,bed_pos,it_pos,sr_pos,ir_pos,b_name,allocs\n",
+		},
+		{
+			name: "invalid number",
+			csv:  "n,ns_per_op,bed_setup,it_setup,sr_setup,ir_setup,bed_pos,it_pos,sr_pos,ir_pos,b_name\nx,1,1,1,1,1,1,1,1,1,BenchmarkA\n",
+		},
+	}
+
+	for _, test := range tests {
+		run, err := parseMeasurementCSV(strings.NewReader(test.csv), "v1.21.0", "./")
+		checkImported(t, test.name, run, err, test.want)
+	}
+}
+
+func TestParseGoTestOutput(t *testing.T) {
+	header := "goos: linux\ngoarch: amd64\n"
+	tests := []struct {
+		name string
+		out  string
+		want []importedFields // nil if the output is rejected
+	}{
+		{
+			name: "-count numbering per package",
+			out: header + "pkg: go.uber.org/zap\ncpu: Intel(R) Xeon(R) CPU @ 2.20GHz\n" +
+				"BenchmarkAddCallerHook-4   	 1000000	      1045 ns/op	     248 B/op	       3 allocs/op\n" +
+				"BenchmarkAddCallerHook-4   	 1000000	      1050 ns/op	     248 B/op	       3 allocs/op\n" +
+				"PASS\nok  	go.uber.org/zap	2.345s\n" +
+				header + "pkg: go.uber.org/zap/zapcore\n" +
+				"BenchmarkAddCallerHook-4   	 2000000	       600.5 ns/op\n" +
+				"BenchmarkEntryCaller/enabled-4   	 3000000	       400 ns/op\n",
+			want: []importedFields{
+				{"BenchmarkAddCallerHook", "./", 4, "v1.21.0", 0, 1000000, 1045, 1},
+				{"BenchmarkAddCallerHook", "./", 4, "v1.21.0", 1, 1000000, 1050, 1},
+				{"BenchmarkAddCallerHook", "./zapcore", 4, "v1.21.0", 0, 2000000, 600.5, 1},
+				{"BenchmarkEntryCaller/enabled", "./zapcore", 4, "v1.21.0", 0, 3000000, 400, 1},
+			},
+		},
+		{
+			name: "-v output and packages outside of the base package",
+			out: "pkg: go.uber.org/multierr\n=== RUN   BenchmarkAppend\nBenchmarkAppend\n" +
+				"BenchmarkAppend   	 5000000	       250 ns/op\n",
+			want: []importedFields{
+				{"BenchmarkAppend", "go.uber.org/multierr", 1, "v1.21.0", 0, 5000000, 250, 1},
+			},
+		},
+		{
+			name: "several -cpu values",
+			out: "pkg: go.uber.org/zap\nBenchmarkAddCallerHook-4   	 1000000	      1045 ns/op\n" +
+				"BenchmarkAddCallerHook-8   	 1000000	      1000 ns/op\n",
+		},
+		{
+			name: "no results",
+			out:  header + "pkg: go.uber.org/zap\nPASS\n",
+		},
+	}
+
+	for _, test := range tests {
+		run, err := parseGoTestOutput(strings.NewReader(test.out), "go.uber.org/zap", "v1.21.0")
+		checkImported(t, test.name, run, err, test.want)
+	}
+}
+
+func checkImported(t *testing.T, name string, run *importedRun, err error, want []importedFields) {
+	t.Helper()
+	if want == nil {
+		if err == nil {
+			t.Errorf("%s: no error", name)
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("%s: %v", name, err)
+		return
+	}
+	got := fieldsOf(run)
+	if len(got) != len(want) {
+		t.Errorf("%s: %d measurements %+v, want %d", name, len(got), got, len(want))
+		return
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%s: measurement %d = %+v, want %+v", name, i, got[i], want[i])
+		}
+	}
+}
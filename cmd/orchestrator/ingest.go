@@ -0,0 +1,231 @@
+package main
+
+import (
+	"cloud-benchmark-tool/common"
+	"database/sql"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	INGEST_QUEUE_SIZE     = 500             // benchmarks waiting to be written, producers block if the queue is full
+	INGEST_BATCH_SIZE     = 1000            // measurement and profile rows written per transaction
+	INGEST_FLUSH_INTERVAL = 2 * time.Second // pending rows are written at the latest after this interval
+)
+
+type (
+	queueElem struct {
+		benchmark *common.Benchmark
+		bedSetup  int
+		itSetup   int
+		srSetup   int
+		irSetup   int
+		irPos     int
+		hostId    int64
+	}
+
+	// ingestMetrics describes the throughput of the measurement queue and the back-pressure on its producers.
+	ingestMetrics struct {
+		Enqueued    int64         // benchmarks added to the queue
+		Blocked     int64         // enqueues which had to wait for a full queue
+		BlockedTime time.Duration // total time producers waited
+		MaxQueueLen int           // highest queue length seen by a producer
+		Flushes     int64         // committed transactions
+		Rows        int64         // measurement and profile rows written
+		FlushTime   time.Duration // total time spent writing
+	}
+)
+
+var msrmntQueue chan queueElem
+var queueMu sync.Mutex
+var ingestStats ingestMetrics
+var ingestMu sync.Mutex
+
+// RecordMeasurement queues the measurements and profiles of the benchmark, they are written by a single consumer
+// in batched transactions. The consumer is started with the first call.
+func RecordMeasurement(bench *common.Benchmark, bedSetup int, itSetup int, srSetup int, irSetup int, irPos int, hostId int64, wg *sync.WaitGroup) {
+	queueMu.Lock()
+	if msrmntQueue == nil {
+		msrmntQueue = make(chan queueElem, INGEST_QUEUE_SIZE)
+		wg.Add(1)
+		go dbQueueConsumer(msrmntQueue, INGEST_FLUSH_INTERVAL, wg)
+	}
+	queue := msrmntQueue
+	queueMu.Unlock()
+
+	currMsrmnt := queueElem{
+		benchmark: bench,
+		bedSetup:  bedSetup,
+		itSetup:   itSetup,
+		srSetup:   srSetup,
+		irSetup:   irSetup,
+		irPos:     irPos,
+		hostId:    hostId,
+	}
+
+	var blocked time.Duration
+	select {
+	case queue <- currMsrmnt:
+	default:
+		start := time.Now()
+		queue <- currMsrmnt
+		blocked = time.Since(start)
+	}
+
+	ingestMu.Lock()
+	ingestStats.Enqueued++
+	if blocked > 0 {
+		ingestStats.Blocked++
+		ingestStats.BlockedTime += blocked
+	}
+	if len(queue) > ingestStats.MaxQueueLen {
+		ingestStats.MaxQueueLen = len(queue)
+	}
+	ingestMu.Unlock()
+}
+
+// CloseMeasurementQueue stops the consumer after it wrote all queued measurements.
+// A later RecordMeasurement starts a new consumer.
+func CloseMeasurementQueue() {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+	if msrmntQueue != nil {
+		close(msrmntQueue)
+		msrmntQueue = nil
+	}
+}
+
+// dbQueueConsumer collects queued benchmarks, and writes them once INGEST_BATCH_SIZE rows are pending,
+// the flush interval passed, or the queue is closed. The insert statements are prepared once.
+func dbQueueConsumer(queue <-chan queueElem, flushInterval time.Duration, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	measurementStmt, err := db.Prepare(insertMeasurementSQL)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	defer measurementStmt.Close()
+	profileStmt, err := db.Prepare(insertProfileSQL)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	defer profileStmt.Close()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]queueElem, 0, 16)
+	pending := 0
+	for {
+		select {
+		case elem, more := <-queue:
+			if !more {
+				flushMeasurements(batch, measurementStmt, profileStmt, len(queue))
+				logIngestMetrics()
+				return
+			}
+			batch = append(batch, elem)
+			pending += len(elem.benchmark.Measurement) + len(elem.benchmark.Profiles)
+			if pending >= INGEST_BATCH_SIZE {
+				flushMeasurements(batch, measurementStmt, profileStmt, len(queue))
+				batch = batch[:0]
+				pending = 0
+			}
+		case <-ticker.C:
+			flushMeasurements(batch, measurementStmt, profileStmt, len(queue))
+			batch = batch[:0]
+			pending = 0
+		}
+	}
+}
+
+// flushMeasurements writes the measurements and profiles of the batch in one transaction.
+func flushMeasurements(batch []queueElem, measurementStmt *sql.Stmt, profileStmt *sql.Stmt, queueLen int) {
+	if len(batch) == 0 {
+		return
+	}
+	start := time.Now()
+
+	// runners echo the ID assigned at discovery, older runners do not know it
+	benchIds := make([]int64, len(batch))
+	for i, elem := range batch {
+		benchIds[i] = elem.benchmark.Id
+		if benchIds[i] == 0 {
+			benchIds[i] = selectBenchmarkId(elem.benchmark.Name, elem.benchmark.ProjectPackage(), currExperiment.Project)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	defer tx.Rollback() // no-op after commit
+	txMeasurementStmt := tx.Stmt(measurementStmt)
+	txProfileStmt := tx.Stmt(profileStmt)
+
+	rows := 0
+	for i, elem := range batch {
+		subPackage := elem.benchmark.ProjectPackage()
+		for j := 0; j < len(elem.benchmark.Measurement); j++ {
+			currMsrmnt := elem.benchmark.Measurement[j]
+			err = insertMeasurement(
+				txMeasurementStmt,
+				benchIds[i],
+				elem.benchmark.Name,
+				subPackage,
+				currExperiment.Project,
+				currMsrmnt.N,
+				currMsrmnt.NsPerOp,
+				elem.bedSetup,
+				elem.itSetup,
+				elem.srSetup,
+				elem.irSetup,
+				currMsrmnt.BedPos,
+				currMsrmnt.ItPos,
+				currMsrmnt.SrPos,
+				elem.irPos,
+				elem.hostId,
+				currMsrmnt.Tag,
+				currMsrmnt.CountIndex,
+				currMsrmnt.Isolation,
+				currMsrmnt.Noise,
+				currMsrmnt.Profiled,
+			)
+			if err != nil {
+				log.Fatalln(err.Error())
+			}
+			rows++
+		}
+		for j := 0; j < len(elem.benchmark.Profiles); j++ {
+			err = insertProfile(txProfileStmt, benchIds[i], elem.benchmark.Name, subPackage, currExperiment.Project, elem.irPos, elem.benchmark.Profiles[j])
+			if err != nil {
+				log.Fatalln(err.Error())
+			}
+			rows++
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	elapsed := time.Since(start)
+
+	ingestMu.Lock()
+	ingestStats.Flushes++
+	ingestStats.Rows += int64(rows)
+	ingestStats.FlushTime += elapsed
+	ingestMu.Unlock()
+	log.Debugf("Wrote %d rows of %d benchmarks in %v, %d benchmarks queued", rows, len(batch), elapsed, queueLen)
+}
+
+// logIngestMetrics logs the totals of the measurement queue.
+func logIngestMetrics() {
+	ingestMu.Lock()
+	defer ingestMu.Unlock()
+	log.Infof("Wrote %d rows of %d benchmarks in %d transactions (%v), max queue length %d/%d, producers blocked %d times (%v)",
+		ingestStats.Rows, ingestStats.Enqueued, ingestStats.Flushes, ingestStats.FlushTime,
+		ingestStats.MaxQueueLen, INGEST_QUEUE_SIZE, ingestStats.Blocked, ingestStats.BlockedTime)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"cloud-benchmark-tool/common"
+	"encoding/gob"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestIngestBackends writes measurements and profiles through the queue, and checks the stored rows.
+func TestIngestBackends(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		if err := migrateDB(0); err != nil {
+			t.Fatal(err)
+		}
+		insertProject("proj", "example.com/proj")
+		benchId, err := insertBenchmark("BenchmarkA/x", "./", "./", "proj", common.ParseBenchmarkName("BenchmarkA/x", 1), common.Annotations{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		currExperiment = runningExperiment{Project: "proj"}
+		t.Cleanup(func() { currExperiment = runningExperiment{} })
+		hostId := insertHost(0, common.HostInfo{Hostname: "runner", Cores: 4})
+
+		bench := &common.Benchmark{Id: benchId, Name: "BenchmarkA/x", Package: "./", Module: "./"}
+		for i := 1; i <= 3; i++ {
+			bench.Measurement = append(bench.Measurement, common.Measurement{N: 100, NsPerOp: float64(i), BedPos: i, Tag: "v1",
+				Isolation: common.Isolation{CpuSet: "1", Nice: -5}, Noise: common.SystemNoise{Sampled: true, LoadAvg1: 0.5}, Profiled: i == 1})
+		}
+		bench.Profiles = []common.ProfileFile{{Kind: "cpu", Bucket: "bucket", ObjectKey: "runner/profiles/cpu/a.out", Tag: "v1", BedPos: 1}}
+		// benchmarks of older runners do not carry their ID
+		legacy := &common.Benchmark{Name: "BenchmarkA/x", Package: "./", Module: "./",
+			Measurement: []common.Measurement{{N: 10, NsPerOp: 4, Tag: "v1"}}}
+
+		var wg sync.WaitGroup
+		RecordMeasurement(bench, 3, 1, 1, 1, 0, hostId, &wg)
+		RecordMeasurement(legacy, 3, 1, 1, 1, 0, 0, &wg)
+		CloseMeasurementQueue()
+		wg.Wait()
+
+		counts := []struct {
+			query string
+			want  int
+		}{
+			{`SELECT COUNT(*) FROM measurement WHERE bench_id = ? AND subpackage = './' AND p_name = 'proj' AND e_id IS NULL`, 4},
+			{`SELECT COUNT(*) FROM measurement WHERE bench_id = ? AND h_id IS NOT NULL AND cpu_set = '1' AND nice = -5 AND load_avg1 = 0.5`, 3},
+			{`SELECT COUNT(*) FROM measurement WHERE bench_id = ? AND h_id IS NULL AND load_avg1 IS NULL`, 1},
+			{`SELECT COUNT(*) FROM measurement WHERE bench_id = ? AND profiled`, 1},
+			{`SELECT COUNT(*) FROM profile WHERE bench_id = ? AND object_key = 'runner/profiles/cpu/a.out'`, 1},
+		}
+		for _, c := range counts {
+			var got int
+			if err := db.QueryRow(c.query, benchId).Scan(&got); err != nil {
+				t.Fatalf("%s: %v", c.query, err)
+			}
+			if got != c.want {
+				t.Errorf("%s = %d, want %d", c.query, got, c.want)
+			}
+		}
+	})
+}
+
+// TestDbQueueConsumerBatches checks that the consumer writes a batch once INGEST_BATCH_SIZE rows are pending, keeps
+// smaller batches until the queue is closed, and reuses its prepared statements across transactions.
+func TestDbQueueConsumerBatches(t *testing.T) {
+	openMigratedDB(t, "")
+	benchId, hostId := ingestBenchmark(t)
+	resetIngestStats(t)
+
+	queue := make(chan queueElem, INGEST_QUEUE_SIZE)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go dbQueueConsumer(queue, time.Hour, &wg)
+
+	queue <- queueElem{benchmark: measuredBenchmark(benchId, INGEST_BATCH_SIZE-1), hostId: hostId}
+	queue <- queueElem{benchmark: measuredBenchmark(benchId, 1), hostId: hostId}
+	waitForMeasurements(t, benchId, INGEST_BATCH_SIZE)
+
+	queue <- queueElem{benchmark: measuredBenchmark(benchId, 5), hostId: hostId}
+	queue <- queueElem{benchmark: measuredBenchmark(benchId, 2), hostId: hostId}
+	// the consumer took both benchmarks from the queue, they stay pending below the batch size
+	for len(queue) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := countMeasurements(t, benchId); got != INGEST_BATCH_SIZE {
+		t.Errorf("%d measurements written before closing the queue, want %d", got, INGEST_BATCH_SIZE)
+	}
+
+	close(queue)
+	wg.Wait()
+	if got := countMeasurements(t, benchId); got != INGEST_BATCH_SIZE+7 {
+		t.Errorf("%d measurements written after closing the queue, want %d", got, INGEST_BATCH_SIZE+7)
+	}
+	if ingestStats.Flushes != 2 || ingestStats.Rows != INGEST_BATCH_SIZE+7 {
+		t.Errorf("ingest stats %+v, want 2 flushes of %d rows", ingestStats, INGEST_BATCH_SIZE+7)
+	}
+}
+
+// TestDbQueueConsumerFlushInterval checks that pending rows are written after the flush interval while the queue
+// is open, and that intervals without rows do not commit empty transactions.
+func TestDbQueueConsumerFlushInterval(t *testing.T) {
+	openMigratedDB(t, "")
+	benchId, hostId := ingestBenchmark(t)
+	resetIngestStats(t)
+
+	queue := make(chan queueElem, INGEST_QUEUE_SIZE)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go dbQueueConsumer(queue, 20*time.Millisecond, &wg)
+
+	queue <- queueElem{benchmark: measuredBenchmark(benchId, 5), hostId: hostId}
+	waitForMeasurements(t, benchId, 5)
+	queue <- queueElem{benchmark: measuredBenchmark(benchId, 3), hostId: hostId}
+	waitForMeasurements(t, benchId, 8)
+	time.Sleep(100 * time.Millisecond)
+
+	close(queue)
+	wg.Wait()
+	if ingestStats.Flushes != 2 || ingestStats.Rows != 8 {
+		t.Errorf("ingest stats %+v, want 2 flushes of 8 rows", ingestStats)
+	}
+}
+
+// TestReadMeasurements sends measurements and the done signal the way runners do, and checks that all measurements
+// are written once the runner is done and the ingest is closed.
+func TestReadMeasurements(t *testing.T) {
+	openMigratedDB(t, "")
+	benchId, hostId := ingestBenchmark(t)
+
+	in, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	quit := make(chan bool, 1)
+	done := make(chan struct{})
+	go func() {
+		readMeasurementHandler(&in, quit)
+		close(done)
+	}()
+
+	send := func(benchmarks ...common.Benchmark) {
+		conn, err := net.Dial("tcp", in.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc := gob.NewEncoder(conn)
+		if err := enc.Encode(common.Registration{HostId: hostId, IrPos: 1}); err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range benchmarks {
+			if err := enc.Encode(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+		conn.Close()
+	}
+	wgIrResults.Add(1)
+	batches := 20
+	for i := 0; i < batches; i++ {
+		send(*measuredBenchmark(benchId, 100))
+	}
+	send(common.Benchmark{Name: "alldone"})
+
+	wgIrResults.Wait()
+	quit <- true
+	in.Close()
+	<-done
+	closeIngest()
+
+	if got := countMeasurements(t, benchId); got != batches*100 {
+		t.Errorf("%d measurements written, want %d", got, batches*100)
+	}
+}
+
+// ingestBenchmark inserts a project, a benchmark and a host to record measurements for.
+func ingestBenchmark(t *testing.T) (int64, int64) {
+	t.Helper()
+	insertProject("proj", "example.com/proj")
+	benchId, err := insertBenchmark("BenchmarkA", "./", "./", "proj", common.ParseBenchmarkName("BenchmarkA", 1), common.Annotations{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	currExperiment = runningExperiment{Project: "proj"}
+	t.Cleanup(func() { currExperiment = runningExperiment{} })
+	return benchId, insertHost(0, common.HostInfo{Hostname: "runner", Cores: 4})
+}
+
+// measuredBenchmark returns the benchmark with n measurements.
+func measuredBenchmark(benchId int64, n int) *common.Benchmark {
+	bench := &common.Benchmark{Id: benchId, Name: "BenchmarkA", Package: "./", Module: "./"}
+	for i := 0; i < n; i++ {
+		bench.Measurement = append(bench.Measurement, common.Measurement{N: 10, NsPerOp: float64(i + 1), Tag: "v1"})
+	}
+	return bench
+}
+
+// resetIngestStats clears the ingest metrics for the test.
+func resetIngestStats(t *testing.T) {
+	ingestStats = ingestMetrics{}
+	t.Cleanup(func() { ingestStats = ingestMetrics{} })
+}
+
+// waitForMeasurements waits until want measurements of the benchmark are written, and fails the test after a minute.
+func waitForMeasurements(t *testing.T, benchId int64, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Minute)
+	for {
+		got := countMeasurements(t, benchId)
+		if got >= want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d measurements written, want %d", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func countMeasurements(t *testing.T, benchId int64) int {
+	t.Helper()
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM measurement WHERE bench_id = ?`, benchId).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"io"
 	"net"
-	"strings"
 	"sync"
 
 	compute "cloud.google.com/go/compute/apiv1"
@@ -25,33 +24,49 @@ import (
 
 type (
 	configFile struct {
-		Name           string
-		Path           string
-		ProjUri        string
-		Tags           []string
-		Commands       []string
-		Envs           []string
-		Zone           string
-		Region         string
-		BasePackage    string
-		GCPProject     string
-		GCPBucket      string
-		GCPImage       string
-		GcpDiskSize    int
-		GcpMachineType string
-		GenPprof       bool
-		Bed            int
-		It             int
-		Sr             int
-		Ir             int
+		Name            string
+		Path            string
+		ProjUri         string
+		Tags            []string
+		Commands        []string
+		Envs            []string
+		Zone            string
+		Region          string
+		BasePackage     string
+		GCPProject      string
+		GCPBucket       string
+		GCPImage        string
+		GcpDiskSize     int
+		GcpMachineType  string
+		Discovery       string
+		Include         []string
+		Exclude         []string
+		Selection       string
+		PilotRuns       int
+		PilotMaxTime    string
+		PilotMaxCv      float64
+		PilotAction     string
+		GenPprof        bool
+		Profiles        []string
+		ProfileSampling float64
+		CpuSet          string
+		RunnerCpuSet    string
+		GoMaxProcs      int
+		Nice            int
+		Bed             int
+		It              int
+		Sr              int
+		Ir              int
 	}
 
 	cmdArgs struct {
 		CleanDB               bool
+		Rediscover            bool
 		RunLocal              bool
 		CredentialsFile       string
 		ConfigFile            string
-		SqliteFile            string
+		DbType                string
+		DbUri                 string
 		BenchRegex            string
 		InstanceName          string
 		Ip                    string
@@ -75,16 +90,19 @@ type (
 
 var wg sync.WaitGroup
 var wgIrResults sync.WaitGroup
+var wgProducers sync.WaitGroup
 var currSetup setup
 var currIrPos irPosCounter
 
 func parseArgs() cmdArgs {
 	var ca cmdArgs
 	flag.BoolVar(&(ca.CleanDB), "clean-db", false, "Clean database, i.e., drop all tables related to benchmark data collection.")
+	flag.BoolVar(&(ca.Rediscover), "rediscover", false, "Discover benchmarks again, even if cached results for the commits exist.")
 	flag.BoolVar(&(ca.RunLocal), "local", false, "Runs locally without creating instances, connecting to local runners.")
 	flag.StringVar(&(ca.CredentialsFile), "credentials", "creds.json", "Path to the credentials.json for GCP.")
 	flag.StringVar(&(ca.ConfigFile), "configFile", "configFile.toml", "Path to the configFile.toml file.")
-	flag.StringVar(&(ca.SqliteFile), "db", "database.db", "Path to the sqlite3 database file.")
+	flag.StringVar(&(ca.DbType), "db-type", DB_SQLITE, "Database backend, sqlite or postgres.")
+	flag.StringVar(&(ca.DbUri), "db", "database.db", "Path to the sqlite3 database file, or the connection string of the postgres database.")
 	flag.StringVar(&(ca.InstanceName), "instance-name", "orchestrator", "GCP instance name of the orchestrator, so that it does not shut itself down.")
 	flag.StringVar(&(ca.BenchRegex), "bench", ".", "Regex to restrict benchmarks to run, default is run all.")
 
@@ -112,6 +130,10 @@ func main() {
 	log.SetOutput(f)
 	log.SetLevel(log.DebugLevel)
 
+	if runSubcommand(os.Args[1:]) {
+		return
+	}
+
 	ca := parseArgs()
 
 	var cfg configFile
@@ -122,6 +144,10 @@ func main() {
 		panic(err)
 	}
 
+	if cfg.ProfileSampling <= 0 {
+		cfg.ProfileSampling = 1
+	}
+
 	log.Debugf("Finished reading %s", ca.ConfigFile)
 	log.Debugln(cfg)
 
@@ -129,32 +155,79 @@ func main() {
 	common.SetEnvironmentVariables(cfg.Envs)
 	common.RunCommands(cfg.Commands, cfg.Path)
 
-	// TODO: write to and read from DB
-	// --- Connect to DB (sqlite) ---
+	// --- Connect to DB ---
 	ConnectToDB(DbConfig{
-		Type: "sqlite",
-		Uri:  ca.SqliteFile,
+		Type: ca.DbType,
+		Uri:  ca.DbUri,
 	}, ca.CleanDB) // assigns the global variable db
 	defer CloseDB()
 	// --- Finish connect to DB ---
 
-	// TODO: read benchmarks from db, if no forced reread or db clean
+	err = startExperiment(&cfg, &ca) // assigns the global variable currExperiment
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	filter, err := newBenchmarkFilter(cfg.Include, cfg.Exclude)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// expand ranges and selectors into the revisions, which are labeled by cfg.Tags from here on
+	revisions, err := expandRevisions(cfg.Path, cfg.Tags)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for i, r := range revisions {
+		insertRevision(cfg.Name, i, r.Label, r.Commit, r.Selector)
+	}
+	cfg.Tags = revisionLabels(revisions)
+	log.Infof("Benchmarking %d revisions: %v", len(cfg.Tags), cfg.Tags)
+
 	log.Debugf("Begin collecting benchmarks of %s", cfg.Name)
-	benchmarks, err := CollectBenchmarks(cfg.Name, cfg.Path, cfg.BasePackage, cfg.Tags, ca.BenchRegex)
+	benchmarks, err := CollectBenchmarks(cfg.Name, cfg.Path, cfg.BasePackage, revisions, ca.BenchRegex, cfg.Discovery, filter, ca.Rediscover)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	log.Debugf("Finished collecting benchmarks of %s", cfg.Name)
-	log.Debugf("Found %d benchmarks: %+v", len(*benchmarks), *benchmarks)
+	switch cfg.Selection {
+	case SELECTION_CHANGED:
+		selected, err := selectChangedBenchmarks(cfg.Name, cfg.Path, revisions, *benchmarks)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		benchmarks = &selected
+	case SELECTION_ALL, "":
+	default:
+		log.Fatalf("Unknown selection mode %q", cfg.Selection)
+	}
+
+	isolation := common.Isolation{
+		CpuSet:       cfg.CpuSet,
+		RunnerCpuSet: cfg.RunnerCpuSet,
+		GoMaxProcs:   cfg.GoMaxProcs,
+		Nice:         cfg.Nice,
+	}
 
-	// Remove non performance benchmarks with Size or Memory in the name
-	for i := 0; i < len(*benchmarks); i++ {
-		if strings.Contains((*benchmarks)[i].Name, "BenchmarkSize") || strings.Contains((*benchmarks)[i].Name, "BenchmarkMemory") {
-			log.Info("Removing benchmark non perf benchmark: ", (*benchmarks)[i].Name)
-			*benchmarks = append((*benchmarks)[:i], (*benchmarks)[i+1:]...)
-			i--
+	if cfg.PilotRuns > 0 {
+		limits, err := newPilotLimits(cfg.PilotRuns, cfg.PilotMaxTime, cfg.PilotMaxCv, cfg.PilotAction)
+		if err != nil {
+			log.Fatalln(err)
 		}
+		// the pilot runs on this host, the runners validate the isolation on their instances themselves
+		pilotIsolation := isolation
+		pilotIsolation.Validate()
+		piloted, err := runPilot(cfg.Name, cfg.Path, revisions, *benchmarks, limits, &pilotIsolation, cfg.Bed, cfg.It, cfg.Sr)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		benchmarks = &piloted
+	}
+
+	log.Debugf("Finished collecting benchmarks of %s", cfg.Name)
+	log.Debugf("Found %d benchmarks: %+v", len(*benchmarks), *benchmarks)
+	for _, b := range *benchmarks {
+		insertExperimentBenchmark(b.Name, b.ProjectPackage(), cfg.Name)
 	}
 
 	/********** Start server endpoints ************/
@@ -206,6 +279,7 @@ func main() {
 	script := generateStartupScript(
 		cfg.ProjUri,
 		cfg.Tags,
+		revisionCommits(revisions),
 		cfg.BasePackage,
 		currSetup.Bed,
 		currSetup.Iterations,
@@ -216,8 +290,11 @@ func main() {
 		cfg.GCPProject,
 		cfg.GCPBucket,
 		cfg.GenPprof,
+		cfg.Profiles,
+		cfg.ProfileSampling,
 		cfg.Envs,
 		cfg.Commands,
+		isolation,
 	)
 	instances := currSetup.Ir
 
@@ -262,11 +339,8 @@ func main() {
 		wgIrResults.Add(1)
 	}
 
-	// wait for results
+	// wait for results, runners upload their log files before they send the done signal
 	wgIrResults.Wait()
-
-	// Wait 10 seconds for logfiles to be uploaded to bucket then shutdown instances
-	time.Sleep(10 * time.Second)
 	common.ShutdownAllInstances(&listOfInstances, cfg.GCPProject, cfg.Zone, gclientCompute, ctx)
 
 	// END EXPERIMENT
@@ -284,10 +358,10 @@ func main() {
 	quitRecv <- true
 	inSend.Close()
 	inRecv.Close()
-	CloseMeasurementQueue()
-	wg.Wait()
+	closeIngest()
 	close(quitSend)
 	close(quitRecv)
+	finishExperiment(EXPERIMENT_FINISHED)
 	log.Debugln("Finished experiment")
 }
 
@@ -295,7 +369,19 @@ func sendBenchmarks(benchmarks *[]common.Benchmark, conn net.Conn) {
 	// TODO should be ok without wait group
 	wg.Add(1)
 	defer wg.Done()
+
+	// runners register with their host fingerprint first
+	var host common.HostInfo
+	err := gob.NewDecoder(conn).Decode(&host)
+	if err != nil {
+		log.Errorf("Could not read registration of runner: %v", err)
+		conn.Close()
+		return
+	}
+	registration := registerHost(host)
+
 	encoder := gob.NewEncoder(conn)
+	encoder.Encode(registration)
 	N := len(*benchmarks)
 	log.Debugln("Sending benchmarks to instance")
 	for i := 0; i < N; i++ {
@@ -305,6 +391,18 @@ func sendBenchmarks(benchmarks *[]common.Benchmark, conn net.Conn) {
 	log.Debugln("Finished sending benchmarks")
 }
 
+// registerHost stores the fingerprint of a runner's host, and assigns the runner the next instance run position.
+func registerHost(host common.HostInfo) common.Registration {
+	currIrPos.Mu.Lock()
+	currIrPos.IrPos = currIrPos.IrPos + 1
+	irPos := currIrPos.IrPos
+	currIrPos.Mu.Unlock()
+
+	hostId := insertHost(irPos, host)
+	log.Infof("Registered runner %s as host %d (%s, %d cores, %s) with ir_pos %d", host.Hostname, hostId, host.CpuModel, host.Cores, host.MachineType, irPos)
+	return common.Registration{HostId: hostId, IrPos: irPos}
+}
+
 func sendBenchmarkHandler(benchmarks *[]common.Benchmark, in *net.Listener, quit <-chan bool) {
 Loop:
 	for {
@@ -327,6 +425,13 @@ func readMeasurements(conn net.Conn) {
 
 	dec := gob.NewDecoder(conn)
 	log.Debugln("Receiving measurements from instance")
+	// every batch starts with the registration of the runner
+	var registration common.Registration
+	err := dec.Decode(&registration)
+	if err != nil {
+		log.Errorf("Could not read registration of measurements: %v", err)
+		return
+	}
 	for {
 		var b common.Benchmark
 		err := dec.Decode(&b)
@@ -340,7 +445,8 @@ func readMeasurements(conn net.Conn) {
 
 		if b.Name == "alldone" {
 			log.Debugln("Received all done")
-			wgIrResults.Done()
+			// the runner is done once the measurements received with the signal are queued
+			defer wgIrResults.Done()
 			break
 		}
 
@@ -355,13 +461,9 @@ func readMeasurements(conn net.Conn) {
 	srSetup := currSetup.Sr
 	irSetup := currSetup.Ir
 	currSetup.Mu.Unlock()
-	currIrPos.Mu.Lock()
-	currIrPos.IrPos = currIrPos.IrPos + 1
-	irPos := currIrPos.IrPos
-	currIrPos.Mu.Unlock()
 
 	for i := 0; i < len(benchmarks); i++ {
-		RecordMeasurement(&benchmarks[i], bedSetup, itSetup, srSetup, irSetup, irPos, &wg)
+		RecordMeasurement(&benchmarks[i], bedSetup, itSetup, srSetup, irSetup, registration.IrPos, registration.HostId, &wg)
 	}
 	log.Debugln("Finished adding measurements into queue")
 }
@@ -378,7 +480,20 @@ Loop:
 				log.Errorln(err)
 				continue
 			}
-			go readMeasurements(conn)
+			// added before the next connection is accepted, a done signal always follows the measurements of the runner
+			wgProducers.Add(1)
+			go func() {
+				defer wgProducers.Done()
+				readMeasurements(conn)
+			}()
 		}
 	}
 }
+
+// closeIngest waits until the connections which are still receiving measurements queued them, then closes the queue
+// and waits until the consumer wrote all queued measurements.
+func closeIngest() {
+	wgProducers.Wait()
+	CloseMeasurementQueue()
+	wg.Wait()
+}
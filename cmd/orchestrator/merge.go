@@ -0,0 +1,619 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ORIGIN_MERGE is the origin of experiments created for rows of merged databases recorded before experiments existed
+const ORIGIN_MERGE = "merge"
+
+type (
+	// mergeTable describes how the rows of a table are copied into the target database.
+	mergeTable struct {
+		Name   string
+		Key    string            // auto-increment ID, assigned anew in the target, empty if the table has none
+		Unique []string          // natural key, rows already in the target are compared instead of copied
+		Refs   map[string]string // columns referencing the ID of another table, remapped to the IDs in the target
+		Ignore []string          // columns not compared with existing rows, e.g., timestamps
+	}
+
+	// merger copies one source database into the target within a transaction.
+	merger struct {
+		source  *sql.DB
+		tx      *dbTx
+		ids     map[string]map[int64]int64 // table -> source ID -> target ID
+		skipped map[int64]bool             // source experiments already in the target
+		report  mergeReport
+	}
+
+	// mergeReport summarizes the merge of one source database.
+	mergeReport struct {
+		Copied     map[string]int
+		Duplicates []string
+		Conflicts  []string
+	}
+)
+
+// mergeTables are copied in this order, referenced tables come first. Experiments are copied before the
+// tables referencing them, see copyExperiments.
+var mergeTables = []mergeTable{
+	{Name: "project", Unique: []string{"p_name"}},
+	{Name: "benchmark", Key: "bench_id", Unique: []string{"b_name", "subpackage", "p_name"}},
+	{Name: "benchmark_tag", Unique: []string{"bench_id", "tag"}, Refs: map[string]string{"bench_id": "benchmark"}},
+	{Name: "discovery_cache", Unique: []string{"p_name", "commit_sha", "discovery_key"}, Ignore: []string{"discovered_at"}},
+	{Name: "experiment_benchmark", Unique: []string{"e_id", "b_name", "subpackage", "p_name"}, Refs: map[string]string{"e_id": "experiment"}},
+	{Name: "revision", Refs: map[string]string{"e_id": "experiment"}},
+	{Name: "benchmark_exclusion", Refs: map[string]string{"e_id": "experiment"}},
+	{Name: "benchmark_selection", Refs: map[string]string{"e_id": "experiment"}},
+	{Name: "pilot", Refs: map[string]string{"e_id": "experiment"}},
+	{Name: "host", Key: "h_id", Refs: map[string]string{"e_id": "experiment"}},
+	{Name: "measurement", Key: "m_id", Refs: map[string]string{"e_id": "experiment", "bench_id": "benchmark", "h_id": "host"}},
+	{Name: "profile", Key: "pr_id", Refs: map[string]string{"e_id": "experiment", "bench_id": "benchmark"}},
+	{Name: "optimization", Key: "o_id", Refs: map[string]string{"e_id": "experiment"}},
+	{Name: "optimization_benchmark", Refs: map[string]string{"o_id": "optimization", "e_id": "experiment", "bench_id": "benchmark"}},
+}
+
+// dbSubcommands are the subcommands of db, which maintain result databases.
+var dbSubcommands = map[string]func(args []string){
+	"merge": mergeCommand,
+}
+
+// dbCommand runs the db subcommand named by the first argument.
+func dbCommand(args []string) {
+	if len(args) == 0 {
+		fatalf("usage: db merge [flags] source.db...")
+	}
+	command, ok := dbSubcommands[args[0]]
+	if !ok {
+		fatalf("unknown db subcommand %q", args[0])
+	}
+	command(args[1:])
+}
+
+// mergeCommand copies SQLite result databases into the target database. Sources are migrated to the latest schema
+// on a temporary copy, so any version can be merged. IDs are remapped, experiments already in the target are skipped,
+// and differing rows of projects, benchmarks and discovery results are reported as conflicts, keeping the target.
+func mergeCommand(args []string) {
+	fs := flag.NewFlagSet("db merge", flag.ExitOnError)
+	dbConfig := dbFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "Only report what would be merged, the target is not changed.")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fatalf("usage: db merge [flags] source.db...")
+	}
+
+	openDB(dbConfig)
+	defer CloseDB()
+	if *dryRun {
+		requireLatestSchema()
+	} else if err := migrateDB(0); err != nil {
+		fatalf("%v", err)
+	}
+
+	targetPath, _ := filepath.Abs(dbConfig.Uri)
+	for _, sourcePath := range fs.Args() {
+		if abs, _ := filepath.Abs(sourcePath); dbConfig.Type != DB_POSTGRES && abs == targetPath {
+			fatalf("%s: cannot merge the target into itself", sourcePath)
+		}
+		report, err := mergeDatabase(sourcePath, *dryRun)
+		if err != nil {
+			fatalf("%s: %v", sourcePath, err)
+		}
+		printMergeReport(sourcePath, report, *dryRun)
+	}
+}
+
+// mergeDatabase merges one source database into the target in a single transaction, which is rolled back on a dry run.
+func mergeDatabase(sourcePath string, dryRun bool) (*mergeReport, error) {
+	source, cleanup, err := openMigratedCopy(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // no-op after commit
+
+	m := merger{
+		source:  source,
+		tx:      tx,
+		ids:     make(map[string]map[int64]int64),
+		skipped: make(map[int64]bool),
+		report:  mergeReport{Copied: make(map[string]int)},
+	}
+	// projects and benchmarks are referenced by experiments and their rows
+	if err := m.copyTable(mergeTables[0]); err != nil {
+		return nil, err
+	}
+	if err := m.copyTable(mergeTables[1]); err != nil {
+		return nil, err
+	}
+	if err := m.copyExperiments(); err != nil {
+		return nil, err
+	}
+	for _, table := range mergeTables[2:] {
+		if err := m.copyTable(table); err != nil {
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		return &m.report, nil
+	}
+	return &m.report, tx.Commit()
+}
+
+// openMigratedCopy copies the source database into a temporary file, migrates it to the latest schema and
+// returns the connection to the copy. Rows recorded before experiments existed are assigned to an experiment
+// of origin merge, identified by the SHA-256 of the source file.
+func openMigratedCopy(sourcePath string) (*sql.DB, func(), error) {
+	content, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(content)
+
+	dir, err := os.MkdirTemp("", "cbt-merge")
+	if err != nil {
+		return nil, nil, err
+	}
+	copyPath := filepath.Join(dir, "source.db")
+
+	// VACUUM INTO takes a consistent snapshot, also of databases an orchestrator is writing to
+	original, err := sql.Open("sqlite", "file:"+sourcePath+"?mode=ro")
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	_, err = original.Exec(`VACUUM INTO ?`, copyPath)
+	original.Close()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, errors.Wrap(err, "copying source database")
+	}
+
+	conn, err := sqliteBackend{}.Open(copyPath)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	cleanup := func() {
+		conn.Close()
+		os.RemoveAll(dir)
+	}
+
+	// the migrations run on the global connection
+	target := db
+	db = &database{DB: conn, backend: sqliteBackend{}}
+	err = migrateDB(0)
+	if err == nil {
+		abs, _ := filepath.Abs(sourcePath)
+		err = assignLegacyExperiment(abs, hex.EncodeToString(sum[:]))
+	}
+	db = target
+	if err != nil {
+		cleanup()
+		return nil, nil, errors.Wrap(err, "migrating copy of source database")
+	}
+	return conn, cleanup, nil
+}
+
+// assignLegacyExperiment creates an experiment for the rows of the database without one, if there are any.
+func assignLegacyExperiment(source string, checksum string) error {
+	var legacyRows int
+	for _, table := range mergeTables {
+		if _, found := table.Refs["e_id"]; !found || table.Name == "experiment_benchmark" {
+			continue
+		}
+		var count int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table.Name + ` WHERE e_id IS NULL`).Scan(&count); err != nil {
+			return err
+		}
+		legacyRows += count
+	}
+	if legacyRows == 0 {
+		return nil
+	}
+
+	var eId int64
+	err := db.QueryRow(`INSERT INTO experiment(p_name, status, config, args, orchestrator_version, runner_version,
+			bed_setup, it_setup, sr_setup, ir_setup, origin, source, source_sha256)
+		SELECT COALESCE((SELECT MIN(p_name) FROM project), ''), ?, '', '', '', '',
+			COALESCE(MAX(bed_setup), 0), COALESCE(MAX(it_setup), 0), COALESCE(MAX(sr_setup), 0), COALESCE(MAX(ir_setup), 0), ?, ?, ?
+		FROM measurement WHERE e_id IS NULL RETURNING e_id`,
+		EXPERIMENT_FINISHED, ORIGIN_MERGE, source, checksum).Scan(&eId)
+	if err != nil {
+		return err
+	}
+	for _, table := range mergeTables {
+		if _, found := table.Refs["e_id"]; !found || table.Name == "experiment_benchmark" {
+			continue
+		}
+		if _, err := db.Exec(`UPDATE `+table.Name+` SET e_id = ? WHERE e_id IS NULL`, eId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyExperiments copies the experiments of the source. An experiment is already in the target if an experiment with
+// the same fingerprint has as many measurements, its rows are skipped. A fingerprint match with a different number
+// of measurements is reported as conflict and copied as a new experiment.
+// Imported and merged experiments are fingerprinted by origin and checksum of their source file, all others by
+// project, start time, config, arguments and orchestrator version.
+func (m *merger) copyExperiments() error {
+	m.ids["experiment"] = make(map[int64]int64)
+	rows, err := m.source.Query(`SELECT * FROM experiment ORDER BY e_id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	insert, err := m.prepareInsert("experiment", "e_id", columns)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	for rows.Next() {
+		values, err := scanRow(rows, len(columns))
+		if err != nil {
+			return err
+		}
+		row := rowMap(columns, values)
+		sourceId := row["e_id"].(int64)
+
+		var sourceCount int
+		if err := m.source.QueryRow(`SELECT COUNT(*) FROM measurement WHERE e_id = ?`, sourceId).Scan(&sourceCount); err != nil {
+			return err
+		}
+		candidates, err := m.matchingExperiments(row)
+		if err != nil {
+			return err
+		}
+		duplicate := int64(0)
+		for _, candidate := range candidates {
+			var count int
+			if err := m.tx.QueryRow(`SELECT COUNT(*) FROM measurement WHERE e_id = ?`, candidate).Scan(&count); err != nil {
+				return err
+			}
+			if count == sourceCount {
+				duplicate = candidate
+				break
+			}
+		}
+
+		label := describeExperiment(row)
+		if duplicate != 0 {
+			m.ids["experiment"][sourceId] = duplicate
+			m.skipped[sourceId] = true
+			m.report.Duplicates = append(m.report.Duplicates,
+				fmt.Sprintf("experiment %d (%s) is experiment %d of the target, skipped", sourceId, label, duplicate))
+			continue
+		}
+		if len(candidates) > 0 {
+			m.report.Conflicts = append(m.report.Conflicts,
+				fmt.Sprintf("experiment %d (%s) matches experiment %v of the target, but has %d measurements, copied as new experiment",
+					sourceId, label, candidates, sourceCount))
+		}
+
+		targetId, err := m.insertRow(insert, "experiment", "e_id", columns, values)
+		if err != nil {
+			return err
+		}
+		m.ids["experiment"][sourceId] = targetId
+		m.report.Copied["experiment"]++
+	}
+	return rows.Err()
+}
+
+// matchingExperiments returns the IDs of the target experiments with the fingerprint of the source experiment.
+func (m *merger) matchingExperiments(row map[string]any) ([]int64, error) {
+	var ids []int64
+	if checksum, _ := row["source_sha256"].(string); checksum != "" {
+		rows, err := m.tx.Query(`SELECT e_id FROM experiment WHERE origin = ? AND source_sha256 = ?`, row["origin"], checksum)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		return ids, rows.Err()
+	}
+
+	// start times are compared as values, the backends store them in different text formats
+	rows, err := m.tx.Query(`SELECT e_id, started_at FROM experiment WHERE origin = ? AND p_name = ? AND config = ? AND args = ? AND orchestrator_version = ?`,
+		row["origin"], row["p_name"], row["config"], row["args"], row["orchestrator_version"])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var startedAt any
+		if err := rows.Scan(&id, &startedAt); err != nil {
+			return nil, err
+		}
+		if sameValue(startedAt, row["started_at"]) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
+// copyTable copies the rows of the table, skipping rows of experiments already in the target.
+func (m *merger) copyTable(table mergeTable) error {
+	if table.Key != "" {
+		m.ids[table.Name] = make(map[int64]int64)
+	}
+	rows, err := m.source.Query(`SELECT * FROM ` + table.Name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	insert, err := m.prepareInsert(table.Name, table.Key, columns)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	var lookup *sql.Stmt
+	if len(table.Unique) > 0 {
+		lookup, err = m.prepareLookup(table, columns)
+		if err != nil {
+			return err
+		}
+		defer lookup.Close()
+	}
+
+	for rows.Next() {
+		values, err := scanRow(rows, len(columns))
+		if err != nil {
+			return err
+		}
+		row := rowMap(columns, values)
+		if eId, ok := row["e_id"].(int64); ok && m.skipped[eId] {
+			continue
+		}
+
+		for i, column := range columns {
+			if referenced, found := table.Refs[column]; found {
+				values[i] = m.remap(referenced, values[i])
+			}
+		}
+		var sourceId int64
+		if table.Key != "" {
+			sourceId, _ = row[table.Key].(int64)
+		}
+
+		if lookup != nil {
+			targetId, found, err := m.compareExisting(lookup, table, columns, values)
+			if err != nil {
+				return err
+			}
+			if found {
+				if table.Key != "" {
+					m.ids[table.Name][sourceId] = targetId
+				}
+				continue
+			}
+		}
+
+		targetId, err := m.insertRow(insert, table.Name, table.Key, columns, values)
+		if err != nil {
+			return err
+		}
+		if table.Key != "" {
+			m.ids[table.Name][sourceId] = targetId
+		}
+		m.report.Copied[table.Name]++
+	}
+	return rows.Err()
+}
+
+// prepareInsert prepares the insert of all columns but the key, which is returned instead.
+func (m *merger) prepareInsert(table string, key string, columns []string) (*sql.Stmt, error) {
+	var names []string
+	for _, column := range columns {
+		if column != key {
+			names = append(names, column)
+		}
+	}
+	query := `INSERT INTO ` + table + `(` + strings.Join(names, ", ") + `) VALUES (` + placeholders(len(names)) + `)`
+	if key != "" {
+		query += ` RETURNING ` + key
+	}
+	return m.tx.Prepare(query)
+}
+
+// insertRow inserts the row without its key, and returns the key assigned in the target.
+func (m *merger) insertRow(insert *sql.Stmt, table string, key string, columns []string, values []any) (int64, error) {
+	var args []any
+	for i, column := range columns {
+		if column != key {
+			args = append(args, storedValue(values[i]))
+		}
+	}
+	if key == "" {
+		_, err := insert.Exec(args...)
+		return 0, errors.Wrapf(err, "inserting into %s", table)
+	}
+	var id int64
+	err := insert.QueryRow(args...).Scan(&id)
+	return id, errors.Wrapf(err, "inserting into %s", table)
+}
+
+// prepareLookup prepares the query of the row with the natural key of the table, selecting the key and all columns.
+func (m *merger) prepareLookup(table mergeTable, columns []string) (*sql.Stmt, error) {
+	conditions := make([]string, len(table.Unique))
+	for i, column := range table.Unique {
+		conditions[i] = column + ` = ?`
+	}
+	return m.tx.Prepare(`SELECT ` + strings.Join(columns, ", ") + ` FROM ` + table.Name + ` WHERE ` + strings.Join(conditions, " AND "))
+}
+
+// compareExisting looks up the row by its natural key in the target, and reports columns which differ as conflict.
+func (m *merger) compareExisting(lookup *sql.Stmt, table mergeTable, columns []string, values []any) (int64, bool, error) {
+	row := rowMap(columns, values)
+	args := make([]any, len(table.Unique))
+	for i, column := range table.Unique {
+		args[i] = row[column]
+	}
+	rows, err := lookup.Query(args...)
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return 0, false, rows.Err()
+	}
+	existing, err := scanRow(rows, len(columns))
+	if err != nil {
+		return 0, false, err
+	}
+
+	var targetId int64
+	for i, column := range columns {
+		switch {
+		case column == table.Key:
+			targetId, _ = existing[i].(int64)
+		case containsString(table.Unique, column), containsString(table.Ignore, column):
+		case !sameValue(existing[i], values[i]):
+			keyValues := make([]string, len(table.Unique))
+			for j, column := range table.Unique {
+				keyValues[j] = fmt.Sprint(row[column])
+			}
+			m.report.Conflicts = append(m.report.Conflicts, fmt.Sprintf("%s (%s): %s is %v in the target and %v in the source, target kept",
+				table.Name, strings.Join(keyValues, ", "), column, existing[i], values[i]))
+		}
+	}
+	return targetId, true, nil
+}
+
+// remap returns the target ID of a referenced row, NULL if the source references a row it does not contain.
+func (m *merger) remap(table string, value any) any {
+	id, ok := value.(int64)
+	if !ok {
+		return nil
+	}
+	if targetId, found := m.ids[table][id]; found {
+		return targetId
+	}
+	log.Debugf("Dangling reference to %s %d", table, id)
+	return nil
+}
+
+// scanRow scans a row of unknown columns.
+func scanRow(rows *sql.Rows, n int) ([]any, error) {
+	values := make([]any, n)
+	targets := make([]any, n)
+	for i := range values {
+		targets[i] = &values[i]
+	}
+	return values, rows.Scan(targets...)
+}
+
+// rowMap returns the values of a row by column name.
+func rowMap(columns []string, values []any) map[string]any {
+	row := make(map[string]any, len(columns))
+	for i, column := range columns {
+		row[column] = values[i]
+	}
+	return row
+}
+
+// sameValue compares column values read from different backends, which return booleans, text and times differently.
+func sameValue(a any, b any) bool {
+	a, b = normalizeValue(a), normalizeValue(b)
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		return ok && at.Equal(bt)
+	}
+	return a == b
+}
+
+// normalizeValue converts a scanned value into the type SQLite returns for it.
+func normalizeValue(value any) any {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case int:
+		return int64(v)
+	}
+	return value
+}
+
+// storedValue converts times into the format of CURRENT_TIMESTAMP for SQLite, which stores them as text.
+func storedValue(value any) any {
+	if t, ok := value.(time.Time); ok {
+		if _, sqlite := db.backend.(sqliteBackend); sqlite {
+			return t.UTC().Format("2006-01-02 15:04:05.999999999")
+		}
+	}
+	return value
+}
+
+// describeExperiment returns a short description of an experiment for the report.
+func describeExperiment(row map[string]any) string {
+	if source, _ := row["source"].(string); source != "" {
+		return fmt.Sprintf("%v, %v from %s", row["p_name"], row["origin"], source)
+	}
+	return fmt.Sprintf("%v, started %v", row["p_name"], row["started_at"])
+}
+
+// printMergeReport prints the copied rows, skipped experiments and conflicts of a source.
+func printMergeReport(sourcePath string, report *mergeReport, dryRun bool) {
+	verb := "merged"
+	if dryRun {
+		verb = "would merge"
+	}
+	var counts []string
+	for _, table := range append([]mergeTable{{Name: "experiment"}}, mergeTables...) {
+		if n := report.Copied[table.Name]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, table.Name))
+		}
+	}
+	if len(counts) == 0 {
+		counts = append(counts, "nothing")
+	}
+	fmt.Printf("%s %s: %s\n", verb, sourcePath, strings.Join(counts, ", "))
+	for _, duplicate := range report.Duplicates {
+		fmt.Printf("  duplicate: %s\n", duplicate)
+	}
+	for _, conflict := range report.Conflicts {
+		fmt.Printf("  conflict: %s\n", conflict)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mergeFixtureA holds an experiment with measurements of BenchmarkA and BenchmarkB on one host.
+var mergeFixtureA = []string{
+	`INSERT INTO project(p_name, base_package) VALUES ('zap', 'go.uber.org/zap')`,
+	`INSERT INTO benchmark(b_name, subpackage, p_name, function, params, procs) VALUES ('BenchmarkA', './', 'zap', 'BenchmarkA', '{}', 1)`,
+	`INSERT INTO benchmark(b_name, subpackage, p_name, function, params, procs) VALUES ('BenchmarkB', './', 'zap', 'BenchmarkB', '{}', 1)`,
+	`INSERT INTO experiment(p_name, status, started_at, config, args, orchestrator_version, runner_version, bed_setup, it_setup, sr_setup, ir_setup)
+		VALUES ('zap', 'finished', '2024-01-02 10:00:00', 'config a', '{}', 'v1', 'v1', 1, 1, 1, 1)`,
+	`INSERT INTO host(e_id, ir_pos, hostname, cpu_model, cpu_flags, microcode, cores, mem_total_kb, kernel, clocksource, go_version, go_env, machine_type, zone, instance_id)
+		VALUES (1, 1, 'runner-a', 'cpu', '', '', 4, 0, '', '', '', '', '', '', '')`,
+	mergeMeasurement("BenchmarkA", "1", "1", "1"),
+	mergeMeasurement("BenchmarkB", "2", "1", "1"),
+	mergeMeasurement("BenchmarkB", "2", "1", "1"),
+}
+
+// mergeFixtureB holds an experiment with measurements of BenchmarkB and BenchmarkC, and a measurement recorded
+// before experiments existed. Its benchmark IDs differ from the ones of mergeFixtureA, and BenchmarkB has a
+// different function.
+var mergeFixtureB = []string{
+	`INSERT INTO project(p_name, base_package) VALUES ('zap', 'go.uber.org/zap')`,
+	`INSERT INTO benchmark(b_name, subpackage, p_name, function, params, procs) VALUES ('BenchmarkB', './', 'zap', 'BenchmarkRenamed', '{}', 1)`,
+	`INSERT INTO benchmark(b_name, subpackage, p_name, function, params, procs) VALUES ('BenchmarkC', './', 'zap', 'BenchmarkC', '{}', 1)`,
+	`INSERT INTO experiment(p_name, status, started_at, config, args, orchestrator_version, runner_version, bed_setup, it_setup, sr_setup, ir_setup)
+		VALUES ('zap', 'finished', '2024-02-01 10:00:00', 'config b', '{}', 'v1', 'v1', 1, 1, 1, 1)`,
+	mergeMeasurement("BenchmarkB", "1", "1", "NULL"),
+	mergeMeasurement("BenchmarkC", "2", "1", "NULL"),
+	mergeMeasurement("BenchmarkB", "1", "NULL", "NULL"),
+}
+
+// TestMergeDatabase merges two fixture databases into an empty target, and merges them again.
+func TestMergeDatabase(t *testing.T) {
+	forEachBackend(t, func(t *testing.T) {
+		sourceA := mergeFixture(t, "a.db", mergeFixtureA)
+		sourceB := mergeFixture(t, "b.db", mergeFixtureB)
+		// the experiment of a with another number of measurements
+		sourceC := mergeFixture(t, "c.db", append(mergeFixtureA, mergeMeasurement("BenchmarkA", "1", "1", "1")))
+		if err := migrateDB(0); err != nil {
+			t.Fatal(err)
+		}
+
+		// a dry run reports the rows, but leaves the target unchanged
+		report := mergeTestDatabase(t, sourceA, true)
+		if want := map[string]int{"project": 1, "benchmark": 2, "experiment": 1, "host": 1, "measurement": 3}; !reflect.DeepEqual(report.Copied, want) {
+			t.Errorf("dry run copied %v, want %v", report.Copied, want)
+		}
+		expectMergeCounts(t, "after the dry run", 0, 0, 0)
+
+		report = mergeTestDatabase(t, sourceA, false)
+		if len(report.Duplicates) != 0 || len(report.Conflicts) != 0 {
+			t.Errorf("merging a reported duplicates %v and conflicts %v", report.Duplicates, report.Conflicts)
+		}
+		report = mergeTestDatabase(t, sourceB, false)
+		if want := map[string]int{"benchmark": 1, "experiment": 2, "measurement": 3}; !reflect.DeepEqual(report.Copied, want) {
+			t.Errorf("merging b copied %v, want %v", report.Copied, want)
+		}
+		if len(report.Conflicts) != 1 || !strings.Contains(report.Conflicts[0], "function is BenchmarkB in the target and BenchmarkRenamed in the source") {
+			t.Errorf("merging b reported conflicts %v, want the function of BenchmarkB", report.Conflicts)
+		}
+		expectMergeCounts(t, "after merging a and b", 3, 6, 3)
+
+		// IDs are remapped, every measurement references the benchmark of its name and an experiment of the target
+		var remapped int
+		err := db.QueryRow(`SELECT COUNT(*) FROM measurement m
+			JOIN benchmark b ON b.bench_id = m.bench_id AND b.b_name = m.b_name
+			JOIN experiment e ON e.e_id = m.e_id`).Scan(&remapped)
+		if err != nil || remapped != 6 {
+			t.Errorf("%d measurements reference their benchmark and experiment (%v), want 6", remapped, err)
+		}
+		var hostMeasurements int
+		err = db.QueryRow(`SELECT COUNT(*) FROM measurement m JOIN host h ON h.h_id = m.h_id AND h.e_id = m.e_id WHERE h.hostname = 'runner-a'`).Scan(&hostMeasurements)
+		if err != nil || hostMeasurements != 3 {
+			t.Errorf("%d measurements reference host runner-a (%v), want 3", hostMeasurements, err)
+		}
+
+		// the legacy row of b is assigned to an experiment of origin merge, identified by the checksum of b
+		content, err := os.ReadFile(sourceB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(content)
+		abs, _ := filepath.Abs(sourceB)
+		var legacy int
+		err = db.QueryRow(`SELECT COUNT(*) FROM measurement m JOIN experiment e ON e.e_id = m.e_id
+			WHERE e.origin = ? AND e.source = ? AND e.source_sha256 = ? AND e.p_name = 'zap'`,
+			ORIGIN_MERGE, abs, hex.EncodeToString(sum[:])).Scan(&legacy)
+		if err != nil || legacy != 1 {
+			t.Errorf("%d measurements in the experiment of the legacy rows (%v), want 1", legacy, err)
+		}
+
+		// merging the same sources again only finds duplicates
+		for source, duplicates := range map[string]int{sourceA: 1, sourceB: 2} {
+			report = mergeTestDatabase(t, source, false)
+			if len(report.Copied) != 0 || len(report.Duplicates) != duplicates {
+				t.Errorf("merging %s again copied %v with duplicates %v, want %d duplicates", filepath.Base(source), report.Copied, report.Duplicates, duplicates)
+			}
+		}
+		expectMergeCounts(t, "after merging again", 3, 6, 3)
+
+		// an experiment with the fingerprint of a but more measurements is a conflict, and copied as new experiment
+		report = mergeTestDatabase(t, sourceC, false)
+		if report.Copied["experiment"] != 1 || report.Copied["measurement"] != 4 || len(report.Conflicts) != 1 ||
+			!strings.Contains(report.Conflicts[0], "has 4 measurements") {
+			t.Errorf("merging c copied %v with conflicts %v, want a new experiment of 4 measurements", report.Copied, report.Conflicts)
+		}
+		expectMergeCounts(t, "after merging c", 4, 10, 3)
+	})
+}
+
+// mergeFixture creates the SQLite database name with the latest schema and the rows of the statements.
+func mergeFixture(t *testing.T, name string, statements []string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	conn, err := sqliteBackend{}.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	target := db
+	db = &database{DB: conn, backend: sqliteBackend{}}
+	defer func() { db = target }()
+	if err := migrateDB(0); err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+	return path
+}
+
+// mergeMeasurement returns the insert of a measurement of the benchmark, the IDs are SQL literals.
+func mergeMeasurement(name string, benchId string, eId string, hId string) string {
+	return `INSERT INTO measurement(n, ns_per_op, bed_setup, it_setup, sr_setup, ir_setup, bed_pos, it_pos, sr_pos, ir_pos, b_name, subpackage, p_name, bench_id, e_id, h_id)
+		VALUES (1000, 706.0, 1, 1, 1, 1, 1, 1, 1, 1, '` + name + `', './', 'zap', ` + benchId + `, ` + eId + `, ` + hId + `)`
+}
+
+func mergeTestDatabase(t *testing.T, source string, dryRun bool) *mergeReport {
+	t.Helper()
+	report, err := mergeDatabase(source, dryRun)
+	if err != nil {
+		t.Fatalf("merging %s: %v", filepath.Base(source), err)
+	}
+	return report
+}
+
+// expectMergeCounts checks the number of experiments, measurements and benchmarks in the target.
+func expectMergeCounts(t *testing.T, when string, experiments int, measurements int, benchmarks int) {
+	t.Helper()
+	for table, want := range map[string]int{"experiment": experiments, "measurement": measurements, "benchmark": benchmarks} {
+		var got int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: %d rows in %s, want %d", when, got, table, want)
+		}
+	}
+}
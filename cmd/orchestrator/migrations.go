@@ -0,0 +1,542 @@
+package main
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// migration is a numbered schema change. Statements run first, then missing columns are added, so that
+	// databases created before versioned migrations, whose tables exist in any intermediate shape, can be adopted.
+	// Required columns are added before the statements, for statements reading columns such databases may lack.
+	// Data statements run last, e.g., to backfill the added columns.
+	// Every migration is applied in a transaction together with its schema_version entry.
+	migration struct {
+		Version     int
+		Description string
+		Required    []columnDef
+		Statements  []string
+		Columns     []columnDef
+		Data        []string
+	}
+
+	// columnDef is a column added by ALTER TABLE if the table does not have it yet.
+	columnDef struct {
+		Table      string
+		Name       string
+		Definition string
+	}
+
+	// appliedMigration is an entry of the schema_version table.
+	appliedMigration struct {
+		Version     int
+		Description string
+		AppliedAt   string
+	}
+)
+
+// schemaTables lists all tables of the schema, which are dropped by -clean-db.
+var schemaTables = []string{
+	"project", "benchmark", "benchmark_tag", "benchmark_exclusion", "discovery_cache",
+	"benchmark_selection", "pilot", "revision", "measurement", "profile", "host", "optimization_benchmark", "optimization",
+	"experiment_benchmark", "experiment",
+}
+
+// migrations are applied in order, never change a released migration, add a new one instead.
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "initial schema",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS project (
+				"p_name" TEXT NOT NULL PRIMARY KEY,
+				"base_package" TEXT NOT NULL
+			  );`,
+			`CREATE TABLE IF NOT EXISTS benchmark (
+				"b_name" TEXT NOT NULL,
+				"subpackage" TEXT NOT NULL,
+				"p_name" TEXT NOT NULL,
+				"config" TEXT,
+				FOREIGN KEY(p_name) REFERENCES project(p_name),
+				CONSTRAINT PK_Bench PRIMARY KEY (b_name, subpackage, p_name)
+			  );`,
+			`CREATE TABLE IF NOT EXISTS measurement (
+				"m_id" INTEGER PRIMARY KEY AUTOINCREMENT,
+				"n" INT NOT NULL,
+				"ns_per_op" FLOAT NOT NULL,
+				"bed_setup" INT NOT NULL,
+				"it_setup" INT NOT NULL,
+				"sr_setup" INT NOT NULL,
+				"ir_setup" INT NOT NULL,
+				"bed_pos" INT NOT NULL,
+				"it_pos" INT NOT NULL,
+				"sr_pos" INT NOT NULL,
+				"ir_pos" INT NOT NULL,
+				"b_name" TEXT NOT NULL
+			  );`,
+		},
+		Columns: []columnDef{
+			// measurements of older databases, e.g., optimizer/zap.csv, predate tags and -count
+			{"measurement", "tag", `TEXT NOT NULL DEFAULT ''`},
+			{"measurement", "count_idx", `INT NOT NULL DEFAULT 0`},
+		},
+	},
+	{
+		Version:     2,
+		Description: "modules, sub-benchmark parameters, annotations, isolation, noise, profiles, discovery and planning tables",
+		Statements: []string{
+			// --- availability of benchmarks per tag ---
+			`CREATE TABLE IF NOT EXISTS benchmark_tag (
+				"b_name" TEXT NOT NULL,
+				"subpackage" TEXT NOT NULL,
+				"p_name" TEXT NOT NULL,
+				"tag" TEXT NOT NULL,
+				FOREIGN KEY(b_name, subpackage, p_name) REFERENCES benchmark(b_name, subpackage, p_name),
+				CONSTRAINT PK_BenchTag PRIMARY KEY (b_name, subpackage, p_name, tag)
+			  );`,
+			// --- benchmarks removed by include/exclude rules ---
+			`CREATE TABLE IF NOT EXISTS benchmark_exclusion (
+				"b_name" TEXT NOT NULL,
+				"subpackage" TEXT NOT NULL,
+				"p_name" TEXT NOT NULL,
+				"rule" TEXT NOT NULL,
+				"excluded_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			  );`,
+			// --- discovered benchmarks per commit and discovery settings ---
+			`CREATE TABLE IF NOT EXISTS discovery_cache (
+				"p_name" TEXT NOT NULL,
+				"commit_sha" TEXT NOT NULL,
+				"discovery_key" TEXT NOT NULL,
+				"tag" TEXT NOT NULL,
+				"benchmarks" TEXT NOT NULL,
+				"discovered_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				CONSTRAINT PK_DiscoveryCache PRIMARY KEY (p_name, commit_sha, discovery_key)
+			  );`,
+			// --- why benchmarks were scheduled when comparing two tags ---
+			`CREATE TABLE IF NOT EXISTS benchmark_selection (
+				"b_name" TEXT NOT NULL,
+				"subpackage" TEXT NOT NULL,
+				"p_name" TEXT NOT NULL,
+				"base_tag" TEXT NOT NULL,
+				"head_tag" TEXT NOT NULL,
+				"selected" BOOLEAN NOT NULL,
+				"reason" TEXT NOT NULL,
+				"selected_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			  );`,
+			// --- per-execution cost and stability measured before the experiment ---
+			`CREATE TABLE IF NOT EXISTS pilot (
+				"b_name" TEXT NOT NULL,
+				"subpackage" TEXT NOT NULL,
+				"p_name" TEXT NOT NULL,
+				"tag" TEXT NOT NULL,
+				"runs" INT NOT NULL,
+				"exec_time_s" FLOAT NOT NULL,
+				"ns_per_op_mean" FLOAT NOT NULL,
+				"ns_per_op_cv" FLOAT NOT NULL,
+				"samples" INT NOT NULL,
+				"flagged" BOOLEAN NOT NULL,
+				"action" TEXT NOT NULL,
+				"reason" TEXT NOT NULL,
+				"piloted_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			  );`,
+			// --- expansion of the tags config into the benchmarked revisions ---
+			`CREATE TABLE IF NOT EXISTS revision (
+				"p_name" TEXT NOT NULL,
+				"position" INT NOT NULL,
+				"label" TEXT NOT NULL,
+				"commit_sha" TEXT NOT NULL,
+				"selector" TEXT NOT NULL,
+				"expanded_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			  );`,
+			// --- index of the profiles recorded during benchmark executions ---
+			`CREATE TABLE IF NOT EXISTS profile (
+				"pr_id" INTEGER PRIMARY KEY AUTOINCREMENT,
+				"b_name" TEXT NOT NULL,
+				"subpackage" TEXT NOT NULL,
+				"tag" TEXT NOT NULL,
+				"kind" TEXT NOT NULL,
+				"bed_pos" INT NOT NULL,
+				"it_pos" INT NOT NULL,
+				"sr_pos" INT NOT NULL,
+				"ir_pos" INT NOT NULL,
+				"bucket" TEXT NOT NULL,
+				"object_key" TEXT NOT NULL
+			  );`,
+		},
+		Columns: []columnDef{
+			{"benchmark", "module", `TEXT NOT NULL DEFAULT './'`},
+			{"benchmark", "function", `TEXT NOT NULL DEFAULT ''`},
+			{"benchmark", "params", `TEXT NOT NULL DEFAULT '{}'`},
+			{"benchmark", "procs", `INT NOT NULL DEFAULT 1`},
+			{"benchmark", "skip", `BOOLEAN NOT NULL DEFAULT FALSE`},
+			{"benchmark", "timeout", `TEXT NOT NULL DEFAULT ''`},
+			{"benchmark", "bed", `INT NOT NULL DEFAULT 0`},
+			{"benchmark", "labels", `TEXT NOT NULL DEFAULT ''`},
+			{"measurement", "cpu_set", `TEXT NOT NULL DEFAULT ''`},
+			{"measurement", "runner_cpu_set", `TEXT NOT NULL DEFAULT ''`},
+			{"measurement", "gomaxprocs", `INT NOT NULL DEFAULT 0`},
+			{"measurement", "nice", `INT NOT NULL DEFAULT 0`},
+			{"measurement", "cpu_user_pct", `FLOAT`},
+			{"measurement", "cpu_system_pct", `FLOAT`},
+			{"measurement", "cpu_iowait_pct", `FLOAT`},
+			{"measurement", "cpu_steal_pct", `FLOAT`},
+			{"measurement", "ctx_switches", `INT`},
+			{"measurement", "load_avg1", `FLOAT`},
+			{"measurement", "mem_available_kb", `INT`},
+			{"measurement", "mem_pressure_avg10", `FLOAT`},
+			{"measurement", "profiled", `BOOLEAN NOT NULL DEFAULT FALSE`},
+		},
+	},
+	{
+		Version:     3,
+		Description: "experiments",
+		Statements: []string{
+			// --- one orchestrator run, the config is stored as it was read at the start ---
+			`CREATE TABLE IF NOT EXISTS experiment (
+				"e_id" INTEGER PRIMARY KEY AUTOINCREMENT,
+				"p_name" TEXT NOT NULL,
+				"status" TEXT NOT NULL,
+				"started_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				"finished_at" DATETIME,
+				"config" TEXT NOT NULL,
+				"args" TEXT NOT NULL,
+				"orchestrator_version" TEXT NOT NULL,
+				"runner_version" TEXT NOT NULL,
+				"bed_setup" INT NOT NULL,
+				"it_setup" INT NOT NULL,
+				"sr_setup" INT NOT NULL,
+				"ir_setup" INT NOT NULL
+			  );`,
+			// --- benchmarks scheduled in an experiment ---
+			`CREATE TABLE IF NOT EXISTS experiment_benchmark (
+				"e_id" INT NOT NULL,
+				"b_name" TEXT NOT NULL,
+				"subpackage" TEXT NOT NULL,
+				"p_name" TEXT NOT NULL,
+				FOREIGN KEY(e_id) REFERENCES experiment(e_id),
+				CONSTRAINT PK_ExperimentBench PRIMARY KEY (e_id, b_name, subpackage, p_name)
+			  );`,
+		},
+		Columns: []columnDef{
+			// rows recorded before experiments existed keep a NULL experiment
+			{"measurement", "e_id", `INT REFERENCES experiment(e_id)`},
+			{"profile", "e_id", `INT REFERENCES experiment(e_id)`},
+			{"pilot", "e_id", `INT REFERENCES experiment(e_id)`},
+			{"benchmark_selection", "e_id", `INT REFERENCES experiment(e_id)`},
+			{"benchmark_exclusion", "e_id", `INT REFERENCES experiment(e_id)`},
+			{"revision", "e_id", `INT REFERENCES experiment(e_id)`},
+		},
+	},
+	{
+		Version:     4,
+		Description: "benchmark IDs referenced by measurements and profiles",
+		Required: []columnDef{
+			// copied below, benchmarks of databases created before sub-benchmark configs lack it
+			{"benchmark", "config", `TEXT`},
+		},
+		Statements: []string{
+			// --- benchmarks get a surrogate ID, (b_name, subpackage, p_name) stays unique ---
+			`CREATE TABLE benchmark_new (
+				"bench_id" INTEGER PRIMARY KEY AUTOINCREMENT,
+				"b_name" TEXT NOT NULL,
+				"subpackage" TEXT NOT NULL,
+				"p_name" TEXT NOT NULL,
+				"module" TEXT NOT NULL DEFAULT './',
+				"config" TEXT,
+				"function" TEXT NOT NULL DEFAULT '',
+				"params" TEXT NOT NULL DEFAULT '{}',
+				"procs" INT NOT NULL DEFAULT 1,
+				"skip" BOOLEAN NOT NULL DEFAULT FALSE,
+				"timeout" TEXT NOT NULL DEFAULT '',
+				"bed" INT NOT NULL DEFAULT 0,
+				"labels" TEXT NOT NULL DEFAULT '',
+				FOREIGN KEY(p_name) REFERENCES project(p_name),
+				CONSTRAINT UQ_Bench UNIQUE (b_name, subpackage, p_name)
+			  );`,
+			`INSERT INTO benchmark_new(b_name, subpackage, p_name, module, config, function, params, procs, skip, timeout, bed, labels)
+				SELECT b_name, subpackage, p_name, module, config, function, params, procs, skip, timeout, bed, labels FROM benchmark
+				ORDER BY p_name, subpackage, b_name;`,
+			`CREATE TABLE benchmark_tag_new (
+				"bench_id" INT NOT NULL,
+				"tag" TEXT NOT NULL,
+				FOREIGN KEY(bench_id) REFERENCES benchmark_new(bench_id),
+				CONSTRAINT PK_BenchTagId PRIMARY KEY (bench_id, tag)
+			  );`,
+			`INSERT INTO benchmark_tag_new(bench_id, tag)
+				SELECT b.bench_id, t.tag FROM benchmark_tag t
+				JOIN benchmark_new b ON b.b_name = t.b_name AND b.subpackage = t.subpackage AND b.p_name = t.p_name;`,
+			`DROP TABLE benchmark_tag;`,
+			`DROP TABLE benchmark;`,
+			`ALTER TABLE benchmark_new RENAME TO benchmark;`,
+			`ALTER TABLE benchmark_tag_new RENAME TO benchmark_tag;`,
+		},
+		Columns: []columnDef{
+			{"measurement", "bench_id", `INT REFERENCES benchmark(bench_id)`},
+			{"measurement", "subpackage", `TEXT`},
+			{"measurement", "p_name", `TEXT`},
+			{"profile", "bench_id", `INT REFERENCES benchmark(bench_id)`},
+			{"profile", "p_name", `TEXT`},
+		},
+		Data: []string{
+			// earlier measurements only stored the name, they are assigned where the name is unambiguous
+			`UPDATE measurement SET
+				bench_id = (SELECT b.bench_id FROM benchmark b WHERE b.b_name = measurement.b_name),
+				subpackage = (SELECT b.subpackage FROM benchmark b WHERE b.b_name = measurement.b_name),
+				p_name = (SELECT b.p_name FROM benchmark b WHERE b.b_name = measurement.b_name)
+				WHERE bench_id IS NULL AND (SELECT COUNT(*) FROM benchmark b WHERE b.b_name = measurement.b_name) = 1;`,
+			`UPDATE profile SET
+				bench_id = (SELECT b.bench_id FROM benchmark b WHERE b.b_name = profile.b_name AND b.subpackage = profile.subpackage),
+				p_name = (SELECT b.p_name FROM benchmark b WHERE b.b_name = profile.b_name AND b.subpackage = profile.subpackage)
+				WHERE bench_id IS NULL AND (SELECT COUNT(*) FROM benchmark b WHERE b.b_name = profile.b_name AND b.subpackage = profile.subpackage) = 1;`,
+		},
+	},
+	{
+		Version:     5,
+		Description: "host fingerprints of runners",
+		Statements: []string{
+			// --- hardware and software of the host each instance run executed on ---
+			`CREATE TABLE IF NOT EXISTS host (
+				"h_id" INTEGER PRIMARY KEY AUTOINCREMENT,
+				"e_id" INT REFERENCES experiment(e_id),
+				"ir_pos" INT NOT NULL,
+				"hostname" TEXT NOT NULL,
+				"cpu_model" TEXT NOT NULL,
+				"cpu_flags" TEXT NOT NULL,
+				"microcode" TEXT NOT NULL,
+				"cores" INT NOT NULL,
+				"mem_total_kb" INT NOT NULL,
+				"kernel" TEXT NOT NULL,
+				"clocksource" TEXT NOT NULL,
+				"go_version" TEXT NOT NULL,
+				"go_env" TEXT NOT NULL,
+				"machine_type" TEXT NOT NULL,
+				"zone" TEXT NOT NULL,
+				"instance_id" TEXT NOT NULL,
+				"registered_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			  );`,
+		},
+		Columns: []columnDef{
+			{"measurement", "h_id", `INT REFERENCES host(h_id)`},
+		},
+	},
+	{
+		Version:     6,
+		Description: "provenance of experiments",
+		Columns: []columnDef{
+			{"experiment", "origin", `TEXT NOT NULL DEFAULT 'orchestrator'`},
+			{"experiment", "source", `TEXT NOT NULL DEFAULT ''`},
+			{"experiment", "source_sha256", `TEXT NOT NULL DEFAULT ''`},
+		},
+	},
+	{
+		Version:     7,
+		Description: "minimal configurations recommended by optimize",
+		Statements: []string{
+			// --- one run of optimize over the measurements of an experiment, with the configuration of the suite ---
+			`CREATE TABLE IF NOT EXISTS optimization (
+				"o_id" INTEGER PRIMARY KEY AUTOINCREMENT,
+				"e_id" INT NOT NULL REFERENCES experiment(e_id),
+				"p_name" TEXT NOT NULL,
+				"metric" TEXT NOT NULL,
+				"ci_method" TEXT NOT NULL,
+				"threshold" FLOAT NOT NULL,
+				"iterations" INT NOT NULL,
+				"confidence" FLOAT NOT NULL,
+				"seed" INT NOT NULL,
+				"ir_pos" INT NOT NULL,
+				"bed" INT NOT NULL,
+				"it" INT NOT NULL,
+				"sr" INT NOT NULL,
+				"optimized_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			  );`,
+			// --- cheapest stable configuration per benchmark and tag, and the results of the full configuration ---
+			`CREATE TABLE IF NOT EXISTS optimization_benchmark (
+				"o_id" INT NOT NULL REFERENCES optimization(o_id),
+				"e_id" INT NOT NULL REFERENCES experiment(e_id),
+				"bench_id" INT REFERENCES benchmark(bench_id),
+				"b_name" TEXT NOT NULL,
+				"subpackage" TEXT NOT NULL,
+				"tag" TEXT NOT NULL,
+				"bed" INT NOT NULL,
+				"it" INT NOT NULL,
+				"sr" INT NOT NULL,
+				"stable" BOOLEAN NOT NULL,
+				"instability" FLOAT,
+				"average" FLOAT,
+				"ci_lower" FLOAT,
+				"ci_upper" FLOAT,
+				"full_instability" FLOAT,
+				"full_average" FLOAT,
+				"full_ci_lower" FLOAT,
+				"full_ci_upper" FLOAT
+			  );`,
+		},
+	},
+}
+
+// latestSchemaVersion returns the version of the last migration.
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// ensureSchemaVersionTable creates the table recording the applied migrations.
+func ensureSchemaVersionTable() error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		"version" INT NOT NULL PRIMARY KEY,
+		"description" TEXT NOT NULL,
+		"applied_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	  );`)
+	return errors.Wrap(err, "creating schema_version table")
+}
+
+// currentSchemaVersion returns the highest applied migration, 0 for a new or unversioned database.
+func currentSchemaVersion() (int, error) {
+	var version sql.NullInt64
+	err := db.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version)
+	if err != nil {
+		return 0, errors.Wrap(err, "reading schema version")
+	}
+	return int(version.Int64), nil
+}
+
+// appliedMigrations lists the schema_version table.
+func appliedMigrations() ([]appliedMigration, error) {
+	rows, err := db.Query(`SELECT version, description, applied_at FROM schema_version ORDER BY version`)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading schema versions")
+	}
+	defer rows.Close()
+
+	applied := make([]appliedMigration, 0, len(migrations))
+	for rows.Next() {
+		var m appliedMigration
+		if err := rows.Scan(&m.Version, &m.Description, &m.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied = append(applied, m)
+	}
+	return applied, rows.Err()
+}
+
+// migrateDB applies all pending migrations up to target, 0 for the latest version.
+// It refuses to work on databases migrated by a newer orchestrator, and to migrate down to an older target.
+func migrateDB(target int) error {
+	for _, statement := range db.backend.SetupStatements() {
+		if _, err := db.Exec(statement); err != nil {
+			return errors.Wrapf(err, "statement %s", statement)
+		}
+	}
+	if err := ensureSchemaVersionTable(); err != nil {
+		return err
+	}
+	current, err := currentSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > latestSchemaVersion() {
+		return errors.Errorf("database schema version %d is newer than the latest known version %d", current, latestSchemaVersion())
+	}
+	if target == 0 {
+		target = latestSchemaVersion()
+	}
+	if target < 0 || target > latestSchemaVersion() {
+		return errors.Errorf("unknown schema version %d, the latest version is %d", target, latestSchemaVersion())
+	}
+	if target < current {
+		return errors.Errorf("database schema version %d is newer than the target version %d, migrations cannot be reverted", current, target)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current || m.Version > target {
+			continue
+		}
+		log.Infof("Applying migration %d: %s", m.Version, m.Description)
+		if err := applyMigration(&m); err != nil {
+			return errors.Wrapf(err, "migration %d", m.Version)
+		}
+	}
+	return nil
+}
+
+// applyMigration runs the migration and records it in one transaction.
+func applyMigration(m *migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op after commit
+
+	if err := addColumns(tx, m.Required); err != nil {
+		return err
+	}
+	for _, statement := range m.Statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return errors.Wrapf(err, "statement %s", statement)
+		}
+	}
+	if err := addColumns(tx, m.Columns); err != nil {
+		return err
+	}
+
+	for _, statement := range m.Data {
+		if _, err := tx.Exec(statement); err != nil {
+			return errors.Wrapf(err, "statement %s", statement)
+		}
+	}
+
+	if _, err := tx.Exec(`INSERT INTO schema_version(version, description) VALUES (?, ?)`, m.Version, m.Description); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addColumns adds the columns the tables do not have yet.
+func addColumns(tx *dbTx, columns []columnDef) error {
+	for _, c := range columns {
+		exists, err := hasColumn(tx, c.Table, c.Name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		log.Debugf("Adding column %s.%s", c.Table, c.Name)
+		if _, err := tx.Exec(`ALTER TABLE ` + c.Table + ` ADD COLUMN "` + c.Name + `" ` + c.Definition); err != nil {
+			return errors.Wrapf(err, "adding column %s.%s", c.Table, c.Name)
+		}
+	}
+	return nil
+}
+
+// hasColumn checks whether the table has the column.
+func hasColumn(tx *dbTx, table string, column string) (bool, error) {
+	rows, err := tx.Query(db.backend.ColumnsQuery(), table)
+	if err != nil {
+		return false, errors.Wrapf(err, "listing columns of %s", table)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// dropSchema drops all tables including the schema version, so that the migrations start from scratch.
+func dropSchema() {
+	for _, table := range append(schemaTables, "schema_version") {
+		log.Debugf("Drop %s table", table)
+		_, err := db.Exec(`DROP TABLE IF EXISTS ` + table + `;`)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+}
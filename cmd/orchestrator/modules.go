@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/modfile"
+)
+
+type (
+	// goModule is a Go module inside the project under test.
+	goModule struct {
+		Dir  string // module root relative to the project root, e.g., ./ or ./api
+		Path string // module path of the go.mod file
+	}
+)
+
+// findModules returns all modules of the project. If the project root has a go.work file, the modules
+// of the workspace are used, otherwise the project is searched for go.mod files.
+// Vendor, testdata and hidden directories are skipped like the go command does.
+func findModules(projPath string) ([]goModule, error) {
+	dirs := make([]string, 0, 1)
+
+	workFile := filepath.Join(projPath, "go.work")
+	if data, err := os.ReadFile(workFile); err == nil {
+		work, err := modfile.ParseWork(workFile, data, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing go.work")
+		}
+		for _, use := range work.Use {
+			dirs = append(dirs, filepath.Clean(use.Path))
+		}
+	} else {
+		err := filepath.WalkDir(projPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				name := d.Name()
+				if path != projPath && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Name() == "go.mod" {
+				rel, err := filepath.Rel(projPath, filepath.Dir(path))
+				if err != nil {
+					return err
+				}
+				dirs = append(dirs, rel)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "searching go.mod files")
+		}
+	}
+
+	modules := make([]goModule, 0, len(dirs))
+	for _, dir := range dirs {
+		data, err := os.ReadFile(filepath.Join(projPath, dir, "go.mod"))
+		if err != nil {
+			log.Warnf("Skipping module in %s: %v", dir, err)
+			continue
+		}
+		modules = append(modules, goModule{
+			Dir:  relativeDir(dir),
+			Path: modfile.ModulePath(data),
+		})
+	}
+	if len(modules) == 0 {
+		return nil, errors.Errorf("no go.mod found in %s", projPath)
+	}
+
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Dir < modules[j].Dir })
+	return modules, nil
+}
+
+// relativeDir formats a directory relative to the project or module root like go package patterns, i.e., ./ or ./sub.
+func relativeDir(dir string) string {
+	dir = filepath.ToSlash(filepath.Clean(dir))
+	if dir == "." {
+		return "./"
+	}
+	return "./" + strings.TrimPrefix(dir, "./")
+}
+
+// owningModule returns the innermost module containing the directory, which is relative to the project root.
+func owningModule(modules []goModule, dir string) string {
+	dir = relativeDir(dir)
+	owner := ""
+	for _, m := range modules {
+		if m.Dir == "./" || dir == m.Dir || strings.HasPrefix(dir, m.Dir+"/") {
+			if len(m.Dir) > len(owner) {
+				owner = m.Dir
+			}
+		}
+	}
+	return owner
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindModules(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []goModule
+	}{
+		{"single", map[string]string{"go.mod": "module example.com/root\n"}, []goModule{{"./", "example.com/root"}}},
+		{"nested", map[string]string{
+			"go.mod":                  "module example.com/root\n",
+			"api/go.mod":              "module example.com/root/api\n",
+			"tools/gen/go.mod":        "module example.com/gen\n",
+			"vendor/x/go.mod":         "module example.com/vendored\n",
+			"testdata/mod/go.mod":     "module example.com/testdata\n",
+			".git/go.mod":             "module example.com/hidden\n",
+			"_examples/basic/go.mod":  "module example.com/examples\n",
+			"api/testdata/sub/go.mod": "module example.com/apitestdata\n",
+		}, []goModule{{"./", "example.com/root"}, {"./api", "example.com/root/api"}, {"./tools/gen", "example.com/gen"}}},
+		// go.work lists the modules, other go.mod files are ignored
+		{"workspace", map[string]string{
+			"go.work":       "go 1.22\n\nuse (\n\t./api\n\t./cmd\n)\n",
+			"api/go.mod":    "module example.com/api\n",
+			"cmd/go.mod":    "module example.com/cmd\n",
+			"unused/go.mod": "module example.com/unused\n",
+		}, []goModule{{"./api", "example.com/api"}, {"./cmd", "example.com/cmd"}}},
+	}
+	for _, test := range tests {
+		projPath := t.TempDir()
+		for name, content := range test.files {
+			path := filepath.Join(projPath, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		modules, err := findModules(projPath)
+		if err != nil || !reflect.DeepEqual(modules, test.want) {
+			t.Errorf("%s: findModules = %v, %v, want %v", test.name, modules, err, test.want)
+		}
+	}
+
+	if _, err := findModules(t.TempDir()); err == nil {
+		t.Errorf("findModules without go.mod returned no error")
+	}
+}
+
+func TestRelativeDir(t *testing.T) {
+	tests := map[string]string{
+		"":         "./",
+		".":        "./",
+		"./":       "./",
+		"api":      "./api",
+		"./api":    "./api",
+		"api/v2/":  "./api/v2",
+		"api/../x": "./x",
+	}
+	for dir, want := range tests {
+		if got := relativeDir(dir); got != want {
+			t.Errorf("relativeDir(%q) = %q, want %q", dir, got, want)
+		}
+	}
+}
+
+func TestOwningModule(t *testing.T) {
+	modules := []goModule{{Dir: "./"}, {Dir: "./api"}, {Dir: "./api/v2"}}
+	tests := []struct {
+		modules []goModule
+		dir     string
+		want    string
+	}{
+		{modules, ".", "./"},
+		{modules, "internal", "./"},
+		{modules, "api", "./api"},
+		{modules, "api/handlers", "./api"},
+		{modules, "api/v2/handlers", "./api/v2"},
+		// prefixes only match whole directories
+		{modules, "apiv2", "./"},
+		{modules, "api/v20", "./api"},
+		// without a root module, directories outside of all modules have no owner
+		{modules[1:], "internal", ""},
+		{modules[1:], "api/x", "./api"},
+	}
+	for _, test := range tests {
+		if got := owningModule(test.modules, test.dir); got != test.want {
+			t.Errorf("owningModule(%v, %q) = %q, want %q", test.modules, test.dir, got, test.want)
+		}
+	}
+}
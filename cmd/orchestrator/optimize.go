@@ -0,0 +1,443 @@
+package main
+
+import (
+	"cloud-benchmark-tool/common"
+	"cloud-benchmark-tool/stats"
+	"database/sql"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+type (
+	// instabilityMetric measures the instability of the ns/op of a benchmark, bootstrap metrics use it iterations
+	// at confidence level cl in percent.
+	instabilityMetric func(data []float64, it int, cl float64, rng *rand.Rand) float64
+
+	// ciMethod is the confidence interval recorded with each configuration, and the average it belongs to.
+	ciMethod struct {
+		Interval func(data []float64, it int, cl float64, rng *rand.Rand) stats.Interval
+		Average  func(data []float64) float64
+	}
+
+	// optimizeOptions select the instability metric, and when a configuration counts as stable.
+	optimizeOptions struct {
+		Metric     string
+		CiMethod   string
+		Threshold  float64
+		Iterations int
+		Confidence float64
+		Seed       int64
+		IrPos      int // instance runs up to this position are evaluated
+	}
+
+	// repetitionConfig is a prefix of the repetitions of an experiment, the first Sr suite runs, It iterations and Bed seconds.
+	repetitionConfig struct {
+		Sr  int
+		It  int
+		Bed int
+	}
+
+	// configResult is the instability of a benchmark with the measurements of one configuration.
+	configResult struct {
+		Config      repetitionConfig
+		Instability float64
+		Average     float64
+		Ci          stats.Interval
+	}
+
+	// benchmarkSeries are the measurements of a benchmark and tag in the order they were recorded.
+	benchmarkSeries struct {
+		BenchId      sql.NullInt64
+		Name         string
+		Package      string
+		Tag          string
+		Measurements []seriesMeasurement
+	}
+
+	seriesMeasurement struct {
+		NsPerOp float64
+		SrPos   int
+		ItPos   int
+		BedPos  int
+	}
+
+	// benchmarkOptimization is the cheapest stable configuration of a benchmark, or the full one if none is stable.
+	benchmarkOptimization struct {
+		Series  *benchmarkSeries
+		Results []configResult // per configuration of configPrefixes
+		Min     configResult
+		Full    configResult
+		Stable  bool
+	}
+)
+
+// instabilityMetrics of optimize, named like the result directories in optimizer/go_optimization.
+// rciw is the relative width of the confidence interval of the mean or median, with percentile (p) or studentized (t) bootstrap.
+var instabilityMetrics = map[string]instabilityMetric{
+	"cv":            func(data []float64, _ int, _ float64, _ *rand.Rand) float64 { return stats.Cv(data) },
+	"rmad":          func(data []float64, _ int, _ float64, _ *rand.Rand) float64 { return stats.Rmad(data) },
+	"rciw_mean_p":   stats.RciwMeanP,
+	"rciw_median_p": stats.RciwMedianP,
+	"rciw_mean_t":   stats.RciwMeanT,
+	"rciw_median_t": stats.RciwMedianT,
+}
+
+// ciMethods of optimize, the average is the mean or median the interval is computed for.
+var ciMethods = map[string]ciMethod{
+	"mean_p":   {stats.CiBootstrapMeanP, stats.Mean},
+	"median_p": {stats.CiBootstrapMedianP, stats.Median},
+	"mean_t":   {stats.CiBootstrapMeanT, stats.Mean},
+	"median_t": {stats.CiBootstrapMedianT, stats.Median},
+}
+
+// repetitionKeys matches the top-level keys of the repetitions in a config file.
+var repetitionKeys = regexp.MustCompile(`(?m)^(sr|it|bed)[ \t]*=[ \t]*[0-9]+`)
+
+// optimizeCommand recommends the cheapest configuration of an experiment whose instability is below the threshold,
+// like optimizer.py. Configurations are prefixes of the suite runs, iterations and benchmark execution durations of the
+// experiment. The recommendations per benchmark and for the whole suite are stored in the tables optimization and
+// optimization_benchmark, and the suite configuration can be written as config file of a follow-up experiment.
+func optimizeCommand(args []string) {
+	fs := flag.NewFlagSet("optimize", flag.ExitOnError)
+	dbConfig := dbFlags(fs)
+	var opts optimizeOptions
+	eId := fs.Int64("experiment", 0, "Experiment to optimize, default is the last finished experiment.")
+	fs.StringVar(&opts.Metric, "metric", "cv", "Instability metric, cv, rmad, rciw_mean_p, rciw_median_p, rciw_mean_t or rciw_median_t.")
+	fs.StringVar(&opts.CiMethod, "ci", "mean_p", "Confidence interval recorded with the average, mean_p, median_p, mean_t or median_t.")
+	fs.Float64Var(&opts.Threshold, "threshold", 0.01, "Configurations with a lower instability are stable.")
+	fs.IntVar(&opts.Iterations, "iterations", stats.DEFAULT_ITERATIONS, "Bootstrap iterations.")
+	fs.Float64Var(&opts.Confidence, "confidence", stats.DEFAULT_CONFIDENCE, "Confidence level of the bootstrap intervals in percent.")
+	fs.Int64Var(&opts.Seed, "seed", stats.DEFAULT_SEED, "Seed of the bootstrap.")
+	fs.IntVar(&opts.IrPos, "ir", 1, "Evaluate the measurements of the instance runs up to this position, optimizer.py only uses the first.")
+	output := fs.String("o", "", "Write the config file of a follow-up experiment with the suite configuration to this file.")
+	baseConfig := fs.String("config", "", "Config file the follow-up config is based on, default is the config of the experiment.")
+	dryRun := fs.Bool("dry-run", false, "Only print the recommendations, the database is not changed.")
+	var tags, benchmarks listFlag
+	fs.Var(&tags, "tag", "Only optimize measurements of these tags (repeatable, comma separated).")
+	fs.Var(&benchmarks, "bench", "Only optimize benchmarks matching the filter rule, e.g., BenchmarkEncode* or pkg:./codec/* (repeatable).")
+	fs.Parse(args)
+
+	if _, found := instabilityMetrics[opts.Metric]; !found {
+		fatalf("unknown instability metric %q", opts.Metric)
+	}
+	if _, found := ciMethods[opts.CiMethod]; !found {
+		fatalf("unknown confidence interval method %q", opts.CiMethod)
+	}
+
+	openDB(dbConfig)
+	defer CloseDB()
+	if *dryRun {
+		requireLatestSchema()
+	} else if err := migrateDB(0); err != nil {
+		fatalf("%v", err)
+	}
+
+	if *eId == 0 {
+		err := db.QueryRow(`SELECT e_id FROM experiment WHERE status = ? ORDER BY e_id DESC LIMIT 1`, EXPERIMENT_FINISHED).Scan(eId)
+		if err == sql.ErrNoRows {
+			var legacy int
+			db.QueryRow(`SELECT COUNT(*) FROM measurement WHERE e_id IS NULL`).Scan(&legacy)
+			if legacy > 0 {
+				fatalf("no finished experiment to optimize, the %d measurements recorded before experiments existed "+
+					"become one with db merge into another database, or with export and import", legacy)
+			}
+			fatalf("no finished experiment to optimize, run an experiment or import results first")
+		} else if err != nil {
+			fatalf("%v", err)
+		}
+	}
+	var pName, config string
+	var full repetitionConfig
+	err := db.QueryRow(`SELECT p_name, config, sr_setup, it_setup, bed_setup FROM experiment WHERE e_id = ?`, *eId).
+		Scan(&pName, &config, &full.Sr, &full.It, &full.Bed)
+	if err == sql.ErrNoRows {
+		fatalf("experiment %d does not exist", *eId)
+	} else if err != nil {
+		fatalf("%v", err)
+	}
+	if *baseConfig != "" {
+		content, err := os.ReadFile(*baseConfig)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		config = string(content)
+	}
+	if *output != "" && config == "" {
+		fatalf("experiment %d has no config, the follow-up config needs -config", *eId)
+	}
+
+	filter, err := newExportFilter([]string{strconv.FormatInt(*eId, 10)}, "", tags, benchmarks)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	series, err := selectBenchmarkSeries(filter, opts.IrPos)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if len(series) == 0 {
+		fatalf("experiment %d has no matching measurements", *eId)
+	}
+
+	configs := configPrefixes(full)
+	rng := stats.NewRand(opts.Seed)
+	optimized := make([]*benchmarkOptimization, 0, len(series))
+	for _, s := range series {
+		optimized = append(optimized, optimizeBenchmark(s, configs, opts, rng))
+	}
+	suite := optimizeSuite(optimized, configs, full, opts.Threshold)
+	printOptimization(optimized, suite, full)
+
+	if !*dryRun {
+		oId, err := insertOptimization(*eId, pName, opts, suite, optimized)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Printf("stored as optimization %d\n", oId)
+	}
+	if *output != "" {
+		if err := writeFollowUpConfig(*output, config, suite); err != nil {
+			fatalf("%v", err)
+		}
+		fmt.Printf("wrote follow-up config %s\n", *output)
+	}
+}
+
+// selectBenchmarkSeries returns the measurements matching the filter up to instance run irPos per benchmark and tag,
+// in the order of their first measurement.
+func selectBenchmarkSeries(filter *exportFilter, irPos int) ([]*benchmarkSeries, error) {
+	where, params := filter.where()
+	if where == "" {
+		where = " WHERE m.ir_pos <= ?"
+	} else {
+		where += " AND m.ir_pos <= ?"
+	}
+	rows, err := db.Query(`SELECT m.bench_id, m.b_name, COALESCE(m.subpackage, ''), m.tag, m.ns_per_op, m.sr_pos, m.it_pos, m.bed_pos
+		FROM measurement m`+where+` ORDER BY m.m_id`, append(params, irPos)...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying measurements")
+	}
+	defer rows.Close()
+
+	series := make([]*benchmarkSeries, 0)
+	byKey := make(map[string]*benchmarkSeries)
+	excluded := make(map[string]bool)
+	for rows.Next() {
+		var s benchmarkSeries
+		var m seriesMeasurement
+		if err := rows.Scan(&s.BenchId, &s.Name, &s.Package, &s.Tag, &m.NsPerOp, &m.SrPos, &m.ItPos, &m.BedPos); err != nil {
+			return nil, err
+		}
+		key := s.Package + " " + s.Name + " " + s.Tag
+		if excluded[key] {
+			continue
+		}
+		current, found := byKey[key]
+		if !found {
+			if filter.Benchmarks.excludedBy(&common.Benchmark{Name: s.Name, Package: s.Package}) != "" {
+				excluded[key] = true
+				continue
+			}
+			current = &s
+			byKey[key] = current
+			series = append(series, current)
+		}
+		current.Measurements = append(current.Measurements, m)
+	}
+	return series, rows.Err()
+}
+
+// configPrefixes lists the configurations of the full one in the order of ConfigCounter in optimizer.py, the execution
+// duration changes fastest. Configurations with less than 3 executions per instance are left out.
+func configPrefixes(full repetitionConfig) []repetitionConfig {
+	configs := make([]repetitionConfig, 0, full.Sr*full.It*full.Bed)
+	for sr := 1; sr <= full.Sr; sr++ {
+		for it := 1; it <= full.It; it++ {
+			if sr*it < 3 {
+				continue
+			}
+			for bed := 1; bed <= full.Bed; bed++ {
+				configs = append(configs, repetitionConfig{Sr: sr, It: it, Bed: bed})
+			}
+		}
+	}
+	return configs
+}
+
+// Time returns the benchmark execution time of the configuration per instance run in seconds.
+func (c repetitionConfig) Time() int {
+	return c.Sr * c.It * c.Bed
+}
+
+func (c repetitionConfig) String() string {
+	return fmt.Sprintf("sr=%d it=%d bed=%d", c.Sr, c.It, c.Bed)
+}
+
+// optimizeBenchmark evaluates the configurations of a benchmark, and selects the cheapest stable one. Ties are broken by
+// the lower instability. Without a stable configuration the last one is selected, which is the full configuration.
+func optimizeBenchmark(s *benchmarkSeries, configs []repetitionConfig, opts optimizeOptions, rng *rand.Rand) *benchmarkOptimization {
+	metric := instabilityMetrics[opts.Metric]
+	ci := ciMethods[opts.CiMethod]
+
+	b := benchmarkOptimization{Series: s, Results: make([]configResult, len(configs))}
+	for i, c := range configs {
+		data := make([]float64, 0, len(s.Measurements))
+		for _, m := range s.Measurements {
+			if m.SrPos <= c.Sr && m.ItPos <= c.It && m.BedPos <= c.Bed {
+				data = append(data, m.NsPerOp)
+			}
+		}
+		result := configResult{Config: c, Instability: math.NaN(), Average: math.NaN(), Ci: stats.Interval{Lower: math.NaN(), Upper: math.NaN()}}
+		if len(data) > 0 {
+			// same order of bootstrap draws as optimizer.py
+			result.Instability = metric(data, opts.Iterations, opts.Confidence, rng)
+			result.Average = ci.Average(data)
+			result.Ci = ci.Interval(data, opts.Iterations, opts.Confidence, rng)
+		}
+		b.Results[i] = result
+
+		if result.Instability < opts.Threshold && (!b.Stable || c.Time() < b.Min.Config.Time() ||
+			c.Time() == b.Min.Config.Time() && result.Instability < b.Min.Instability) {
+			b.Min = result
+			b.Stable = true
+		}
+	}
+	if len(configs) > 0 {
+		b.Full = b.Results[len(configs)-1]
+		if !b.Stable {
+			b.Min = b.Full
+		}
+	}
+	return &b
+}
+
+// optimizeSuite selects the cheapest configuration all benchmarks are stable with, ties are broken by the lower
+// highest instability. Benchmarks unstable with the full configuration do not hold the suite back, more repetitions
+// would not help them. Without such a configuration the full configuration is selected.
+func optimizeSuite(optimized []*benchmarkOptimization, configs []repetitionConfig, full repetitionConfig, threshold float64) repetitionConfig {
+	suite, found := full, false
+	suiteInstability := math.Inf(1)
+	for i, c := range configs {
+		highest, counted := 0.0, false
+		for _, b := range optimized {
+			if b.Full.Instability < threshold {
+				highest = math.Max(highest, b.Results[i].Instability)
+				if math.IsNaN(b.Results[i].Instability) {
+					highest = math.Inf(1)
+				}
+				counted = true
+			}
+		}
+		if counted && highest < threshold && (!found || c.Time() < suite.Time() || c.Time() == suite.Time() && highest < suiteInstability) {
+			suite, found = c, true
+			suiteInstability = highest
+		}
+	}
+	return suite
+}
+
+// printOptimization prints the recommended configuration per benchmark and of the suite.
+func printOptimization(optimized []*benchmarkOptimization, suite repetitionConfig, full repetitionConfig) {
+	minTime, stable := 0, 0
+	for _, b := range optimized {
+		s := b.Series
+		state := "stable"
+		if !b.Stable {
+			state = "unstable"
+		} else {
+			stable++
+		}
+		name := s.Package + " " + s.Name
+		if s.Tag != "" {
+			name += " " + s.Tag
+		}
+		fmt.Printf("%s: %s, instability %.4f (full %.4f), %s\n", name, b.Min.Config, b.Min.Instability, b.Full.Instability, state)
+		minTime += b.Min.Config.Time()
+	}
+	fmt.Printf("%d of %d benchmarks stable, %d s instead of %d s per instance run with the configuration per benchmark\n",
+		stable, len(optimized), minTime, full.Time()*len(optimized))
+	fmt.Printf("suite: %s, %d s instead of %d s per benchmark and instance run\n", suite, suite.Time(), full.Time())
+}
+
+// insertOptimization stores the recommendations in one transaction, and returns the ID of the optimization.
+func insertOptimization(eId int64, pName string, opts optimizeOptions, suite repetitionConfig, optimized []*benchmarkOptimization) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // no-op after commit
+
+	var oId int64
+	err = tx.QueryRow(`INSERT INTO optimization(e_id, p_name, metric, ci_method, threshold, iterations, confidence, seed, ir_pos, bed, it, sr)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING o_id`,
+		eId, pName, opts.Metric, opts.CiMethod, opts.Threshold, opts.Iterations, opts.Confidence, opts.Seed, opts.IrPos,
+		suite.Bed, suite.It, suite.Sr).Scan(&oId)
+	if err != nil {
+		return 0, errors.Wrap(err, "inserting optimization")
+	}
+
+	statement, err := tx.Prepare(`INSERT INTO optimization_benchmark(o_id, e_id, bench_id, b_name, subpackage, tag, bed, it, sr, stable,
+			instability, average, ci_lower, ci_upper, full_instability, full_average, full_ci_lower, full_ci_upper)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer statement.Close()
+	for _, b := range optimized {
+		s := b.Series
+		_, err = statement.Exec(oId, eId, s.BenchId, s.Name, s.Package, s.Tag, b.Min.Config.Bed, b.Min.Config.It, b.Min.Config.Sr, b.Stable,
+			finiteOrNull(b.Min.Instability), finiteOrNull(b.Min.Average), finiteOrNull(b.Min.Ci.Lower), finiteOrNull(b.Min.Ci.Upper),
+			finiteOrNull(b.Full.Instability), finiteOrNull(b.Full.Average), finiteOrNull(b.Full.Ci.Lower), finiteOrNull(b.Full.Ci.Upper))
+		if err != nil {
+			return 0, errors.Wrapf(err, "inserting optimization of %s %s", s.Package, s.Name)
+		}
+	}
+	return oId, tx.Commit()
+}
+
+// finiteOrNull returns nil for NaN and infinite values, which are stored as NULL.
+func finiteOrNull(x float64) any {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return nil
+	}
+	return x
+}
+
+// writeFollowUpConfig writes the config with the repetitions of the suite configuration. Keys missing in the config are
+// added at the top, where they are top-level keys.
+func writeFollowUpConfig(fileName string, config string, suite repetitionConfig) error {
+	values := map[string]int{"sr": suite.Sr, "it": suite.It, "bed": suite.Bed}
+	replaced := make(map[string]bool)
+	config = repetitionKeys.ReplaceAllStringFunc(config, func(line string) string {
+		key := repetitionKeys.FindStringSubmatch(line)[1]
+		if replaced[key] {
+			return line
+		}
+		replaced[key] = true
+		return fmt.Sprintf("%s = %d", key, values[key])
+	})
+	missing := make([]string, 0)
+	for _, key := range []string{"bed", "it", "sr"} {
+		if !replaced[key] {
+			missing = append(missing, fmt.Sprintf("%s = %d\n", key, values[key]))
+		}
+	}
+	config = strings.Join(missing, "") + config
+
+	var cfg configFile
+	if _, err := toml.Decode(config, &cfg); err != nil {
+		return errors.Wrap(err, "follow-up config")
+	}
+	if cfg.Sr != suite.Sr || cfg.It != suite.It || cfg.Bed != suite.Bed {
+		return errors.Errorf("follow-up config: repetitions are not top-level keys of the config")
+	}
+	return os.WriteFile(fileName, []byte(config), 0644)
+}
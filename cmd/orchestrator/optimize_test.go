@@ -0,0 +1,208 @@
+package main
+
+import (
+	"cloud-benchmark-tool/stats"
+	"encoding/csv"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// optimizeSubset are benchmarks of zap.csv with different minimal configurations in optimizer.py,
+// BenchmarkBoolField is unstable by cv even with the full configuration.
+var optimizeSubset = []string{"BenchmarkBoolsArrayMarshaler", "BenchmarkNoContext", "BenchmarkFloat64Field", "Benchmark10Fields",
+	"BenchmarkZapConsole", "BenchmarkBoolField"}
+
+// TestOptimizeBenchmark optimizes a subset of the zap benchmarks with the deterministic instability metrics, and
+// compares the minimal and full configurations with the results of optimizer.py.
+func TestOptimizeBenchmark(t *testing.T) {
+	series := zapSeries(t, optimizeSubset)
+	full := repetitionConfig{Sr: 3, It: 5, Bed: 5}
+	configs := configPrefixes(full)
+
+	for _, metric := range []struct{ name, ci, results string }{{"cv", "mean_p", "cv_mean_p"}, {"rmad", "median_p", "rmad_median_p"}} {
+		minResults := readOptimizerResults(t, filepath.Join("../../optimizer/go_optimization/zap_results", metric.results, "min_config_res.csv"))
+		fullResults := readOptimizerResults(t, filepath.Join("../../optimizer/go_optimization/zap_results", metric.results, "full_config_res.csv"))
+		opts := optimizeOptions{Metric: metric.name, CiMethod: metric.ci, Threshold: 0.01, Iterations: 100, Confidence: stats.DEFAULT_CONFIDENCE}
+		rng := stats.NewRand(stats.DEFAULT_SEED)
+
+		for _, s := range series {
+			b := optimizeBenchmark(s, configs, opts, rng)
+			want, wantFull := minResults[s.Name], fullResults[s.Name]
+			if b.Min.Config != want.Config || !closeTo(b.Min.Instability, want.Instability) || !closeTo(b.Min.Average, want.Average) {
+				t.Errorf("%s %s: min %s, instability %g, average %g, want %s, %g, %g", metric.name, s.Name,
+					b.Min.Config, b.Min.Instability, b.Min.Average, want.Config, want.Instability, want.Average)
+			}
+			if b.Full.Config != full || !closeTo(b.Full.Instability, wantFull.Instability) {
+				t.Errorf("%s %s: full %s, instability %g, want %s, %g", metric.name, s.Name, b.Full.Config, b.Full.Instability, full, wantFull.Instability)
+			}
+			if b.Stable != (want.Instability < opts.Threshold) {
+				t.Errorf("%s %s: stable %t with instability %g", metric.name, s.Name, b.Stable, want.Instability)
+			}
+		}
+	}
+}
+
+// TestOptimizeSuite selects the suite configuration of zap benchmarks, which has to be stable for every benchmark
+// stable with the full configuration. BenchmarkNoContext is only stable with fewer suite runs by cv, and
+// BenchmarkBoolField never, they do not hold the suite back.
+func TestOptimizeSuite(t *testing.T) {
+	series := zapSeries(t, []string{"BenchmarkBoolsArrayMarshaler", "BenchmarkBoolsReflect", "BenchmarkReflectField", "BenchmarkNoContext", "BenchmarkBoolField"})
+	full := repetitionConfig{Sr: 3, It: 5, Bed: 5}
+	configs := configPrefixes(full)
+	opts := optimizeOptions{Metric: "cv", CiMethod: "mean_p", Threshold: 0.01, Iterations: 100, Confidence: stats.DEFAULT_CONFIDENCE}
+	rng := stats.NewRand(stats.DEFAULT_SEED)
+	optimized := make([]*benchmarkOptimization, 0, len(series))
+	for _, s := range series {
+		optimized = append(optimized, optimizeBenchmark(s, configs, opts, rng))
+	}
+
+	// BenchmarkBoolsArrayMarshaler and BenchmarkBoolsReflect are cheapest with sr=1 it=3 bed=1, but all three are
+	// stable with sr=3 it=1 bed=1
+	suite := optimizeSuite(optimized, configs, full, opts.Threshold)
+	if want := (repetitionConfig{Sr: 3, It: 1, Bed: 1}); suite != want {
+		t.Errorf("suite configuration %s, want %s", suite, want)
+	}
+	for i, c := range configs {
+		if c != suite {
+			continue
+		}
+		for _, b := range optimized {
+			if b.Full.Instability < opts.Threshold && b.Results[i].Instability >= opts.Threshold {
+				t.Errorf("%s is unstable with the suite configuration: %g", b.Series.Name, b.Results[i].Instability)
+			}
+		}
+	}
+
+	// ties are broken by the lower highest instability, without a stable configuration the full one is selected
+	results := func(instabilities ...float64) *benchmarkOptimization {
+		b := &benchmarkOptimization{Full: configResult{Instability: instabilities[len(instabilities)-1]}}
+		for _, instability := range instabilities {
+			b.Results = append(b.Results, configResult{Instability: instability})
+		}
+		return b
+	}
+	small := repetitionConfig{Sr: 2, It: 2, Bed: 1}
+	tied := []repetitionConfig{{Sr: 1, It: 3, Bed: 1}, {Sr: 3, It: 1, Bed: 1}, small}
+	tests := []struct {
+		name      string
+		optimized []*benchmarkOptimization
+		want      repetitionConfig
+	}{
+		{"tie", []*benchmarkOptimization{results(0.005, 0.002, 0.001), results(0.002, 0.004, 0.001)}, tied[1]},
+		{"cheapest", []*benchmarkOptimization{results(0.02, 0.02, 0.009)}, small},
+		{"missing measurements", []*benchmarkOptimization{results(math.NaN(), 0.002, 0.001), results(0.002, 0.004, 0.001)}, tied[1]},
+		{"unstable", []*benchmarkOptimization{results(0.02, 0.02, 0.02)}, full},
+	}
+	for _, test := range tests {
+		if got := optimizeSuite(test.optimized, tied, full, 0.01); got != test.want {
+			t.Errorf("%s: suite %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestConfigPrefixes(t *testing.T) {
+	configs := configPrefixes(repetitionConfig{Sr: 3, It: 5, Bed: 5})
+	// every sr and it with at least 3 executions, times every bed
+	if len(configs) != (15-3)*5 {
+		t.Fatalf("%d configurations, want %d", len(configs), (15-3)*5)
+	}
+	want := []repetitionConfig{{1, 3, 1}, {1, 3, 2}, {1, 3, 3}, {1, 3, 4}, {1, 3, 5}, {1, 4, 1}}
+	for i, c := range want {
+		if configs[i] != c {
+			t.Errorf("configuration %d is %s, want %s", i, configs[i], c)
+		}
+	}
+	if last := configs[len(configs)-1]; last != (repetitionConfig{Sr: 3, It: 5, Bed: 5}) {
+		t.Errorf("last configuration %s, want the full one", last)
+	}
+	if configs := configPrefixes(repetitionConfig{Sr: 1, It: 2, Bed: 5}); len(configs) != 0 {
+		t.Errorf("configurations with 2 executions %v, want none", configs)
+	}
+}
+
+func TestWriteFollowUpConfig(t *testing.T) {
+	suite := repetitionConfig{Sr: 2, It: 5, Bed: 1}
+	tests := []struct {
+		name, config, want string
+	}{
+		{"replaced", "name = \"zap\"\nbed = 5\nit = 5\nsr   = 3\n\n[other]\nsr = 7\n", "name = \"zap\"\nbed = 1\nit = 5\nsr = 2\n\n[other]\nsr = 7\n"},
+		{"missing", "name = \"zap\"\nit = 3\n", "bed = 1\nsr = 2\nname = \"zap\"\nit = 5\n"},
+	}
+	for _, test := range tests {
+		fileName := filepath.Join(t.TempDir(), "follow-up.toml")
+		if err := writeFollowUpConfig(fileName, test.config, suite); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		got, err := os.ReadFile(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: follow-up config %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	// the repetitions of a config in a table cannot be set at the top
+	fileName := filepath.Join(t.TempDir(), "follow-up.toml")
+	if err := writeFollowUpConfig(fileName, "[run]\nbed = 5\nit = 5\nsr = 3\n", suite); err == nil {
+		t.Errorf("writeFollowUpConfig of repetitions in a table returned no error")
+	}
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		t.Errorf("invalid follow-up config was written: %v", err)
+	}
+}
+
+// zapSeries selects the series of the benchmarks from the database zap.csv was exported from.
+func zapSeries(t *testing.T, names []string) []*benchmarkSeries {
+	t.Helper()
+	openMigratedDB(t, "../../optimizer/final_data_with_config/zap/zap.db")
+	filter, err := newExportFilter(nil, "", nil, names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	series, err := selectBenchmarkSeries(filter, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != len(names) {
+		t.Fatalf("selected %d series, want %d", len(series), len(names))
+	}
+	return series
+}
+
+// readOptimizerResults reads the configuration results of optimizer.py by benchmark.
+func readOptimizerResults(t *testing.T, path string) map[string]configResult {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(map[string]configResult)
+	for _, rec := range records[1:] {
+		// configurations are python tuples (sr, it, bed)
+		var c [3]int
+		for i, v := range strings.Split(strings.Trim(rec[1], "()"), ",") {
+			c[i], err = strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				t.Fatalf("%s: configuration %q", path, rec[1])
+			}
+		}
+		instability, _ := strconv.ParseFloat(rec[2], 64)
+		average, _ := strconv.ParseFloat(rec[4], 64)
+		results[rec[0]] = configResult{Config: repetitionConfig{Sr: c[0], It: c[1], Bed: c[2]}, Instability: instability, Average: average}
+	}
+	return results
+}
+
+func closeTo(got float64, want float64) bool {
+	return math.Abs(got-want) <= 1e-9*math.Abs(want)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"cloud-benchmark-tool/common"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Pilot actions for benchmarks exceeding the limits, flag only records them, drop does not schedule them
+const (
+	PILOT_ACTION_FLAG = "flag"
+	PILOT_ACTION_DROP = "drop"
+)
+
+type (
+	// pilotLimits are the thresholds a benchmark has to meet in the pilot run.
+	pilotLimits struct {
+		Runs        int           // go test executions per benchmark
+		MaxExecTime time.Duration // mean wall time of a single go test execution, 0 for no limit
+		MaxCv       float64       // coefficient of variation of ns/op across all pilot measurements, 0 for no limit
+		Action      string
+	}
+
+	// pilotResult summarizes the pilot executions of one benchmark.
+	pilotResult struct {
+		ExecTime time.Duration
+		Mean     float64
+		Cv       float64
+		Samples  int
+		Reasons  []string
+	}
+)
+
+// newPilotLimits parses the pilot settings of the config file.
+func newPilotLimits(runs int, maxExecTime string, maxCv float64, action string) (*pilotLimits, error) {
+	limits := pilotLimits{Runs: runs, MaxCv: maxCv, Action: action}
+	if maxExecTime != "" {
+		var err error
+		limits.MaxExecTime, err = time.ParseDuration(maxExecTime)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid pilot time limit %q", maxExecTime)
+		}
+	}
+	switch action {
+	case "":
+		limits.Action = PILOT_ACTION_FLAG
+	case PILOT_ACTION_FLAG, PILOT_ACTION_DROP:
+	default:
+		return nil, errors.Errorf("unknown pilot action %q", action)
+	}
+	return &limits, nil
+}
+
+// runPilot executes every benchmark a few times on the first revision, before instances are launched. The project is
+// checked out on the commit of the first revision for the pilot, and the previous checkout is restored afterwards.
+// It measures the wall time per go test execution and the variability of the results, and flags or drops the
+// benchmarks exceeding the limits. The results are stored in the DB, the projected duration of an instance run,
+// execution time times bed * it * sr * revisions, is logged.
+func runPilot(projName string, projPath string, revisions []revision, benchmarks []common.Benchmark, limits *pilotLimits, iso *common.Isolation, bed int, it int, sr int) ([]common.Benchmark, error) {
+	tag := revisions[0].Label
+	previous, err := currentCheckout(projPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkoutTag(projPath, revisions[0].Commit); err != nil {
+		return nil, err
+	}
+
+	kept := make([]common.Benchmark, 0, len(benchmarks))
+	var projected time.Duration
+
+	for _, b := range benchmarks {
+		if !b.AvailableOn(tag) {
+			kept = append(kept, b)
+			continue
+		}
+
+		// run on a copy, the measurements of the pilot are not part of the experiment
+		pilot := b
+		pilot.Measurement = []common.Measurement{}
+		pilot.Profiles = nil
+
+		result := pilotResult{}
+		var elapsed time.Duration
+		var err error
+		for run := 1; run <= limits.Runs && err == nil; run++ {
+			start := time.Now()
+			err = pilot.RunBenchmark(1, run, 0, tag, nil, iso)
+			elapsed += time.Since(start)
+		}
+		if err != nil {
+			log.Warnf("Pilot run of benchmark %s failed: %v", b.Name, err)
+			result.Reasons = append(result.Reasons, "failed in pilot run")
+		} else {
+			result.ExecTime = elapsed / time.Duration(limits.Runs)
+			result.Mean, result.Cv = coefficientOfVariation(pilot.Measurement)
+			result.Samples = len(pilot.Measurement)
+			result.Reasons = limits.check(&result)
+		}
+
+		flagged := len(result.Reasons) > 0
+		reason := strings.Join(result.Reasons, ", ")
+		log.Infof("Pilot of benchmark %s in %s: %s per execution, mean %.2f ns/op, cv %.4f over %d samples, flagged: %t %s",
+			b.Name, b.ProjectPackage(), result.ExecTime, result.Mean, result.Cv, result.Samples, flagged, reason)
+		insertPilot(b.Name, b.ProjectPackage(), projName, tag, limits.Runs, result.ExecTime.Seconds(), result.Mean, result.Cv, result.Samples, flagged, limits.Action, reason)
+
+		if flagged && limits.Action == PILOT_ACTION_DROP {
+			log.Infof("Dropping benchmark %s in %s after pilot run: %s", b.Name, b.ProjectPackage(), reason)
+			continue
+		}
+		kept = append(kept, b)
+		projected += result.ExecTime * time.Duration(bed*it*sr*len(revisions))
+	}
+
+	log.Infof("Pilot run kept %d of %d benchmarks, projected duration per instance: %s", len(kept), len(benchmarks), projected)
+	return kept, checkoutTag(projPath, previous)
+}
+
+// check returns the limits the pilot result exceeds.
+func (limits *pilotLimits) check(result *pilotResult) []string {
+	reasons := make([]string, 0)
+	if limits.MaxExecTime > 0 && result.ExecTime > limits.MaxExecTime {
+		reasons = append(reasons, fmt.Sprintf("execution time %s exceeds %s", result.ExecTime.Round(time.Millisecond), limits.MaxExecTime))
+	}
+	if limits.MaxCv > 0 && result.Cv > limits.MaxCv {
+		reasons = append(reasons, fmt.Sprintf("cv %.4f exceeds %.4f", result.Cv, limits.MaxCv))
+	}
+	if result.Samples == 0 {
+		reasons = append(reasons, "no measurements in pilot run")
+	}
+	return reasons
+}
+
+// coefficientOfVariation returns mean and sample coefficient of variation of ns/op.
+func coefficientOfVariation(measurements []common.Measurement) (float64, float64) {
+	if len(measurements) == 0 {
+		return 0, 0
+	}
+	sum := 0.0
+	for _, m := range measurements {
+		sum += m.NsPerOp
+	}
+	mean := sum / float64(len(measurements))
+	if len(measurements) < 2 || mean == 0 {
+		return mean, 0
+	}
+
+	squares := 0.0
+	for _, m := range measurements {
+		squares += (m.NsPerOp - mean) * (m.NsPerOp - mean)
+	}
+	return mean, math.Sqrt(squares/float64(len(measurements)-1)) / mean
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"cloud-benchmark-tool/common"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewPilotLimits(t *testing.T) {
+	limits, err := newPilotLimits(3, "1m30s", 0.05, "")
+	if err != nil || limits.Runs != 3 || limits.MaxExecTime != 90*time.Second || limits.MaxCv != 0.05 || limits.Action != PILOT_ACTION_FLAG {
+		t.Errorf("newPilotLimits = %+v, %v, want 3 runs, 1m30s, cv 0.05, action flag", limits, err)
+	}
+	for _, invalid := range []struct{ time, action string }{{"90", PILOT_ACTION_DROP}, {"", "skip"}} {
+		if _, err := newPilotLimits(1, invalid.time, 0, invalid.action); err == nil {
+			t.Errorf("newPilotLimits(%q, %q) returned no error", invalid.time, invalid.action)
+		}
+	}
+}
+
+func TestPilotLimitsCheck(t *testing.T) {
+	limits := &pilotLimits{MaxExecTime: time.Second, MaxCv: 0.1}
+	tests := []struct {
+		name    string
+		result  pilotResult
+		reasons int
+	}{
+		{"within limits", pilotResult{ExecTime: time.Second, Cv: 0.1, Samples: 3}, 0},
+		{"slow", pilotResult{ExecTime: 2 * time.Second, Cv: 0.05, Samples: 3}, 1},
+		{"unstable and slow", pilotResult{ExecTime: 2 * time.Second, Cv: 0.2, Samples: 3}, 2},
+		{"no measurements", pilotResult{ExecTime: time.Second}, 1},
+	}
+	for _, test := range tests {
+		if reasons := limits.check(&test.result); len(reasons) != test.reasons {
+			t.Errorf("%s: check = %v, want %d reasons", test.name, reasons, test.reasons)
+		}
+	}
+	if reasons := (&pilotLimits{}).check(&pilotResult{ExecTime: time.Hour, Cv: 1, Samples: 1}); len(reasons) != 0 {
+		t.Errorf("check without limits = %v, want no reasons", reasons)
+	}
+}
+
+func TestCoefficientOfVariation(t *testing.T) {
+	tests := []struct {
+		values   []float64
+		mean, cv float64
+	}{
+		{nil, 0, 0},
+		{[]float64{10}, 10, 0},
+		{[]float64{10, 20, 30}, 20, 0.5},
+		{[]float64{0, 0}, 0, 0},
+	}
+	for _, test := range tests {
+		measurements := make([]common.Measurement, 0, len(test.values))
+		for _, v := range test.values {
+			measurements = append(measurements, common.Measurement{NsPerOp: v})
+		}
+		mean, cv := coefficientOfVariation(measurements)
+		if mean != test.mean || math.Abs(cv-test.cv) > 1e-12 {
+			t.Errorf("coefficientOfVariation(%v) = %f, %f, want %f, %f", test.values, mean, cv, test.mean, test.cv)
+		}
+	}
+}
+
+// TestRunPilot runs the benchmarks of testdata/pilot in a git repository, and checks that the pilot runs on the planned
+// commit, applies the isolation settings, drops the failing benchmark, and restores the previous checkout.
+func TestRunPilot(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go test")
+	}
+	projPath := pilotRepository(t)
+	openMigratedDB(t, "")
+
+	// main moves after planning, the pilot still runs on the planned commit
+	planned, err := resolveCommit(projPath, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, projPath, "rm", "-q", "pilot_test.go")
+	runGit(t, projPath, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "remove benchmarks")
+	revisions := []revision{{Label: "main", Commit: planned}, {Label: "v2", Commit: planned}}
+
+	iso := common.Isolation{GoMaxProcs: 2, Nice: 5}
+	if _, err := exec.LookPath("taskset"); err == nil {
+		iso.CpuSet = "0"
+		t.Setenv("CBT_PILOT_CPUS", "0")
+	}
+	iso.Validate()
+	current, err := exec.Command("nice").Output()
+	if err != nil {
+		t.Skipf("nice not available: %v", err)
+	}
+	niceness, _ := strconv.Atoi(strings.TrimSpace(string(current)))
+	t.Setenv("CBT_PILOT_GOMAXPROCS", "2")
+	t.Setenv("CBT_PILOT_NICENESS", strconv.Itoa(min(niceness+5, 19)))
+
+	benchmarks := []common.Benchmark{
+		{Name: "BenchmarkIsolated", NameRegexp: common.MaskNameRegexp("BenchmarkIsolated"), Package: "./", Module: "./", ProjectPath: projPath},
+		{Name: "BenchmarkFailing", NameRegexp: common.MaskNameRegexp("BenchmarkFailing"), Package: "./", Module: "./", ProjectPath: projPath},
+		{Name: "BenchmarkLater", Package: "./", Module: "./", ProjectPath: projPath, Tags: []string{"v2"}},
+	}
+	limits := &pilotLimits{Runs: 1, Action: PILOT_ACTION_DROP}
+	kept, err := runPilot("pilot", projPath, revisions, benchmarks, limits, &iso, 1, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(kept) != 2 || kept[0].Name != "BenchmarkIsolated" || kept[1].Name != "BenchmarkLater" {
+		t.Errorf("runPilot kept %v, want BenchmarkIsolated and BenchmarkLater", kept)
+	}
+	if len(kept) > 0 && len(kept[0].Measurement) != 0 {
+		t.Errorf("pilot measurements were added to the experiment: %v", kept[0].Measurement)
+	}
+	rows, err := db.Query(`SELECT b_name, tag, flagged, reason FROM pilot ORDER BY b_name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var pilots []string
+	for rows.Next() {
+		var name, tag, reason string
+		var flagged bool
+		if err := rows.Scan(&name, &tag, &flagged, &reason); err != nil {
+			t.Fatal(err)
+		}
+		pilots = append(pilots, name+" "+tag+" "+strconv.FormatBool(flagged)+" "+reason)
+	}
+	want := []string{"BenchmarkFailing main true failed in pilot run", "BenchmarkIsolated main false "}
+	if strings.Join(pilots, "\n") != strings.Join(want, "\n") {
+		t.Errorf("pilot rows %q, want %q", pilots, want)
+	}
+
+	if checkout, err := currentCheckout(projPath); err != nil || checkout != "main" {
+		t.Errorf("checkout after the pilot %s (%v), want main", checkout, err)
+	}
+}
+
+// pilotRepository copies testdata/pilot into a git repository with main checked out.
+func pilotRepository(t *testing.T) string {
+	t.Helper()
+	projPath := t.TempDir()
+	for _, name := range []string{"go.mod", "pilot_test.go"} {
+		data, err := os.ReadFile(filepath.Join("testdata/pilot", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(projPath, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runGit(t, projPath, "init", "-q", "-b", "main")
+	runGit(t, projPath, "add", "-A")
+	runGit(t, projPath, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "pilot")
+	return projPath
+}
+
+// runGit runs a git command in dir and returns its output.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+	return string(out)
+}
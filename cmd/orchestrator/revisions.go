@@ -0,0 +1,250 @@
+package main
+
+import (
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/mod/semver"
+)
+
+type (
+	// revision is a single revision to benchmark, expanded from an entry of the tags config.
+	revision struct {
+		Label    string // name used in the DB and logs, e.g., the tag, branch or abbreviated SHA
+		Commit   string // full SHA the label resolved to at plan time
+		Selector string // config entry the revision was expanded from
+	}
+
+	// semverConstraint is a single comparison of a semver selector, e.g., >=v1.2.0.
+	semverConstraint struct {
+		Op      string
+		Version string
+	}
+)
+
+// SHORT_SHA_LENGTH is the length of the labels of revisions expanded from commit ranges.
+const SHORT_SHA_LENGTH = 12
+
+var semverOps = []string{">=", "<=", "!=", ">", "<", "="}
+
+// expandRevisions turns the tags config into the ordered list of revisions. Entries can be tags, branches, commit SHAs,
+// other refs such as refs/pull/N/head (fetched from origin if missing), ranges A..B and semver selectors like ">=v1.2.0 <v2".
+// Symmetric difference ranges A...B are rejected.
+// A range of two full semver versions expands to all release tags in between, including both ends, otherwise to A followed by the
+// first-parent commits of A..B. Semver selectors expand to all matching release tags. Expansions are ordered ascending,
+// entries keep the order of the config, so the first revision is the baseline. Every label resolves to a commit at
+// plan time, which is what runners check out, so moving branches do not change the experiment.
+func expandRevisions(projPath string, selectors []string) ([]revision, error) {
+	revisions := make([]revision, 0, len(selectors))
+	seen := make(map[string]bool)
+	var tags []string
+
+	for _, selector := range selectors {
+		selector = strings.TrimSpace(selector)
+		var labels []string
+		var err error
+
+		switch {
+		case isSemverSelector(selector):
+			if tags == nil {
+				tags, err = listTags(projPath)
+				if err != nil {
+					return nil, err
+				}
+			}
+			labels, err = semverSelect(tags, selector)
+		case strings.Contains(selector, "..."):
+			err = errors.New("symmetric difference ranges A...B are not supported, use A..B")
+		case strings.Contains(selector, ".."):
+			from, to, _ := strings.Cut(selector, "..")
+			if isVersionTag(from) && isVersionTag(to) {
+				if tags == nil {
+					tags, err = listTags(projPath)
+					if err != nil {
+						return nil, err
+					}
+				}
+				labels, err = semverSelect(tags, ">="+from+" <="+to)
+				// pre-releases are only included as explicit ends of the range
+				if semver.Prerelease(from) != "" {
+					labels = append([]string{from}, labels...)
+				}
+				if semver.Prerelease(to) != "" {
+					labels = append(labels, to)
+				}
+			} else {
+				labels, err = commitRange(projPath, from, to)
+			}
+		default:
+			labels = []string{selector}
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "expanding %q", selector)
+		}
+		if len(labels) == 0 {
+			log.Warnf("Revision selector %q matches no revisions", selector)
+		}
+
+		for _, label := range labels {
+			if seen[label] {
+				continue
+			}
+			seen[label] = true
+
+			commit, err := resolveRevision(projPath, label)
+			if err != nil {
+				return nil, errors.Wrapf(err, "expanding %q", selector)
+			}
+			revisions = append(revisions, revision{Label: label, Commit: commit, Selector: selector})
+			log.Debugf("Revision %s (%s) from %q", label, commit, selector)
+		}
+	}
+
+	if len(revisions) == 0 {
+		return nil, errors.New("no revisions to benchmark")
+	}
+	return revisions, nil
+}
+
+// resolveRevision returns the commit of the revision. Refs missing locally, e.g., refs/pull/N/head, are fetched from origin.
+func resolveRevision(projPath string, rev string) (string, error) {
+	commit, err := resolveCommit(projPath, rev)
+	if err == nil || !strings.HasPrefix(rev, "refs/") {
+		return commit, err
+	}
+
+	log.Debugf("Fetching %s from origin", rev)
+	fetch := exec.Command("git", "fetch", "origin", "+"+rev+":"+rev)
+	fetch.Dir = projPath
+	out, fetchErr := fetch.CombinedOutput()
+	if fetchErr != nil {
+		return "", errors.Wrapf(fetchErr, "%#v: output: %s", fetch.Args, out)
+	}
+	return resolveCommit(projPath, rev)
+}
+
+// listTags returns all tags of the repository.
+func listTags(projPath string) ([]string, error) {
+	cmd := exec.Command("git", "tag", "--list")
+	cmd.Dir = projPath
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "%#v", cmd.Args)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// commitRange returns from followed by the first-parent commits of from..to, oldest first, labeled by their abbreviated SHA.
+func commitRange(projPath string, from string, to string) ([]string, error) {
+	cmd := exec.Command("git", "rev-list", "--reverse", "--first-parent", from+".."+to)
+	cmd.Dir = projPath
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, errors.Wrapf(err, "%#v: output: %s", cmd.Args, out)
+	}
+
+	labels := []string{from}
+	for _, sha := range strings.Fields(string(out)) {
+		if len(sha) > SHORT_SHA_LENGTH {
+			sha = sha[:SHORT_SHA_LENGTH]
+		}
+		labels = append(labels, sha)
+	}
+	return labels, nil
+}
+
+// isSemverSelector reports whether the entry is a list of semver comparisons.
+func isSemverSelector(selector string) bool {
+	for _, op := range semverOps {
+		if strings.HasPrefix(selector, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// isVersionTag reports whether the tag is a full semver version, e.g., v1.2.0 but not v1.2.
+func isVersionTag(tag string) bool {
+	version, _, _ := strings.Cut(tag, "+")
+	return semver.IsValid(tag) && semver.Canonical(tag) == version
+}
+
+// semverSelect returns the release tags (no pre-releases) matching all space separated constraints, in semver order.
+// Versions may be incomplete, e.g., <v2 means <v2.0.0.
+func semverSelect(tags []string, selector string) ([]string, error) {
+	constraints := make([]semverConstraint, 0, 2)
+	for _, part := range strings.Fields(selector) {
+		parsed := false
+		for _, op := range semverOps {
+			if strings.HasPrefix(part, op) {
+				version := strings.TrimPrefix(part, op)
+				if !semver.IsValid(version) {
+					return nil, errors.Errorf("invalid version %q in semver selector", version)
+				}
+				constraints = append(constraints, semverConstraint{Op: op, Version: version})
+				parsed = true
+				break
+			}
+		}
+		if !parsed {
+			return nil, errors.Errorf("invalid constraint %q in semver selector", part)
+		}
+	}
+
+	matches := make([]string, 0)
+	for _, tag := range tags {
+		if !isVersionTag(tag) || semver.Prerelease(tag) != "" {
+			continue
+		}
+		matching := true
+		for _, c := range constraints {
+			matching = matching && c.matches(tag)
+		}
+		if matching {
+			matches = append(matches, tag)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return semver.Compare(matches[i], matches[j]) < 0 })
+	return matches, nil
+}
+
+// matches compares the version against the constraint.
+func (c *semverConstraint) matches(version string) bool {
+	cmp := semver.Compare(version, c.Version)
+	switch c.Op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	default:
+		return cmp == 0
+	}
+}
+
+// revisionLabels returns the labels of the revisions.
+func revisionLabels(revisions []revision) []string {
+	labels := make([]string, 0, len(revisions))
+	for _, r := range revisions {
+		labels = append(labels, r.Label)
+	}
+	return labels
+}
+
+// revisionCommits returns the commits of the revisions.
+func revisionCommits(revisions []revision) []string {
+	commits := make([]string, 0, len(revisions))
+	for _, r := range revisions {
+		commits = append(commits, r.Commit)
+	}
+	return commits
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIsVersionTag(t *testing.T) {
+	tests := map[string]bool{
+		"v1.2.0":           true,
+		"v0.0.1":           true,
+		"v1.2.0-rc.1":      true,
+		"v1.2.0+build.5":   true,
+		"v1.2.0-rc.1+meta": true,
+		"v1.2":             false,
+		"v1":               false,
+		"1.2.0":            false,
+		"v1.02.0":          false,
+		"main":             false,
+		"":                 false,
+	}
+	for tag, want := range tests {
+		if got := isVersionTag(tag); got != want {
+			t.Errorf("isVersionTag(%q) = %t, want %t", tag, got, want)
+		}
+	}
+}
+
+func TestSemverSelect(t *testing.T) {
+	tags := []string{"v2.0.0", "v1.10.0", "v1.2.0", "v1.2.1", "v1.3.0-rc.1", "v1.9", "main", "v0.9.0", "v1.2.0+meta"}
+	tests := []struct {
+		selector string
+		want     []string
+	}{
+		{">=v1.2.0 <v2", []string{"v1.2.0", "v1.2.0+meta", "v1.2.1", "v1.10.0"}},
+		{">v1.2.0", []string{"v1.2.1", "v1.10.0", "v2.0.0"}},
+		{"<=v1.2.1 !=v1.2.0", []string{"v0.9.0", "v1.2.1"}},
+		{"=v2.0.0", []string{"v2.0.0"}},
+		// pre-releases and incomplete versions are never selected
+		{">=v1.3.0-rc.1 <v1.4", []string{}},
+		{">v3", []string{}},
+	}
+	for _, test := range tests {
+		got, err := semverSelect(tags, test.selector)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("semverSelect(%q) = %v, %v, want %v", test.selector, got, err, test.want)
+		}
+	}
+
+	for _, invalid := range []string{">=1.2.0", ">=v1.2.0 v2", "~v1.2"} {
+		if _, err := semverSelect(tags, invalid); err == nil {
+			t.Errorf("semverSelect(%q) returned no error", invalid)
+		}
+	}
+}
+
+// TestExpandRevisions expands selectors in a repository with release tags, and checks labels and resolved commits.
+func TestExpandRevisions(t *testing.T) {
+	projPath := t.TempDir()
+	runGit(t, projPath, "init", "-q", "-b", "main")
+	commits := make(map[string]string)
+	for _, tag := range []string{"v1.0.0", "v1.1.0-rc.1", "v1.1.0", "v1.2.0", ""} {
+		if err := os.WriteFile(filepath.Join(projPath, "version"), []byte(tag+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, projPath, "add", "-A")
+		runGit(t, projPath, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "release "+tag)
+		if tag != "" {
+			runGit(t, projPath, "tag", tag)
+		}
+		commits[tag] = strings.TrimSpace(runGit(t, projPath, "rev-parse", "HEAD"))
+	}
+
+	tests := []struct {
+		selectors []string
+		labels    []string
+	}{
+		{[]string{"v1.0.0..v1.2.0"}, []string{"v1.0.0", "v1.1.0", "v1.2.0"}},
+		{[]string{"v1.1.0-rc.1..v1.2.0"}, []string{"v1.1.0-rc.1", "v1.1.0", "v1.2.0"}},
+		{[]string{">=v1.1.0", "main", "v1.2.0"}, []string{"v1.1.0", "v1.2.0", "main"}},
+		{[]string{"v1.2.0..main"}, []string{"v1.2.0", commits[""][:SHORT_SHA_LENGTH]}},
+	}
+	for _, test := range tests {
+		revisions, err := expandRevisions(projPath, test.selectors)
+		if err != nil {
+			t.Fatalf("expandRevisions(%v): %v", test.selectors, err)
+		}
+		if labels := revisionLabels(revisions); !reflect.DeepEqual(labels, test.labels) {
+			t.Errorf("expandRevisions(%v) = %v, want %v", test.selectors, labels, test.labels)
+		}
+		for _, r := range revisions {
+			want := commits[r.Label]
+			if r.Label == "main" || !strings.HasPrefix(r.Label, "v") {
+				want = commits[""]
+			}
+			if r.Commit != want {
+				t.Errorf("revision %s resolved to %s, want %s", r.Label, r.Commit, want)
+			}
+		}
+	}
+
+	for _, invalid := range [][]string{{"v1.0.0...v1.2.0"}, {"main...v1.0.0"}, {"missing"}, {">=v3"}} {
+		if revisions, err := expandRevisions(projPath, invalid); err == nil {
+			t.Errorf("expandRevisions(%v) = %v, want an error", invalid, revisions)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cloud-benchmark-tool/common"
 	_ "embed"
 	"fmt"
 	"strings"
@@ -12,6 +13,7 @@ var runnerBytes []byte
 func generateStartupScript(
 	projUri string,
 	tags []string,
+	commits []string,
 	basePackage string,
 	bed int,
 	iterations int,
@@ -22,8 +24,11 @@ func generateStartupScript(
 	projectName string,
 	bucketName string,
 	genPprof bool,
+	profiles []string,
+	profileSampling float64,
 	envs []string,
 	commands []string,
+	isolation common.Isolation,
 ) []byte {
 
 	scriptFormatString := `#!/bin/bash
@@ -40,9 +45,10 @@ run_benchmark_runner() {
 	git config --global --add safe.directory '*'
 	cd proj
 	git fetch --all --tags
-	git checkout tags/%s
+	for c in %s; do git cat-file -e $c^{commit} 2>/dev/null || git fetch origin $c; done
+	git checkout %s
 	cd ..
-    ./runner -path $WORK_DIR/proj -logfile -tags %s -base-package %s -bed %d -iterations %d -sr %d -orchestrator-ip %s -benchmark-list-port %s -measurement-report-port %s -project-name %s -bucket-name %s -generate-pprof=%t -envs %s -commands %s
+    ./runner -path $WORK_DIR/proj -logfile -tags %s -commits %s -base-package %s -bed %d -iterations %d -sr %d -orchestrator-ip %s -benchmark-list-port %s -measurement-report-port %s -project-name %s -bucket-name %s -generate-pprof=%t -profiles=%s -profile-sampling %g -envs %s -commands %s -cpu-set=%s -runner-cpu-set=%s -gomaxprocs %d -nice %d
     # do something with the extracted content
 }
 
@@ -64,8 +70,10 @@ __PAYLOAD_BEGINS__
 	return append([]byte(fmt.Sprintf(
 		scriptFormatString,
 		projUri,
-		tags[0],
+		strings.Join(commits, " "),
+		commits[0],
 		strings.Join(tags, ","),
+		strings.Join(commits, ","),
 		basePackage,
 		bed,
 		iterations,
@@ -76,6 +84,12 @@ __PAYLOAD_BEGINS__
 		projectName,
 		bucketName,
 		genPprof,
+		strings.Join(profiles, ","),
+		profileSampling,
 		strings.Join(envs, ","),
-		strings.Join(commands, ","))), runnerBytes...)
+		strings.Join(commands, ","),
+		isolation.CpuSet,
+		isolation.RunnerCpuSet,
+		isolation.GoMaxProcs,
+		isolation.Nice)), runnerBytes...)
 }
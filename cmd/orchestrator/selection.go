@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cloud-benchmark-tool/common"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Selection modes, all schedules every benchmark, changed only those reaching code changed since tags[0]
+const (
+	SELECTION_ALL     = "all"
+	SELECTION_CHANGED = "changed"
+)
+
+type (
+	// revisionDiff holds the changes between two revisions, as changed lines of the new revision per file.
+	revisionDiff struct {
+		Lines   map[string][]int // absolute file name -> changed lines, deleted files have no lines
+		Modules []string         // changed go.mod, go.sum and go.work files
+	}
+
+	// selectionResult explains why a benchmark is scheduled for a tag or not.
+	selectionResult struct {
+		Selected bool
+		Reason   string
+	}
+)
+
+var regexHunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// selectChangedBenchmarks keeps the benchmarks that reach code changed between revisions[0] and any of the other revisions.
+// For every benchmark and revision the decision is logged and stored in the DB, including the call path to the
+// changed function. Revisions are diffed and checked out by their commits, the project is left checked out on revisions[0].
+func selectChangedBenchmarks(projName string, projPath string, revisions []revision, benchmarks []common.Benchmark) ([]common.Benchmark, error) {
+	if len(revisions) < 2 {
+		log.Warn("Selection of changed benchmarks needs at least two tags, scheduling all benchmarks")
+		return benchmarks, nil
+	}
+
+	projPath, err := filepath.Abs(projPath)
+	if err != nil {
+		return nil, err
+	}
+	base := revisions[0].Label
+	selected := make([]bool, len(benchmarks))
+
+	for _, r := range revisions[1:] {
+		head := r.Label
+		diff, err := diffRevisions(projPath, revisions[0].Commit, r.Commit)
+		if err != nil {
+			return nil, err
+		}
+
+		err = checkoutTag(projPath, r.Commit)
+		if err != nil {
+			return nil, err
+		}
+		modules, err := findModules(projPath)
+		if err != nil {
+			return nil, err
+		}
+		graph, err := buildCallGraph(projPath, modules)
+		if err != nil {
+			return nil, errors.Wrapf(err, "building call graph of tag %s", head)
+		}
+		changed := graph.changedFuncs(projPath, diff)
+		log.Debugf("%d functions changed between %s and %s", len(changed), base, head)
+
+		results := make(map[string]selectionResult) // benchmark functions share the result
+		for i, b := range benchmarks {
+			if !containsString(b.Tags, head) {
+				continue
+			}
+
+			var result selectionResult
+			function := common.ParseBenchmarkName(b.Name, 1).Function
+			if !containsString(b.Tags, base) {
+				result = selectionResult{Selected: true, Reason: "benchmark does not exist on " + base}
+			} else if len(diff.Modules) > 0 {
+				result = selectionResult{Selected: true, Reason: "dependencies changed in " + strings.Join(diff.Modules, ", ")}
+			} else if cached, ok := results[b.ProjectPackage()+" "+function]; ok {
+				result = cached
+			} else {
+				result = graph.selectBenchmark(&b, function, changed)
+				results[b.ProjectPackage()+" "+function] = result
+			}
+
+			selected[i] = selected[i] || result.Selected
+			log.Infof("Benchmark %s in %s selected for %s: %t, %s", b.Name, b.ProjectPackage(), head, result.Selected, result.Reason)
+			insertSelection(b.Name, b.ProjectPackage(), projName, base, head, result.Selected, result.Reason)
+		}
+	}
+
+	err = checkoutTag(projPath, revisions[0].Commit)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make([]common.Benchmark, 0, len(benchmarks))
+	for i, b := range benchmarks {
+		if selected[i] {
+			kept = append(kept, b)
+		}
+	}
+	log.Infof("Selected %d of %d benchmarks reaching changed code", len(kept), len(benchmarks))
+	return kept, nil
+}
+
+// selectBenchmark searches the call graph from the benchmark function, which is either declared in the
+// package itself or in its external test package.
+func (graph *callGraph) selectBenchmark(bench *common.Benchmark, function string, changed map[string]bool) selectionResult {
+	importPath := bench.ModulePath + strings.TrimSuffix(strings.TrimPrefix(bench.Package, "."), "/")
+
+	key := importPath + "." + function
+	if _, ok := graph.Funcs[key]; !ok {
+		key = importPath + "_test." + function
+	}
+	if _, ok := graph.Funcs[key]; !ok {
+		return selectionResult{Selected: true, Reason: "benchmark function not found in call graph"}
+	}
+
+	path, reachable := graph.reach(key, changed)
+	if path == nil {
+		return selectionResult{Selected: false, Reason: "none of " + strconv.Itoa(reachable) + " reachable functions changed"}
+	}
+	return selectionResult{Selected: true, Reason: "reaches changed " + path[len(path)-1] + " via " + strings.Join(path, " -> ")}
+}
+
+// changedFuncs maps the changed lines to the functions declared there. Changes outside of functions, e.g.,
+// to types, constants or embedded files, mark all functions of the package in that directory as changed.
+func (graph *callGraph) changedFuncs(projPath string, diff *revisionDiff) map[string]bool {
+	changed := make(map[string]bool)
+	for file, lines := range diff.Lines {
+		if strings.HasSuffix(file, ".md") {
+			continue
+		}
+
+		inFuncs := strings.HasSuffix(file, ".go") && len(lines) > 0
+		for _, line := range lines {
+			found := false
+			for _, fn := range graph.Files[file] {
+				if line >= fn.Start && line <= fn.End {
+					changed[fn.Key] = true
+					found = true
+				}
+			}
+			inFuncs = inFuncs && found
+		}
+		if inFuncs {
+			continue
+		}
+
+		// mark the package of the nearest directory containing Go code
+		for dir := filepath.Dir(file); strings.HasPrefix(dir, projPath); dir = filepath.Dir(dir) {
+			if pkgFuncs := graph.dirFuncs(dir); len(pkgFuncs) > 0 {
+				for _, key := range pkgFuncs {
+					changed[key] = true
+				}
+				break
+			}
+			if dir == projPath {
+				break
+			}
+		}
+	}
+	return changed
+}
+
+// dirFuncs returns the functions declared in the directory, including those of test files.
+func (graph *callGraph) dirFuncs(dir string) []string {
+	keys := make([]string, 0)
+	for file, funcs := range graph.Files {
+		if filepath.Dir(file) != dir {
+			continue
+		}
+		for _, fn := range funcs {
+			keys = append(keys, fn.Key)
+		}
+	}
+	return keys
+}
+
+// diffRevisions lists the lines changed between two revisions of the project. Removed lines are attributed to
+// the surrounding lines of the new revision, renames are treated as deletion and addition.
+func diffRevisions(projPath string, base string, head string) (*revisionDiff, error) {
+	cmd := exec.Command("git", "diff", "-U0", "--no-renames", "--no-color", "--relative", base, head, "--")
+	cmd.Dir = projPath
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "%#v", cmd.Args)
+	}
+
+	diff := &revisionDiff{Lines: make(map[string][]int)}
+	file := ""
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "--- a/"):
+			// kept for deleted files, whose new name is /dev/null
+			file = filepath.Join(projPath, strings.TrimPrefix(line, "--- a/"))
+		case strings.HasPrefix(line, "+++ b/"):
+			file = filepath.Join(projPath, strings.TrimPrefix(line, "+++ b/"))
+		case strings.HasPrefix(line, "+++ /dev/null"):
+			// deleted file, the whole package is considered changed
+		case strings.HasPrefix(line, "--- /dev/null"):
+			file = ""
+		default:
+			match := regexHunkHeader.FindStringSubmatch(line)
+			if match == nil || file == "" {
+				continue
+			}
+			start, _ := strconv.Atoi(match[1])
+			count := 1
+			if match[2] != "" {
+				count, _ = strconv.Atoi(match[2])
+			}
+			if count == 0 {
+				// pure deletion after line start
+				diff.Lines[file] = append(diff.Lines[file], start, start+1)
+				continue
+			}
+			for l := start; l < start+count; l++ {
+				diff.Lines[file] = append(diff.Lines[file], l)
+			}
+			continue
+		}
+
+		if file != "" {
+			if _, ok := diff.Lines[file]; !ok {
+				diff.Lines[file] = []int{}
+			}
+			switch filepath.Base(file) {
+			case "go.mod", "go.sum", "go.work", "go.work.sum":
+				rel, _ := filepath.Rel(projPath, file)
+				if !containsString(diff.Modules, rel) {
+					diff.Modules = append(diff.Modules, rel)
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "reading git diff")
+	}
+	return diff, nil
+}
+
+// containsString checks whether the list contains the element.
+func containsString(list []string, elem string) bool {
+	for _, e := range list {
+		if e == elem {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"cloud-benchmark-tool/api"
+	"cloud-benchmark-tool/common"
+	"cloud-benchmark-tool/stats"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// apiHandler answers a GET request of an endpoint with the value encoded as JSON.
+	apiHandler func(r *http.Request) (any, error)
+
+	// apiError is an error answered with a status other than 500.
+	apiError struct {
+		status int
+		err    error
+	}
+)
+
+func (e *apiError) Error() string {
+	return e.err.Error()
+}
+
+// badRequest wraps an error caused by the parameters of a request.
+func badRequest(err error) error {
+	return &apiError{status: http.StatusBadRequest, err: err}
+}
+
+// serveCommand serves the read-only HTTP/JSON API over the results database, see package api.
+// SQLite databases are opened with query_only, so they can be served while an experiment writes to them.
+func serveCommand(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	dbConfig := dbFlags(fs)
+	addr := fs.String("addr", "localhost:8080", "Address the API listens on.")
+	fs.Parse(args)
+
+	if dbConfig.Type != DB_POSTGRES {
+		separator := "?"
+		if strings.Contains(dbConfig.Uri, "?") {
+			separator = "&"
+		}
+		dbConfig.Uri += separator + "_pragma=query_only(1)"
+	}
+	openDB(dbConfig)
+	defer CloseDB()
+	requireLatestSchema()
+
+	fmt.Fprintf(os.Stderr, "serving the API on http://%s%s\n", *addr, api.PATH_PROJECTS)
+	if err := http.ListenAndServe(*addr, newAPIHandler()); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// newAPIHandler routes the endpoints of the API.
+func newAPIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(api.PATH_PROJECTS, apiHandler(serveProjects))
+	mux.Handle(api.PATH_EXPERIMENTS, apiHandler(serveExperiments))
+	mux.Handle(api.PATH_EXPERIMENTS+"/", apiHandler(serveExperiment))
+	mux.Handle(api.PATH_BENCHMARKS, apiHandler(serveBenchmarks))
+	mux.Handle(api.PATH_TAGS, apiHandler(serveTags))
+	mux.Handle(api.PATH_MEASUREMENTS, apiHandler(serveMeasurements))
+	mux.Handle(api.PATH_STATS, apiHandler(serveStats))
+	return mux
+}
+
+// ServeHTTP only accepts GET requests, and answers errors with their status and an api.Error body.
+func (handler apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, api.Error{Error: "the API is read-only"})
+		return
+	}
+
+	v, err := handler(r)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if e, ok := err.(*apiError); ok {
+			status = e.status
+		} else {
+			log.Errorf("%s: %v", r.URL, err)
+		}
+		writeJSON(w, status, api.Error{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debugf("Could not write response: %v", err)
+	}
+}
+
+// parseQuery reads the filters and the page of a request, see api.Query.
+func parseQuery(values url.Values) (*exportFilter, api.Page, error) {
+	page := api.Page{Limit: api.DEFAULT_LIMIT}
+	filter, err := newExportFilter(values["experiment"], values.Get("project"), values["tag"], values["bench"])
+	if err != nil {
+		return nil, page, badRequest(err)
+	}
+	if limit := values.Get("limit"); limit != "" {
+		page.Limit, err = strconv.Atoi(limit)
+		if err != nil || page.Limit < 1 || page.Limit > api.MAX_LIMIT {
+			return nil, page, badRequest(errors.Errorf("limit has to be between 1 and %d", api.MAX_LIMIT))
+		}
+	}
+	if offset := values.Get("offset"); offset != "" {
+		page.Offset, err = strconv.Atoi(offset)
+		if err != nil || page.Offset < 0 {
+			return nil, page, badRequest(errors.New("offset has to be a non-negative number"))
+		}
+	}
+	return filter, page, nil
+}
+
+// pageBounds returns the slice of a list of total items on the page, and sets the total of the page.
+func pageBounds(page *api.Page, total int) (int, int) {
+	page.Total = total
+	start := page.Offset
+	if start > total {
+		start = total
+	}
+	end := start + page.Limit
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+func serveProjects(r *http.Request) (any, error) {
+	filter, page, err := parseQuery(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT p.p_name, p.base_package,
+			(SELECT COUNT(*) FROM experiment e WHERE e.p_name = p.p_name),
+			(SELECT COUNT(*) FROM benchmark b WHERE b.p_name = p.p_name)
+		FROM project p`
+	params := make([]any, 0)
+	if filter.Project != "" {
+		query += ` WHERE p.p_name = ?`
+		params = append(params, filter.Project)
+	}
+	rows, err := db.Query(query+` ORDER BY p.p_name`, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := make([]api.Project, 0)
+	for rows.Next() {
+		var p api.Project
+		if err := rows.Scan(&p.Name, &p.BasePackage, &p.Experiments, &p.Benchmarks); err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+	start, end := pageBounds(&page, len(projects))
+	return api.ProjectPage{Page: page, Items: projects[start:end]}, rows.Err()
+}
+
+// experimentColumns are the columns of api.Experiment in experiment e, config and args are only selected for single experiments.
+const experimentColumns = `e.e_id, e.p_name, e.status, e.started_at, e.finished_at, e.orchestrator_version, e.runner_version,
+	e.bed_setup, e.it_setup, e.sr_setup, e.ir_setup, e.origin, e.source,
+	(SELECT COUNT(*) FROM measurement m WHERE m.e_id = e.e_id)`
+
+func serveExperiments(r *http.Request) (any, error) {
+	values := r.URL.Query()
+	filter, page, err := parseQuery(values)
+	if err != nil {
+		return nil, err
+	}
+	conditions := make([]string, 0)
+	params := make([]any, 0)
+	if filter.Project != "" {
+		conditions = append(conditions, "e.p_name = ?")
+		params = append(params, filter.Project)
+	}
+	if len(filter.Experiments) > 0 {
+		conditions = append(conditions, "e.e_id IN ("+placeholders(len(filter.Experiments))+")")
+		for _, e := range filter.Experiments {
+			params = append(params, e)
+		}
+	}
+	for _, column := range []string{"status", "origin"} {
+		if value := values.Get(column); value != "" {
+			conditions = append(conditions, "e."+column+" = ?")
+			params = append(params, value)
+		}
+	}
+	query := `SELECT ` + experimentColumns + ` FROM experiment e`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	rows, err := db.Query(query+` ORDER BY e.e_id`, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	experiments := make([]api.Experiment, 0)
+	for rows.Next() {
+		var e api.Experiment
+		if err := scanExperiment(rows, &e); err != nil {
+			return nil, err
+		}
+		experiments = append(experiments, e)
+	}
+	start, end := pageBounds(&page, len(experiments))
+	return api.ExperimentPage{Page: page, Items: experiments[start:end]}, rows.Err()
+}
+
+func serveExperiment(r *http.Request) (any, error) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, api.PATH_EXPERIMENTS+"/"), 10, 64)
+	if err != nil {
+		return nil, &apiError{status: http.StatusNotFound, err: errors.Errorf("no experiment at %s", r.URL.Path)}
+	}
+	var e api.Experiment
+	row := db.QueryRow(`SELECT `+experimentColumns+`, e.config, e.args FROM experiment e WHERE e.e_id = ?`, id)
+	err = scanExperiment(row, &e, &e.Config, &e.Args)
+	if err == sql.ErrNoRows {
+		return nil, &apiError{status: http.StatusNotFound, err: errors.Errorf("experiment %d does not exist", id)}
+	}
+	e.Args = redactArgs(e.Args)
+	return e, err
+}
+
+// redactArgs redacts the database password in the argument snapshot of an experiment, experiments started before
+// the snapshot was redacted contain it. Arguments which cannot be decoded are not served.
+func redactArgs(args string) string {
+	if args == "" {
+		return args
+	}
+	var decoded map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(args), &decoded); err != nil {
+		log.Debugf("Invalid arguments of experiment: %v", err)
+		return ""
+	}
+	var dbUri string
+	if err := json.Unmarshal(decoded["DbUri"], &dbUri); err != nil || dbUri == "" {
+		return args
+	}
+	decoded["DbUri"], _ = json.Marshal(redactDbUri(dbUri))
+	redacted, err := json.Marshal(decoded)
+	if err != nil {
+		return ""
+	}
+	return string(redacted)
+}
+
+// scanExperiment scans the experimentColumns and the additional destinations.
+func scanExperiment(row interface{ Scan(dest ...any) error }, e *api.Experiment, dest ...any) error {
+	var startedAt, finishedAt sql.NullTime
+	err := row.Scan(append([]any{&e.Id, &e.Project, &e.Status, &startedAt, &finishedAt, &e.OrchestratorVersion, &e.RunnerVersion,
+		&e.BedSetup, &e.ItSetup, &e.SrSetup, &e.IrSetup, &e.Origin, &e.Source, &e.Measurements}, dest...)...)
+	if err != nil {
+		return err
+	}
+	e.StartedAt = startedAt.Time
+	if finishedAt.Valid {
+		e.FinishedAt = &finishedAt.Time
+	}
+	return nil
+}
+
+func serveBenchmarks(r *http.Request) (any, error) {
+	filter, page, err := parseQuery(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	conditions := make([]string, 0)
+	params := make([]any, 0)
+	if filter.Project != "" {
+		conditions = append(conditions, "b.p_name = ?")
+		params = append(params, filter.Project)
+	}
+	if len(filter.Tags) > 0 {
+		conditions = append(conditions, "b.bench_id IN (SELECT t.bench_id FROM benchmark_tag t WHERE t.tag IN ("+placeholders(len(filter.Tags))+"))")
+		for _, t := range filter.Tags {
+			params = append(params, t)
+		}
+	}
+	if len(filter.Experiments) > 0 {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM experiment_benchmark eb WHERE eb.e_id IN (`+placeholders(len(filter.Experiments))+`)
+			AND eb.b_name = b.b_name AND eb.subpackage = b.subpackage AND eb.p_name = b.p_name)`)
+		for _, e := range filter.Experiments {
+			params = append(params, e)
+		}
+	}
+	query := `SELECT b.bench_id, b.b_name, b.subpackage, b.p_name, b.module, b.function, COALESCE(b.config, ''), b.params, b.procs, b.labels FROM benchmark b`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	tags, err := selectBenchmarkTags()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(query+` ORDER BY b.p_name, b.subpackage, b.b_name`, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	benchmarks := make([]api.Benchmark, 0)
+	for rows.Next() {
+		var b api.Benchmark
+		var params, labels string
+		if err := rows.Scan(&b.Id, &b.Name, &b.Package, &b.Project, &b.Module, &b.Function, &b.Sub, &params, &b.Procs, &labels); err != nil {
+			return nil, err
+		}
+		if labels != "" {
+			b.Labels = strings.Split(labels, ",")
+		}
+		if filter.Benchmarks.excludedBy(&common.Benchmark{Name: b.Name, Package: b.Package, Annotations: common.Annotations{Labels: b.Labels}}) != "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(params), &b.Params); err != nil {
+			log.Debugf("Invalid params of benchmark %d: %v", b.Id, err)
+		}
+		b.Tags = tags[b.Id]
+		if b.Tags == nil {
+			b.Tags = make([]string, 0)
+		}
+		benchmarks = append(benchmarks, b)
+	}
+	start, end := pageBounds(&page, len(benchmarks))
+	return api.BenchmarkPage{Page: page, Items: benchmarks[start:end]}, rows.Err()
+}
+
+// selectBenchmarkTags returns the tags of all benchmarks by ID.
+func selectBenchmarkTags() (map[int64][]string, error) {
+	rows, err := db.Query(`SELECT bench_id, tag FROM benchmark_tag ORDER BY bench_id, tag`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := make(map[int64][]string)
+	for rows.Next() {
+		var benchId int64
+		var tag string
+		if err := rows.Scan(&benchId, &tag); err != nil {
+			return nil, err
+		}
+		tags[benchId] = append(tags[benchId], tag)
+	}
+	return tags, rows.Err()
+}
+
+func serveTags(r *http.Request) (any, error) {
+	filter, page, err := parseQuery(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT b.p_name, t.tag, COUNT(*) FROM benchmark_tag t JOIN benchmark b ON b.bench_id = t.bench_id`
+	params := make([]any, 0)
+	if filter.Project != "" {
+		query += ` WHERE b.p_name = ?`
+		params = append(params, filter.Project)
+	}
+	rows, err := db.Query(query+` GROUP BY b.p_name, t.tag ORDER BY b.p_name, t.tag`, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]api.Tag, 0)
+	for rows.Next() {
+		var t api.Tag
+		if err := rows.Scan(&t.Project, &t.Tag, &t.Benchmarks); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	start, end := pageBounds(&page, len(tags))
+	return api.TagPage{Page: page, Items: tags[start:end]}, rows.Err()
+}
+
+// MAX_MATCHED_BENCHMARKS is the number of benchmarks matching the rules of a measurement query up to which the
+// database applies the rules. With two bound variables per benchmark, queries stay below the variable limit of SQLite.
+const MAX_MATCHED_BENCHMARKS = 10000
+
+// measurementWhere returns the WHERE clause of the filter on measurement m. Benchmark rules are resolved
+// to the names and packages of the matching measured benchmarks, so that the database can page the result.
+// If more than MAX_MATCHED_BENCHMARKS match, the clause does not apply the benchmark rules and false is returned,
+// the caller then filters the rows with matchesBenchmarks.
+func measurementWhere(filter *exportFilter) (string, []any, bool, error) {
+	where, params := filter.where()
+	if len(filter.Benchmarks.Include) == 0 && len(filter.Benchmarks.Exclude) == 0 {
+		return where, params, true, nil
+	}
+
+	rows, err := db.Query(`SELECT DISTINCT m.b_name, COALESCE(m.subpackage, '') FROM measurement m`+where, params...)
+	if err != nil {
+		return "", nil, false, err
+	}
+	defer rows.Close()
+	matches := make([]string, 0)
+	matchParams := make([]any, 0)
+	for rows.Next() {
+		var bName, subPackage string
+		if err := rows.Scan(&bName, &subPackage); err != nil {
+			return "", nil, false, err
+		}
+		if matchesBenchmarks(filter, bName, subPackage) {
+			matches = append(matches, "(?, ?)")
+			matchParams = append(matchParams, bName, subPackage)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", nil, false, err
+	}
+	if len(matches) > MAX_MATCHED_BENCHMARKS {
+		return where, params, false, nil
+	}
+
+	// a row value list instead of OR terms, which nest deeper than SQLite's expression depth limit
+	condition := "1 = 0"
+	if len(matches) > 0 {
+		condition = "(m.b_name, COALESCE(m.subpackage, '')) IN (VALUES " + strings.Join(matches, ", ") + ")"
+	}
+	if where == "" {
+		return " WHERE " + condition, matchParams, true, nil
+	}
+	return where + " AND " + condition, append(params, matchParams...), true, nil
+}
+
+// matchesBenchmarks returns whether the measured benchmark matches the benchmark rules of the filter.
+func matchesBenchmarks(filter *exportFilter, bName string, subPackage string) bool {
+	return filter.Benchmarks.excludedBy(&common.Benchmark{Name: bName, Package: subPackage}) == ""
+}
+
+func serveMeasurements(r *http.Request) (any, error) {
+	filter, page, err := parseQuery(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	where, params, resolved, err := measurementWhere(filter)
+	if err != nil {
+		return nil, err
+	}
+	query := `SELECT m.m_id, m.e_id, m.bench_id, m.h_id, m.b_name, COALESCE(m.subpackage, ''), COALESCE(m.p_name, ''), m.tag,
+			m.n, m.ns_per_op, m.bed_setup, m.it_setup, m.sr_setup, m.ir_setup, m.bed_pos, m.it_pos, m.sr_pos, m.ir_pos, m.count_idx
+		FROM measurement m` + where + ` ORDER BY m.m_id`
+	if resolved {
+		if err := db.QueryRow(`SELECT COUNT(*) FROM measurement m`+where, params...).Scan(&page.Total); err != nil {
+			return nil, err
+		}
+		query += ` LIMIT ? OFFSET ?`
+		params = append(params, page.Limit, page.Offset)
+	}
+	rows, err := db.Query(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	measurements := make([]api.Measurement, 0)
+	for rows.Next() {
+		var m api.Measurement
+		var eId, benchId, hId sql.NullInt64
+		err := rows.Scan(&m.Id, &eId, &benchId, &hId, &m.Name, &m.Package, &m.Project, &m.Tag,
+			&m.N, &m.NsPerOp, &m.BedSetup, &m.ItSetup, &m.SrSetup, &m.IrSetup, &m.BedPos, &m.ItPos, &m.SrPos, &m.IrPos, &m.CountIndex)
+		if err != nil {
+			return nil, err
+		}
+		if !resolved && !matchesBenchmarks(filter, m.Name, m.Package) {
+			continue
+		}
+		m.ExperimentId, m.BenchmarkId, m.HostId = eId.Int64, benchId.Int64, hId.Int64
+		measurements = append(measurements, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !resolved {
+		start, end := pageBounds(&page, len(measurements))
+		measurements = measurements[start:end]
+	}
+	return api.MeasurementPage{Page: page, Items: measurements}, nil
+}
+
+func serveStats(r *http.Request) (any, error) {
+	filter, page, err := parseQuery(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+	where, params, resolved, err := measurementWhere(filter)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT COALESCE(m.p_name, ''), COALESCE(m.subpackage, ''), m.b_name, m.tag, m.ns_per_op FROM measurement m`+where+`
+		ORDER BY COALESCE(m.p_name, ''), COALESCE(m.subpackage, ''), m.b_name, m.tag`, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]api.Stats, 0)
+	var current api.Stats
+	values := make([]float64, 0)
+	for rows.Next() {
+		var s api.Stats
+		var nsPerOp float64
+		if err := rows.Scan(&s.Project, &s.Package, &s.Name, &s.Tag, &nsPerOp); err != nil {
+			return nil, err
+		}
+		if !resolved && !matchesBenchmarks(filter, s.Name, s.Package) {
+			continue
+		}
+		if s != current {
+			if len(values) > 0 {
+				items = append(items, summarize(current, values))
+			}
+			current = s
+			values = values[:0]
+		}
+		values = append(values, nsPerOp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(values) > 0 {
+		items = append(items, summarize(current, values))
+	}
+	start, end := pageBounds(&page, len(items))
+	return api.StatsPage{Page: page, Items: items[start:end]}, nil
+}
+
+// summarize computes the statistics of the values, the standard deviation is the sample standard deviation.
+func summarize(s api.Stats, values []float64) api.Stats {
+	s.Count = len(values)
+	s.Min, s.Max = values[0], values[0]
+	for _, v := range values {
+		s.Min, s.Max = math.Min(s.Min, v), math.Max(s.Max, v)
+	}
+	s.Median = stats.Median(values)
+	s.Mean = stats.Mean(values)
+	if s.Count > 1 {
+		s.StdDev = stats.StdDev(values)
+	}
+	if s.Mean != 0 {
+		s.Cv = s.StdDev / s.Mean
+	}
+	return s
+}
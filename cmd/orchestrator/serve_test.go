@@ -0,0 +1,182 @@
+package main
+
+import (
+	"cloud-benchmark-tool/api"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestServeExperiments lists the experiments of a fixture database, and serves one with its config and arguments.
+func TestServeExperiments(t *testing.T) {
+	client := serveFixture(t)
+
+	page, err := client.Experiments(api.Query{Project: "zap"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || len(page.Items) != 2 || page.Items[0].Measurements != 3 || page.Items[1].Origin != "import-csv" {
+		t.Errorf("experiments of zap = %+v, want the orchestrator run with 3 measurements and the import", page)
+	}
+	for _, e := range page.Items {
+		if e.Config != "" || e.Args != "" {
+			t.Errorf("listed experiment %d has config %q and args %q, want them only for single experiments", e.Id, e.Config, e.Args)
+		}
+	}
+	if page, err := client.Experiments(api.Query{Origin: "import-csv"}); err != nil || page.Total != 1 || page.Items[0].Id != 2 {
+		t.Errorf("imported experiments = %+v, %v, want experiment 2", page, err)
+	}
+
+	e, err := client.Experiment(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Config != "name: zap" || strings.Contains(e.Args, "secret") || !strings.Contains(e.Args, `"DbUri":"postgres://cbt:xxxxx@db/results"`) ||
+		!strings.Contains(e.Args, `"Sr":3`) {
+		t.Errorf("experiment 1 has config %q and args %q, want the arguments with the password redacted", e.Config, e.Args)
+	}
+	if e, err := client.Experiment(2); err != nil || e.Args != `{"format":"csv"}` {
+		t.Errorf("experiment 2 = %+v, %v, want the arguments of the import unchanged", e, err)
+	}
+	if _, err := client.Experiment(3); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("missing experiment returned %v, want 404", err)
+	}
+
+	resp, err := http.Post(client.BaseURL+api.PATH_EXPERIMENTS, "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST answered %s, want 405", resp.Status)
+	}
+}
+
+// TestServeMeasurements filters and pages the measurements of a fixture database.
+func TestServeMeasurements(t *testing.T) {
+	client := serveFixture(t)
+
+	tests := []struct {
+		query api.Query
+		total int
+		ids   []int64
+	}{
+		{api.Query{}, 4, []int64{1, 2, 3, 4}},
+		{api.Query{Experiments: []int64{1}, Limit: 2, Offset: 1}, 3, []int64{2, 3}},
+		{api.Query{Tags: []string{"v2"}}, 1, []int64{3}},
+		{api.Query{Benchmarks: []string{"BenchmarkEncode*"}}, 3, []int64{1, 2, 4}},
+		{api.Query{Benchmarks: []string{"pkg:./codec"}, Experiments: []int64{1}}, 1, []int64{3}},
+		{api.Query{Benchmarks: []string{"BenchmarkMissing"}}, 0, []int64{}},
+	}
+	for _, test := range tests {
+		page, err := client.Measurements(test.query)
+		if err != nil {
+			t.Fatalf("%+v: %v", test.query, err)
+		}
+		ids := make([]int64, 0, len(page.Items))
+		for _, m := range page.Items {
+			ids = append(ids, m.Id)
+		}
+		if page.Total != test.total || fmt.Sprint(ids) != fmt.Sprint(test.ids) {
+			t.Errorf("measurements of %+v = %d total, %v, want %d, %v", test.query, page.Total, ids, test.total, test.ids)
+		}
+	}
+
+	if _, err := client.Measurements(api.Query{Limit: api.MAX_LIMIT + 1}); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("limit above the maximum returned %v, want 400", err)
+	}
+}
+
+// TestServeManyMatchedBenchmarks filters measurements by rules matching more benchmarks than an OR term per benchmark
+// could express in SQLite, and more than MAX_MATCHED_BENCHMARKS, which are filtered after the query.
+func TestServeManyMatchedBenchmarks(t *testing.T) {
+	client := serveFixture(t)
+
+	insertWide := func(from int, to int) {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		insert, err := tx.Prepare(`INSERT INTO measurement(n, ns_per_op, bed_setup, it_setup, sr_setup, ir_setup, bed_pos, it_pos, sr_pos, ir_pos, b_name, subpackage, p_name, tag)
+			VALUES (100, ?, 1, 1, 1, 1, 1, 1, 1, 1, ?, './', 'zap', 'v1')`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := from; i < to; i++ {
+			if _, err := insert.Exec(float64(i), fmt.Sprintf("BenchmarkWide/n=%d", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		insert.Close()
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	query := api.Query{Benchmarks: []string{"BenchmarkWide/*"}, Limit: 3, Offset: 1}
+
+	for _, wide := range []int{1500, MAX_MATCHED_BENCHMARKS + 1} {
+		insertWide(0, wide)
+		page, err := client.Measurements(query)
+		if err != nil {
+			t.Fatalf("%d matched benchmarks: %v", wide, err)
+		}
+		names := make([]string, 0, len(page.Items))
+		for _, m := range page.Items {
+			names = append(names, m.Name)
+		}
+		want := "[BenchmarkWide/n=1 BenchmarkWide/n=2 BenchmarkWide/n=3]"
+		if page.Total != wide || fmt.Sprint(names) != want {
+			t.Errorf("%d matched benchmarks: %d total, %v, want %d, %s", wide, page.Total, names, wide, want)
+		}
+
+		stats, err := client.Stats(api.Query{Benchmarks: []string{"BenchmarkWide/n=1*"}, Tags: []string{"v1"}, Limit: api.MAX_LIMIT})
+		if err != nil {
+			t.Fatalf("%d matched benchmarks: %v", wide, err)
+		}
+		// n=1, n=10..19, n=100..199, n=1000..1999, and n=10000 above the limit
+		wantStats := 1 + 10 + 100 + min(wide-1000, 1000)
+		if wide > 10000 {
+			wantStats++
+		}
+		if stats.Total != wantStats {
+			t.Errorf("%d matched benchmarks: stats of %d benchmarks, want %d", wide, stats.Total, wantStats)
+		}
+
+		if _, err := db.Exec(`DELETE FROM measurement WHERE b_name LIKE 'BenchmarkWide/%'`); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// serveFixture serves a migrated database with two experiments of project zap, and returns a client of the server.
+func serveFixture(t *testing.T) *api.Client {
+	t.Helper()
+	openMigratedDB(t, "")
+	for _, statement := range []string{
+		`INSERT INTO project(p_name, base_package) VALUES ('zap', 'go.uber.org/zap')`,
+		`INSERT INTO experiment(p_name, status, config, args, orchestrator_version, runner_version, bed_setup, it_setup, sr_setup, ir_setup)
+			VALUES ('zap', 'finished', 'name: zap', '{"DbUri":"postgres://cbt:secret@db/results","Sr":3}', 'v1', 'v1', 1, 1, 3, 1)`,
+		`INSERT INTO experiment(p_name, status, config, args, orchestrator_version, runner_version, bed_setup, it_setup, sr_setup, ir_setup, origin)
+			VALUES ('zap', 'finished', '', '{"format":"csv"}', 'v1', '', 1, 1, 1, 1, 'import-csv')`,
+		serveMeasurement("BenchmarkEncode/small", "./", "v1", "1"),
+		serveMeasurement("BenchmarkEncode/large", "./", "v1", "1"),
+		serveMeasurement("BenchmarkDecode", "./codec", "v2", "1"),
+		serveMeasurement("BenchmarkEncode/small", "./", "v1", "2"),
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+
+	server := httptest.NewServer(newAPIHandler())
+	t.Cleanup(server.Close)
+	return api.NewClient(server.URL)
+}
+
+// serveMeasurement returns the insert of a measurement of the benchmark in the experiment eId.
+func serveMeasurement(name string, subPackage string, tag string, eId string) string {
+	return `INSERT INTO measurement(n, ns_per_op, bed_setup, it_setup, sr_setup, ir_setup, bed_pos, it_pos, sr_pos, ir_pos, b_name, subpackage, p_name, tag, e_id)
+		VALUES (1000, 706.0, 1, 1, 1, 1, 1, 1, 1, 1, '` + name + `', '` + subPackage + `', 'zap', '` + tag + `', ` + eId + `)`
+}
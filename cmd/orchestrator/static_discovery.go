@@ -0,0 +1,366 @@
+package main
+
+import (
+	"cloud-benchmark-tool/common"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/tools/go/packages"
+)
+
+type (
+	// staticBenchmark is a benchmark function found in the source code of a test package.
+	staticBenchmark struct {
+		Name    string
+		Package string   // package relative to the module root, e.g., ./sub
+		Leaves  []string // full names of all literally named (sub-)benchmarks reporting results
+		Dynamic bool     // at least one sub-benchmark name is only known at runtime
+	}
+)
+
+// discoverBenchmarksStatic finds benchmarks by parsing the test files of the module in the checked out revision.
+// Sub-benchmarks are only resolved if b.Run is called with a literal name outside of loops, benchmarks with
+// dynamically named sub-benchmarks, or passing their *testing.B to other functions, are discovered by running them.
+func discoverBenchmarksStatic(projPath string, module goModule, modules []goModule, benchRegex string) ([]common.Benchmark, error) {
+	moduleDir := filepath.Join(projPath, module.Dir)
+	found, err := findStaticBenchmarks(projPath, module, modules)
+	if err != nil {
+		return nil, err
+	}
+
+	benchmarks := make([]common.Benchmark, 0, len(found))
+	dynamicByPkg := make(map[string][]string)
+	for _, sb := range found {
+		if sb.Dynamic {
+			dynamicByPkg[sb.Package] = append(dynamicByPkg[sb.Package], sb.Name)
+			continue
+		}
+		for _, leaf := range sb.Leaves {
+			if !matchBenchName(benchRegex, leaf) {
+				continue
+			}
+			benchmarks = append(benchmarks, common.Benchmark{
+				Name:        leaf,
+				NameRegexp:  common.MaskNameRegexp(leaf), // Name needs special format for execution
+				Package:     sb.Package,
+				Measurement: []common.Measurement{},
+			})
+		}
+	}
+
+	// fall back to running benchmarks with dynamically named sub-benchmarks, one go test per package
+	pkgs := make([]string, 0, len(dynamicByPkg))
+	for pkg := range dynamicByPkg {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	for _, pkg := range pkgs {
+		names := dynamicByPkg[pkg]
+		log.Debugf("Discovering dynamically named sub-benchmarks of %v in %s", names, pkg)
+		pkgRegex := "^(" + strings.Join(names, "|") + ")$"
+		dynamic, err := discoverBenchmarks(moduleDir, module.Path, pkgRegex, pkg)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range dynamic {
+			if matchBenchName(benchRegex, b.Name) {
+				benchmarks = append(benchmarks, b)
+			}
+		}
+	}
+
+	return benchmarks, nil
+}
+
+// findStaticBenchmarks loads all test packages of the module with go/packages, and collects their benchmark functions.
+// Test files belonging to other modules of the project are skipped.
+func findStaticBenchmarks(projPath string, module goModule, modules []goModule) ([]staticBenchmark, error) {
+	cfg := &packages.Config{
+		Mode:  packages.NeedName | packages.NeedFiles | packages.NeedSyntax,
+		Dir:   filepath.Join(projPath, module.Dir),
+		Fset:  token.NewFileSet(),
+		Tests: true,
+	}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, errors.Wrap(err, "loading packages")
+	}
+
+	absProjPath, err := filepath.Abs(projPath)
+	if err != nil {
+		return nil, err
+	}
+
+	benchmarks := make([]staticBenchmark, 0, 10)
+	seen := make(map[string]bool) // test files show up in several package variants
+	for _, pkg := range pkgs {
+		for _, pkgErr := range pkg.Errors {
+			log.Warnf("Error loading package %s: %v", pkg.ID, pkgErr)
+		}
+
+		for _, file := range pkg.Syntax {
+			fileName := cfg.Fset.Position(file.Package).Filename
+			if !strings.HasSuffix(fileName, "_test.go") || seen[fileName] {
+				continue
+			}
+			seen[fileName] = true
+
+			rel, err := filepath.Rel(absProjPath, filepath.Dir(fileName))
+			if err != nil {
+				return nil, err
+			}
+			if owningModule(modules, rel) != module.Dir {
+				continue
+			}
+			relToModule, err := filepath.Rel(filepath.Join(absProjPath, module.Dir), filepath.Dir(fileName))
+			if err != nil {
+				return nil, err
+			}
+			relPkg := relativeDir(relToModule)
+
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Recv != nil || fn.Body == nil || !isBenchmarkName(fn.Name.Name) {
+					continue
+				}
+				bParam, ok := benchmarkParam(fn.Type)
+				if !ok {
+					continue
+				}
+
+				leaves, dynamic := collectSubBenchmarks(fn.Body, bParam, fn.Name.Name)
+				if len(leaves) == 0 && !dynamic {
+					leaves = []string{fn.Name.Name}
+				}
+				benchmarks = append(benchmarks, staticBenchmark{
+					Name:    fn.Name.Name,
+					Package: relPkg,
+					Leaves:  leaves,
+					Dynamic: dynamic,
+				})
+			}
+		}
+	}
+
+	return benchmarks, nil
+}
+
+// isBenchmarkName mirrors the check of go test: Benchmark followed by nothing or a non-lowercase letter.
+func isBenchmarkName(name string) bool {
+	if !strings.HasPrefix(name, "Benchmark") {
+		return false
+	}
+	if len(name) == len("Benchmark") {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len("Benchmark"):])
+	return !unicode.IsLower(r)
+}
+
+// benchmarkParam returns the name of the *testing.B parameter of a function with a single parameter.
+func benchmarkParam(fnType *ast.FuncType) (string, bool) {
+	if fnType.Params == nil || len(fnType.Params.List) != 1 || len(fnType.Params.List[0].Names) != 1 {
+		return "", false
+	}
+	star, ok := fnType.Params.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return "", false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "B" {
+		return "", false
+	}
+	return fnType.Params.List[0].Names[0].Name, true
+}
+
+// collectSubBenchmarks returns the full names of the leaf sub-benchmarks started in body via bName.Run.
+// dynamic is true if any sub-benchmark below body is not named by a literal, is started in a loop, or if the
+// *testing.B escapes into another call, which may start sub-benchmarks we cannot see.
+func collectSubBenchmarks(body *ast.BlockStmt, bName string, prefix string) (leaves []string, dynamic bool) {
+	seen := make(map[string]int) // uses of each sub-benchmark name, to add the suffixes of go test
+	loops := 0
+	var stack []ast.Node
+	ast.Inspect(body, func(n ast.Node) bool {
+		if n == nil {
+			switch stack[len(stack)-1].(type) {
+			case *ast.ForStmt, *ast.RangeStmt:
+				loops--
+			}
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		if dynamic {
+			return false
+		}
+
+		call, ok := n.(*ast.CallExpr)
+		if !ok || !isRunCall(call, bName) {
+			if ok && passesIdent(call, bName) {
+				dynamic = true
+				return false
+			}
+			switch n.(type) {
+			case *ast.ForStmt, *ast.RangeStmt:
+				loops++
+			}
+			stack = append(stack, n)
+			return true
+		}
+
+		name, ok := literalString(call.Args[0])
+		if !ok || loops > 0 {
+			// the name is only known at runtime, or the literal name is used an unknown number of times
+			dynamic = true
+			return false
+		}
+		fullName := uniqueSubName(seen, prefix, rewriteSubName(name))
+
+		fn, ok := call.Args[1].(*ast.FuncLit)
+		if !ok {
+			// the sub-benchmark's *testing.B is passed to a named function
+			dynamic = true
+			return false
+		}
+		subParam, ok := benchmarkParam(fn.Type)
+		if !ok {
+			leaves = append(leaves, fullName)
+			return false
+		}
+
+		subLeaves, subDynamic := collectSubBenchmarks(fn.Body, subParam, fullName)
+		if subDynamic {
+			dynamic = true
+		}
+		if len(subLeaves) == 0 && !subDynamic {
+			leaves = append(leaves, fullName)
+		}
+		leaves = append(leaves, subLeaves...)
+		return false
+	})
+	return leaves, dynamic
+}
+
+// isRunCall reports whether call is bName.Run with a name and a function.
+func isRunCall(call *ast.CallExpr, bName string) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Run" || len(call.Args) != 2 {
+		return false
+	}
+	recv, ok := sel.X.(*ast.Ident)
+	return ok && recv.Name == bName
+}
+
+// passesIdent reports whether the identifier name is an argument of call.
+func passesIdent(call *ast.CallExpr, name string) bool {
+	for _, arg := range call.Args {
+		if ident, ok := ast.Unparen(arg).(*ast.Ident); ok && ident.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueSubName names a sub-benchmark like go test: names used before under the same parent, and empty names,
+// get the suffix #01, #02, ..., skipping suffixes that collide with names used literally.
+func uniqueSubName(seen map[string]int, prefix string, subName string) string {
+	base := prefix + "/" + subName
+	for {
+		n := seen[base]
+		seen[base] = n + 1
+
+		if n == 0 && subName != "" {
+			// a literal name like "x#01" collides with the second use of "x", if that came first
+			if unsuffixed, nn := parseSubNumber(base); len(unsuffixed) < len(base) && nn < seen[unsuffixed] {
+				continue
+			}
+			return base
+		}
+
+		name := fmt.Sprintf("%s#%02d", base, n)
+		if seen[name] != 0 {
+			continue
+		}
+		return name
+	}
+}
+
+// parseSubNumber splits a #NN suffix, as added by uniqueSubName, from name.
+func parseSubNumber(name string) (string, int) {
+	i := strings.LastIndex(name, "#")
+	if i < 0 {
+		return name, 0
+	}
+	prefix, suffix := name[:i], name[i+1:]
+	if len(suffix) < 2 || len(suffix) > 2 && suffix[0] == '0' || suffix == "00" && !strings.HasSuffix(prefix, "/") {
+		return name, 0
+	}
+	n, err := strconv.Atoi(suffix)
+	if err != nil || n < 0 {
+		return name, 0
+	}
+	return prefix, n
+}
+
+// literalString evaluates string literals and concatenations of them.
+func literalString(expr ast.Expr) (string, bool) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return "", false
+		}
+		s, err := strconv.Unquote(e.Value)
+		return s, err == nil
+	case *ast.ParenExpr:
+		return literalString(e.X)
+	case *ast.BinaryExpr:
+		if e.Op != token.ADD {
+			return "", false
+		}
+		left, ok := literalString(e.X)
+		if !ok {
+			return "", false
+		}
+		right, ok := literalString(e.Y)
+		return left + right, ok
+	}
+	return "", false
+}
+
+// rewriteSubName replaces white space like go test does when naming sub-benchmarks.
+func rewriteSubName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// matchBenchName matches a benchmark name against a -bench regular expression. Like go test,
+// every '/' separated element of the expression is matched against the respective level of the name.
+func matchBenchName(benchRegex string, name string) bool {
+	patterns := strings.Split(benchRegex, "/")
+	levels := strings.Split(name, "/")
+	for i := 0; i < len(patterns) && i < len(levels); i++ {
+		matched, err := regexp.MatchString(patterns[i], levels[i])
+		if err != nil {
+			log.Warnf("Invalid benchmark regex %s: %v", benchRegex, err)
+			return false
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
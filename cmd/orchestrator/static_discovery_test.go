@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestFindStaticBenchmarks checks the names found in testdata/static against those reported by go test, and that
+// benchmarks whose sub-benchmarks cannot be named statically are marked dynamic.
+func TestFindStaticBenchmarks(t *testing.T) {
+	found, err := findStaticBenchmarks("testdata/static", goModule{Dir: "./", Path: "example.com/static"},
+		[]goModule{{Dir: "./", Path: "example.com/static"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]staticBenchmark, len(found))
+	for _, sb := range found {
+		byName[sb.Name] = sb
+	}
+
+	tests := []struct {
+		name    string
+		pkg     string
+		leaves  []string
+		dynamic bool
+	}{
+		{"BenchmarkPlain", "./", []string{"BenchmarkPlain"}, false},
+		{"BenchmarkNested", "./", []string{"BenchmarkNested/small_size/ab", "BenchmarkNested/small_size/c"}, false},
+		{"BenchmarkDuplicate", "./", []string{"BenchmarkDuplicate/x", "BenchmarkDuplicate/x#01", "BenchmarkDuplicate/#00",
+			"BenchmarkDuplicate/x#01#01", "BenchmarkDuplicate/x#02"}, false},
+		// a literal name in a loop is run an unknown number of times, as fixed, fixed#01, ...
+		{"BenchmarkLoop", "./", nil, true},
+		{"BenchmarkDynamicName", "./", nil, true},
+		// the *testing.B escapes into a helper, directly or via a named sub-benchmark function
+		{"BenchmarkHelper", "./", nil, true},
+		{"BenchmarkNestedHelper", "./", nil, true},
+		{"BenchmarkNamedFunc", "./", nil, true},
+		{"BenchmarkDecode", "./codec", []string{"BenchmarkDecode/json"}, false},
+	}
+	if len(found) != len(tests) {
+		t.Errorf("found %d benchmarks, want %d", len(found), len(tests))
+	}
+	for _, test := range tests {
+		sb, ok := byName[test.name]
+		if !ok {
+			t.Errorf("%s not found", test.name)
+			continue
+		}
+		if sb.Package != test.pkg || sb.Dynamic != test.dynamic || !reflect.DeepEqual(sb.Leaves, test.leaves) {
+			t.Errorf("%s = %s %v (dynamic %t), want %s %v (dynamic %t)",
+				test.name, sb.Package, sb.Leaves, sb.Dynamic, test.pkg, test.leaves, test.dynamic)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package shapes
+
+type Square struct{ Side float64 }
+
+type Circle struct{ Radius float64 }
+
+// Area is declared on both shapes, only the call on a Square reaches Square.Area.
+func (s Square) Area() float64 { return s.Side * s.Side }
+
+func (c Circle) Area() float64 { return 3.14 * c.Radius * c.Radius }
+
+type Shape interface{ Area() float64 }
+
+func SquareArea(side float64) float64 {
+	return Square{side}.Area()
+}
+
+func TotalArea(shapes []Shape) float64 {
+	total := 0.0
+	for _, s := range shapes {
+		total += s.Area()
+	}
+	return total
+}
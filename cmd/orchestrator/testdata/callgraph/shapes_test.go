@@ -0,0 +1,17 @@
+package shapes
+
+import "testing"
+
+func BenchmarkSquareArea(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		SquareArea(2)
+	}
+}
+
+func BenchmarkTotalArea(b *testing.B) {
+	b.Run("mixed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			TotalArea([]Shape{Square{2}})
+		}
+	})
+}
@@ -0,0 +1,3 @@
+module example.com/pilot
+
+go 1.19
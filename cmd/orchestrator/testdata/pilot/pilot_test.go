@@ -0,0 +1,42 @@
+package pilot
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// BenchmarkIsolated fails unless it runs with the GOMAXPROCS, niceness and cpu set expected by the test.
+func BenchmarkIsolated(b *testing.B) {
+	if want := os.Getenv("CBT_PILOT_GOMAXPROCS"); want != strconv.Itoa(runtime.GOMAXPROCS(0)) {
+		b.Fatalf("GOMAXPROCS %d, want %s", runtime.GOMAXPROCS(0), want)
+	}
+	stat, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		b.Fatal(err)
+	}
+	// the niceness is the 19th field, the 17th after the parenthesized command name
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	if want := os.Getenv("CBT_PILOT_NICENESS"); fields[16] != want {
+		b.Fatalf("niceness %s, want %s", fields[16], want)
+	}
+	if want := os.Getenv("CBT_PILOT_CPUS"); want != "" {
+		status, err := os.ReadFile("/proc/self/status")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !strings.Contains(string(status), "Cpus_allowed_list:\t"+want+"\n") {
+			b.Fatalf("not pinned to cpus %s", want)
+		}
+	}
+
+	for i := 0; i < b.N; i++ {
+		strconv.Itoa(i)
+	}
+}
+
+func BenchmarkFailing(b *testing.B) {
+	b.Fatal("always fails")
+}
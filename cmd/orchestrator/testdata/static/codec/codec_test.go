@@ -0,0 +1,7 @@
+package codec
+
+import "testing"
+
+func BenchmarkDecode(b *testing.B) {
+	b.Run("json", func(b *testing.B) {})
+}
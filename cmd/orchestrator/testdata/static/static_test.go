@@ -0,0 +1,69 @@
+package static
+
+import (
+	"fmt"
+	"testing"
+)
+
+var sizes = []int{1, 10}
+
+func BenchmarkPlain(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Sum(sizes)
+	}
+}
+
+func BenchmarkNested(b *testing.B) {
+	b.Run("small size", func(b *testing.B) {
+		b.Run("a"+"b", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Sum(sizes)
+			}
+		})
+		b.Run("c", func(sub *testing.B) {
+			for i := 0; i < sub.N; i++ {
+				Sum(sizes)
+			}
+		})
+	})
+}
+
+func BenchmarkDuplicate(b *testing.B) {
+	b.Run("x", func(b *testing.B) {})
+	b.Run("x", func(b *testing.B) {})
+	b.Run("", func(b *testing.B) {})
+	b.Run("x#01", func(b *testing.B) {})
+	b.Run("x", func(b *testing.B) {})
+}
+
+func BenchmarkLoop(b *testing.B) {
+	for range sizes {
+		b.Run("fixed", func(b *testing.B) {})
+	}
+}
+
+func BenchmarkDynamicName(b *testing.B) {
+	for _, size := range sizes {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {})
+	}
+}
+
+func BenchmarkHelper(b *testing.B) {
+	runSizes(b)
+}
+
+func BenchmarkNestedHelper(b *testing.B) {
+	b.Run("outer", func(b *testing.B) {
+		runSizes(b)
+	})
+}
+
+func BenchmarkNamedFunc(b *testing.B) {
+	b.Run("named", runSizes)
+}
+
+func runSizes(b *testing.B) {
+	for _, size := range sizes {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"math/rand"
 	"net"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
 
@@ -24,6 +25,7 @@ type (
 	cmdArgs struct {
 		Path                  string
 		Tags                  string
+		Commits               string
 		BasePackage           string
 		Bed                   int
 		Iterations            int
@@ -34,8 +36,14 @@ type (
 		ProjectName           string
 		BucketName            string
 		GenPprof              bool
+		Profiles              string
+		ProfileSampling       float64
 		Envs                  string
 		Commands              string
+		CpuSet                string
+		RunnerCpuSet          string
+		GoMaxProcs            int
+		Nice                  int
 		logfile               bool
 	}
 )
@@ -43,6 +51,7 @@ type (
 func parseArgs() (ca cmdArgs) {
 	flag.StringVar(&(ca.Path), "path", "", "Path of the project under test to benchmark.") // Project is cloned by startup script and path passed here
 	flag.StringVar(&(ca.Tags), "tags", "", "List fo Tags to run benchmark with.")
+	flag.StringVar(&(ca.Commits), "commits", "", "Commits the tags resolved to at plan time, in the order of the tags. Tags are checked out directly if empty.")
 	flag.StringVar(&(ca.BasePackage), "base-package", "", "Base package name used for golang imports.")
 	flag.IntVar(&(ca.Bed), "bed", 1, "Benchmark Execution Duration in seconds (single number, no unit).")
 	flag.IntVar(&(ca.Iterations), "iterations", 1, "Number of iterations for a benchmark.")
@@ -55,10 +64,17 @@ func parseArgs() (ca cmdArgs) {
 	flag.StringVar(&(ca.ProjectName), "project-name", "default", "Project of bucket to upload experiment pprof files to.")
 	flag.StringVar(&(ca.BucketName), "bucket-name", "default", "Bucket to upload experiment pprof files to.")
 
-	flag.BoolVar(&(ca.GenPprof), "generate-pprof", false, "Wether to generate pprof files or not.")
+	flag.BoolVar(&(ca.GenPprof), "generate-pprof", false, "Wether to generate pprof files or not, same as -profiles cpu.")
+	flag.StringVar(&(ca.Profiles), "profiles", "", "Comma separated list of profiles to record (cpu, mem, block, mutex, trace).")
+	flag.Float64Var(&(ca.ProfileSampling), "profile-sampling", 1, "Probability of profiling a single benchmark execution.")
 	flag.StringVar(&(ca.Envs), "envs", "", "List of environment variables to set.")
 	flag.StringVar(&(ca.Commands), "commands", "", "List commands to execute before the benchmark in the project dir.")
 
+	flag.StringVar(&(ca.CpuSet), "cpu-set", "", "CPU list (taskset syntax) to pin the benchmark processes to.")
+	flag.StringVar(&(ca.RunnerCpuSet), "runner-cpu-set", "", "CPU list (taskset syntax) to move the runner itself to.")
+	flag.IntVar(&(ca.GoMaxProcs), "gomaxprocs", 0, "GOMAXPROCS of the benchmark processes, 0 runs benchmarks with -cpu 1.")
+	flag.IntVar(&(ca.Nice), "nice", 0, "Niceness of the benchmark processes, negative values raise the priority.")
+
 	flag.BoolVar(&(ca.logfile), "logfile", true, "Wether to log to file.")
 
 	flag.Parse()
@@ -89,19 +105,6 @@ func main() {
 	// Parse cmd arguments
 	ca := parseArgs()
 
-	if ca.GenPprof {
-		// Create folders for cpu and mem pprof files
-		err := os.MkdirAll("cpu", os.ModePerm)
-		if err != nil {
-			log.Println(err)
-		}
-
-		err = os.MkdirAll("mem", os.ModePerm)
-		if err != nil {
-			log.Println(err)
-		}
-	}
-
 	// Create log file
 	var f *os.File
 	log.SetOutput(os.Stdout)
@@ -117,9 +120,32 @@ func main() {
 	}
 	log.SetLevel(log.DebugLevel)
 
-	// Receive benchmarks from orchestrator
+	// Isolate benchmark processes from the runner
+	isolation := common.Isolation{
+		CpuSet:       ca.CpuSet,
+		RunnerCpuSet: ca.RunnerCpuSet,
+		GoMaxProcs:   ca.GoMaxProcs,
+		Nice:         ca.Nice,
+	}
+	isolation.Validate()
+	isolation.PinRunner()
+	log.Debugf("Isolation settings: %+v", isolation)
+
+	// Select profiles to record
+	profiling := profileOptions(ca)
+	if profiling.Enabled() {
+		err := profiling.CreateDirs()
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	// Register the host fingerprint and receive benchmarks from orchestrator
+	host := common.CollectHostInfo()
+	log.Debugf("Host: %s, %s, %d cores, kernel %s, clocksource %s, %s", host.Hostname, host.CpuModel, host.Cores, host.Kernel, host.Clocksource, host.GoVersion)
 	log.Debug("Reading benchmarks from orchestrator")
-	benchmarks := readBenchmarks(ca.Path, ca.OrchestratorIp, ca.BenchmarkListPort)
+	registration, benchmarks := readBenchmarks(ca.Path, ca.OrchestratorIp, ca.BenchmarkListPort, host)
+	log.Debugf("Registered as host %d, instance run %d", registration.HostId, registration.IrPos)
 	log.Debug(benchmarks)
 	log.Debug("Finished reading benchmarks")
 
@@ -128,6 +154,16 @@ func main() {
 	tags := strings.Split(ca.Tags, ",")
 	log.Debugf("Tags for this run: %v", tags)
 
+	// check out the commits resolved by the orchestrator, so that branches moving during the experiment do not matter
+	revisions := make(map[string]string, len(tags))
+	commits := strings.Split(ca.Commits, ",")
+	for i, tag := range tags {
+		revisions[tag] = tag
+		if ca.Commits != "" && i < len(commits) {
+			revisions[tag] = commits[i]
+		}
+	}
+
 	// Set Envs
 	envs := strings.Split(ca.Envs, ",")
 	common.SetEnvironmentVariables(envs)
@@ -151,12 +187,22 @@ func main() {
 
 			for _, tag := range shuffle(tags) {
 				// execute current benchmark
+				if !(*benchmarks)[curr].AvailableOn(tag) {
+					log.Debugf("Skipping %s, not available on tag: %s", (*benchmarks)[curr].Name, tag)
+					continue
+				}
+
+				if (*benchmarks)[curr].Annotations.Skip {
+					log.Info("Skipping benchmark annotated with //cbt:skip: ", (*benchmarks)[curr].Name)
+					continue
+				}
+
 				log.Debugf("Executing %s with iteration %d of %d on tag: %s", (*benchmarks)[curr].Name, itCounts[curr], ca.Iterations, tag)
 
 				// First take is already initital checked out
 				if len(tags) > 1 {
-					log.Debug("Checking out tag: ", tag)
-					gitCheckout := exec.Command("git", "checkout", "tags/"+tag)
+					log.Debugf("Checking out tag: %s (%s)", tag, revisions[tag])
+					gitCheckout := exec.Command("git", "checkout", revisions[tag])
 					gitCheckout.Dir = (*benchmarks)[curr].ProjectPath
 					_, gitCheckoutErr := gitCheckout.CombinedOutput()
 
@@ -170,8 +216,14 @@ func main() {
 					continue
 				}
 
+				// //cbt:bed=N in the source overrides the configured bed
+				bed := ca.Bed
+				if (*benchmarks)[curr].Annotations.Bed > 0 {
+					bed = (*benchmarks)[curr].Annotations.Bed
+				}
+
 				// Run benchmark
-				err := (*benchmarks)[curr].RunBenchmark(ca.Bed, itCounts[curr], i, tag, ca.GenPprof)
+				err := (*benchmarks)[curr].RunBenchmark(bed, itCounts[curr], i, tag, profiling, &isolation)
 				if err != nil {
 					log.Debug(err)
 				}
@@ -179,8 +231,9 @@ func main() {
 			}
 
 			if numExecutions > MEASUREMENT_BATCH_SIZE {
+				uploadProfilesToBucket(profiling, benchmarks, ca.ProjectName)
 				log.Debug("Sending measurements to orchestrator and clearing measurements: ", numExecutions)
-				sendMeasurements(benchmarks, ca.OrchestratorIp, ca.MeasurementReportPort)
+				sendMeasurements(registration, benchmarks, ca.OrchestratorIp, ca.MeasurementReportPort)
 				clearBenchmarkMeasurements(benchmarks)
 				numExecutions = 0
 			}
@@ -191,18 +244,12 @@ func main() {
 		log.Debugf("Running on suite run took: %s", elapsed)
 	}
 
-	if ca.GenPprof {
-		log.Debug("Uploading pprof files to bucket")
-		uploadFilesToBucket("cpu/", ca.ProjectName, ca.BucketName)
-	}
-
+	uploadProfilesToBucket(profiling, benchmarks, ca.ProjectName)
 	log.Debug("Sending measurements to orchestrator and clearing measurements")
-	sendMeasurements(benchmarks, ca.OrchestratorIp, ca.MeasurementReportPort)
-	log.Debug("Sending done signal to orchestrator")
-	sendDoneSignal(ca.OrchestratorIp, ca.MeasurementReportPort)
+	sendMeasurements(registration, benchmarks, ca.OrchestratorIp, ca.MeasurementReportPort)
 	log.Debug("Finished sending measurements")
 
-	// Close and upload log file to bucket
+	// Close and upload log file to bucket, the orchestrator shuts the instance down after the done signal
 	if ca.logfile && f != nil {
 		log.Debug("Closing log file and uploading log file to bucket")
 		log.SetOutput(os.Stdout)
@@ -213,6 +260,32 @@ func main() {
 		uploadFilesToBucket(f.Name(), ca.ProjectName, ca.BucketName)
 	}
 
+	log.Debug("Sending done signal to orchestrator")
+	sendDoneSignal(registration, ca.OrchestratorIp, ca.MeasurementReportPort)
+}
+
+// profileOptions assembles the profiling configuration, -generate-pprof alone records cpu profiles.
+func profileOptions(ca cmdArgs) *common.ProfileOptions {
+	kinds, err := common.ParseProfileKinds(ca.Profiles)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(kinds) == 0 && ca.GenPprof {
+		kinds = []string{"cpu"}
+	}
+
+	dir, err := filepath.Abs("profiles")
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	return &common.ProfileOptions{
+		Kinds:    kinds,
+		Sampling: ca.ProfileSampling,
+		Dir:      dir,
+		Bucket:   ca.BucketName,
+		KeyBase:  hostname + "/profiles",
+	}
 }
 
 func shuffle(slice []string) []string {
@@ -220,14 +293,24 @@ func shuffle(slice []string) []string {
 	return slice
 }
 
-func readBenchmarks(projPath string, ip string, port string) *[]common.Benchmark {
+// readBenchmarks registers the runner with its host fingerprint, and receives the registration and the benchmarks to run.
+func readBenchmarks(projPath string, ip string, port string, host common.HostInfo) (common.Registration, *[]common.Benchmark) {
 	benchmarks := make([]common.Benchmark, 0, 10)
 
 	conn, err := net.Dial("tcp", ip+":"+port)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	err = gob.NewEncoder(conn).Encode(host)
+	if err != nil {
+		log.Fatalln(err)
+	}
 	dec := gob.NewDecoder(conn)
+	var registration common.Registration
+	err = dec.Decode(&registration)
+	if err != nil {
+		log.Fatalln(err)
+	}
 	for {
 		var b common.Benchmark
 		err := dec.Decode(&b)
@@ -244,30 +327,32 @@ func readBenchmarks(projPath string, ip string, port string) *[]common.Benchmark
 		benchmarks = append(benchmarks, b)
 	}
 
-	return &benchmarks
+	return registration, &benchmarks
 }
 
-func sendMeasurements(benchmarks *[]common.Benchmark, ip string, port string) {
+func sendMeasurements(registration common.Registration, benchmarks *[]common.Benchmark, ip string, port string) {
 	conn, err := net.Dial("tcp", ip+":"+port)
 	if err != nil {
 		log.Fatal(err)
 	}
 	encoder := gob.NewEncoder(conn)
+	encoder.Encode(registration)
 	N := len(*benchmarks)
 	for i := 0; i < N; i++ {
-		if len((*benchmarks)[i].Measurement) != 0 {
+		if len((*benchmarks)[i].Measurement) != 0 || len((*benchmarks)[i].Profiles) != 0 {
 			encoder.Encode((*benchmarks)[i])
 		}
 	}
 	conn.Close()
 }
 
-func sendDoneSignal(ip string, port string) {
+func sendDoneSignal(registration common.Registration, ip string, port string) {
 	conn, err := net.Dial("tcp", ip+":"+port)
 	if err != nil {
 		log.Fatal(err)
 	}
 	encoder := gob.NewEncoder(conn)
+	encoder.Encode(registration)
 	encoder.Encode(common.Benchmark{Name: "alldone"})
 	conn.Close()
 }
@@ -276,6 +361,7 @@ func clearBenchmarkMeasurements(benchmarks *[]common.Benchmark) {
 	N := len(*benchmarks)
 	for i := 0; i < N; i++ {
 		(*benchmarks)[i].Measurement = make([]common.Measurement, 0)
+		(*benchmarks)[i].Profiles = make([]common.ProfileFile, 0)
 	}
 }
 
@@ -326,3 +412,30 @@ func uploadFilesToBucket(path string, gcpProjectName string, gcpBucketName strin
 		common.UploadBytes(bytes, key, gcpProjectName, gcpBucketName, gclientStorage, ctx)
 	}
 }
+
+// Uploads the profiles recorded since the last report, and keeps only the uploaded ones in the index sent to the
+// orchestrator, so that a failed upload or run never leaves index rows pointing to missing objects.
+func uploadProfilesToBucket(profiling *common.ProfileOptions, benchmarks *[]common.Benchmark, gcpProjectName string) {
+	if !profiling.Enabled() {
+		return
+	}
+
+	log.Debug("Uploading pprof files to bucket")
+	ctx := context.Background()
+	gclientStorage, err := storage.NewClient(ctx)
+	if err != nil {
+		log.Warnf("Could not open storage client, dropping the index of the recorded profiles: %v", err)
+		for i := range *benchmarks {
+			(*benchmarks)[i].Profiles = make([]common.ProfileFile, 0)
+		}
+		return
+	}
+	defer gclientStorage.Close()
+
+	upload := func(profile common.ProfileFile, data []byte) error {
+		return common.WriteObject(data, profile.ObjectKey, gcpProjectName, profile.Bucket, gclientStorage, ctx)
+	}
+	for i := range *benchmarks {
+		(*benchmarks)[i].Profiles = common.UploadProfiles((*benchmarks)[i].Profiles, upload)
+	}
+}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ANNOTATION_PREFIX starts a directive in the doc comment of a benchmark function, e.g., //cbt:bed=3
+const ANNOTATION_PREFIX = "//cbt:"
+
+type (
+	// Annotations are directives benchmark authors put above a Benchmark function to steer its handling.
+	// They apply to the function and all its sub-benchmarks.
+	Annotations struct {
+		Skip    bool     // //cbt:skip, never scheduled
+		Timeout string   // //cbt:timeout=5m, go test -timeout of each execution
+		Bed     int      // //cbt:bed=3, overrides the bed setting, 0 if not set
+		Labels  []string // //cbt:tags=slow,io, labels usable in filter rules
+	}
+)
+
+// ParseAnnotations reads the cbt directives from the raw comment lines (including the //) above a benchmark function.
+// Other comment lines are ignored, unknown or malformed directives are returned as error.
+func ParseAnnotations(comments []string) (Annotations, error) {
+	var ann Annotations
+	for _, comment := range comments {
+		if !strings.HasPrefix(comment, ANNOTATION_PREFIX) {
+			continue
+		}
+		directive := strings.TrimSpace(strings.TrimPrefix(comment, ANNOTATION_PREFIX))
+		key, value, hasValue := strings.Cut(directive, "=")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "skip":
+			ann.Skip = true
+		case "timeout":
+			if _, err := time.ParseDuration(value); err != nil || !hasValue {
+				return ann, errors.Errorf("invalid timeout in %q", comment)
+			}
+			ann.Timeout = value
+		case "bed":
+			bed, err := strconv.Atoi(value)
+			if err != nil || bed < 1 {
+				return ann, errors.Errorf("invalid bed in %q", comment)
+			}
+			ann.Bed = bed
+		case "tags":
+			for _, label := range strings.Split(value, ",") {
+				if label = strings.TrimSpace(label); label != "" {
+					ann.Labels = append(ann.Labels, label)
+				}
+			}
+		default:
+			return ann, errors.Errorf("unknown directive %q", comment)
+		}
+	}
+	return ann, nil
+}
+
+// Empty reports whether no directive was set.
+func (ann *Annotations) Empty() bool {
+	return !ann.Skip && ann.Timeout == "" && ann.Bed == 0 && len(ann.Labels) == 0
+}
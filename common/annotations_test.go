@@ -0,0 +1,33 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseAnnotations reads cbt directives and ignores other comment lines.
+func TestParseAnnotations(t *testing.T) {
+	ann, err := ParseAnnotations([]string{
+		"// BenchmarkEncode measures encoding.",
+		"//cbt:timeout=5m",
+		"//cbt:bed=3",
+		"//cbt:tags=slow, io",
+		"//cbt:skip",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Annotations{Skip: true, Timeout: "5m", Bed: 3, Labels: []string{"slow", "io"}}
+	if !reflect.DeepEqual(ann, want) {
+		t.Fatalf(`ParseAnnotations = %+v, want %+v`, ann, want)
+	}
+}
+
+// TestParseAnnotationsInvalid rejects unknown directives and malformed values.
+func TestParseAnnotationsInvalid(t *testing.T) {
+	for _, comment := range []string{"//cbt:bed=0", "//cbt:timeout=soon", "//cbt:timeout", "//cbt:unknown"} {
+		if _, err := ParseAnnotations([]string{comment}); err == nil {
+			t.Fatalf(`ParseAnnotations(%q) did not fail`, comment)
+		}
+	}
+}
@@ -1,9 +1,8 @@
 package common
 
 import (
-	"os/exec"
+	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -23,14 +22,23 @@ type (
 		SrPos      int
 		Tag        string
 		CountIndex int
+		Isolation  Isolation
+		Noise      SystemNoise
+		Profiled   bool
 	}
 
 	Benchmark struct {
+		Id          int64 // ID in the orchestrator DB, 0 if not registered
 		Name        string
 		NameRegexp  string
-		Package     string
+		Package     string // package relative to the module root, e.g., ./sub
+		Module      string // module root relative to the project root, e.g., ./ or ./api
+		ModulePath  string
 		ProjectPath string
 		Measurement []Measurement
+		Profiles    []ProfileFile
+		Tags        []string // tags the benchmark exists on, empty if unknown
+		Annotations Annotations
 		Failing     bool
 	}
 )
@@ -56,7 +64,40 @@ func MaskNameRegexp(name string) string {
 	return nameRegexp
 }
 
-func (bench *Benchmark) RunBenchmark(bed int, itPos int, srPos int, tag string, genPprof bool) error {
+// ProjectPackage returns the package relative to the project root, which identifies the package across modules.
+func (bench *Benchmark) ProjectPackage() string {
+	if bench.Module == "" || bench.Module == "./" {
+		return bench.Package
+	}
+	if bench.Package == "./" {
+		return bench.Module
+	}
+	return bench.Module + strings.TrimPrefix(bench.Package, ".")
+}
+
+// Dir returns the directory go test has to be run in, the module root.
+func (bench *Benchmark) Dir() string {
+	if bench.Module == "" {
+		return bench.ProjectPath
+	}
+	return filepath.Join(bench.ProjectPath, bench.Module)
+}
+
+// AvailableOn reports whether the benchmark was discovered on the given tag.
+// Benchmarks without availability information are assumed to exist on every tag.
+func (bench *Benchmark) AvailableOn(tag string) bool {
+	if len(bench.Tags) == 0 {
+		return true
+	}
+	for _, t := range bench.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (bench *Benchmark) RunBenchmark(bed int, itPos int, srPos int, tag string, profiling *ProfileOptions, iso *Isolation) error {
 
 	// Not needed when using count=x
 	// cmd := exec.Command("go", "clean", "-testcache")
@@ -65,31 +106,41 @@ func (bench *Benchmark) RunBenchmark(bed int, itPos int, srPos int, tag string,
 	// 	return errors.Wrapf(err, "%#v: error while running go clean --cache.", cmd.Args)
 	// }
 
-	sRun := strconv.Itoa(srPos)
-	iter := strconv.Itoa(itPos)
-
-	// Setting cpu to 1 to make parsing of benchmark names easier
-	var testArgs = []string{"test", "-benchtime", "1s", "-count", "3", "-bench", bench.NameRegexp, bench.Package, "-run", "^$", "-cpu", "1"}
-
-	if genPprof {
-		var cleanName = strings.Replace(bench.Name, "/", "-", -1)
-		var cleanTag = strings.Replace(tag, ".", "-", -1)
-		var pprofCpuArgs = []string{"-cpuprofile", "../cpu/" + cleanName + "_" + iter + "_" + sRun + "_" + cleanTag + ".out"}
-		//var pprofMemArgs = []string{"-memprofile", "../mem/" + cleanName + "_" + iter + "_" + sRun + "_" + cleanTag + ".out"}
-		testArgs = append(testArgs, pprofCpuArgs...)
+	// Setting cpu to 1 (unless GOMAXPROCS is configured) to make parsing of benchmark names easier
+	var testArgs = []string{"test", "-benchtime", "1s", "-count", "3", "-bench", bench.NameRegexp, bench.Package, "-run", "^$", "-cpu", iso.CpuFlag()}
+	if bench.Annotations.Timeout != "" {
+		testArgs = append(testArgs, "-timeout", bench.Annotations.Timeout)
 	}
 
 	for i := 0; i < bed; i++ {
 		// each iteration on this level is 1s of benchtime, repeat until bed is reached
-		cmd := exec.Command("go", testArgs...)
-		cmd.Dir = bench.ProjectPath
+		runArgs := testArgs
+		var profiles []ProfileFile
+		profiled := profiling.sample()
+		if profiled {
+			var profileArgs []string
+			profileArgs, profiles = profiling.profileArgs(bench, tag, i+1, itPos, srPos)
+			runArgs = append(append([]string{}, testArgs...), profileArgs...)
+		}
+
+		cmd := iso.Command(runArgs...)
+		cmd.Dir = bench.Dir()
+
+		// sample host state around the execution to correlate outliers with noise
+		before, sampleErr := SampleSystem()
+		if sampleErr != nil {
+			log.Debugf("Could not sample system noise: %v", sampleErr)
+		}
 		out, err := cmd.CombinedOutput()
+		after, _ := SampleSystem()
+		noise := SummarizeNoise(before, after)
 
 		if err != nil {
 			log.Info("Marking benchmark as failing: ", bench.Name)
 			bench.Failing = true
 			return errors.Wrapf(err, "%#v: output: %s", cmd.Args, out)
 		}
+		bench.Profiles = append(bench.Profiles, profiles...)
 
 		lines := strings.Split(string(out), "\n")
 
@@ -113,6 +164,11 @@ func (bench *Benchmark) RunBenchmark(bed int, itPos int, srPos int, tag string,
 					Tag:        tag,
 					CountIndex: numFoundMeasurements,
 				}
+				if iso != nil {
+					newMsrmnt.Isolation = *iso
+				}
+				newMsrmnt.Noise = noise
+				newMsrmnt.Profiled = profiled
 
 				bench.Measurement = append(bench.Measurement, newMsrmnt)
 				numFoundMeasurements++
@@ -12,6 +12,13 @@ import (
 )
 
 func UploadBytes(toUpload []byte, fileKey string, gcpProjectName string, gcpBucketName string, gclient *storage.Client, ctx context.Context) {
+	if err := WriteObject(toUpload, fileKey, gcpProjectName, gcpBucketName, gclient, ctx); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// WriteObject uploads the bytes to the bucket object and returns the error instead of exiting.
+func WriteObject(toUpload []byte, fileKey string, gcpProjectName string, gcpBucketName string, gclient *storage.Client, ctx context.Context) error {
 	wc := gclient.Bucket(gcpBucketName).Object(fileKey).NewWriter(ctx)
 	wc.ContentType = "text/plain"
 	// make this file public readable
@@ -23,14 +30,16 @@ func UploadBytes(toUpload []byte, fileKey string, gcpProjectName string, gcpBuck
 	log.Debugln("Uploading data to bucket")
 	i, err := wc.Write(toUpload)
 	if err != nil {
-		log.Fatalln(err)
+		wc.Close()
+		return err
 	}
 	err = wc.Close()
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
 	log.Debugf("Wrote %d\n", i)
 	log.Debugln("Finished uploading data to bucket")
+	return nil
 }
 
 func CreateInstance(
@@ -0,0 +1,125 @@
+package common
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/compute/metadata"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// HostInfo is the fingerprint of the machine a runner executes the benchmarks on, sent when the runner registers.
+	// Fields which cannot be read on the host stay empty.
+	HostInfo struct {
+		Hostname    string
+		CpuModel    string
+		CpuFlags    string
+		Microcode   string
+		Cores       int
+		MemTotalKb  uint64
+		Kernel      string
+		Clocksource string
+		GoVersion   string
+		GoEnv       string // output of go env -json
+		MachineType string // cloud metadata, empty outside of GCP
+		Zone        string
+		InstanceId  string
+	}
+
+	// Registration is the reply of the orchestrator to a registering runner. The runner sends it ahead of
+	// every batch of measurements, so that the orchestrator knows which host and instance they come from.
+	Registration struct {
+		HostId int64
+		IrPos  int
+	}
+)
+
+// CollectHostInfo reads the fingerprint of the host from /proc, /sys, the go tool and the GCP metadata server.
+func CollectHostInfo() HostInfo {
+	var host HostInfo
+	host.Hostname, _ = os.Hostname()
+	host.Cores = runtime.NumCPU()
+
+	if cpuinfo, err := os.ReadFile("/proc/cpuinfo"); err == nil {
+		host.CpuModel, host.CpuFlags, host.Microcode = parseCpuInfo(string(cpuinfo))
+	} else {
+		log.Warnf("Could not read cpu info: %v", err)
+	}
+	if meminfo, err := os.ReadFile("/proc/meminfo"); err == nil {
+		host.MemTotalKb = parseMemInfo(string(meminfo))
+	}
+
+	host.Kernel = readTrimmed("/proc/sys/kernel/osrelease")
+	host.Clocksource = readTrimmed("/sys/devices/system/clocksource/clocksource0/current_clocksource")
+	host.GoVersion = commandOutput("go", "version")
+	host.GoEnv = commandOutput("go", "env", "-json")
+
+	if metadata.OnGCE() {
+		if machineType, err := metadata.Get("instance/machine-type"); err == nil {
+			host.MachineType = path.Base(machineType) // projects/<number>/machineTypes/<type>
+		}
+		host.Zone, _ = metadata.Zone()
+		host.InstanceId, _ = metadata.InstanceID()
+	}
+
+	return host
+}
+
+// parseCpuInfo returns the model, flags and microcode version in the content of /proc/cpuinfo.
+// All processors of a machine report the same model, the first entries are used. Arm processors
+// list their flags as Features and report neither a model name nor microcode.
+func parseCpuInfo(cpuinfo string) (model string, flags string, microcode string) {
+	for _, line := range strings.Split(cpuinfo, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		switch {
+		case key == "model name" && model == "":
+			model = value
+		case (key == "flags" || key == "Features") && flags == "":
+			flags = value
+		case key == "microcode" && microcode == "":
+			microcode = value
+		}
+	}
+	return model, flags, microcode
+}
+
+// parseMemInfo returns the total memory in the content of /proc/meminfo, 0 if it is not listed.
+func parseMemInfo(meminfo string) uint64 {
+	for _, line := range strings.Split(meminfo, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			total, _ := strconv.ParseUint(fields[1], 10, 64)
+			return total
+		}
+	}
+	return 0
+}
+
+// readTrimmed returns the content of a small file, empty if it cannot be read.
+func readTrimmed(fileName string) string {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// commandOutput returns the output of the command, empty if it fails.
+func commandOutput(name string, args ...string) string {
+	out, err := exec.Command(name, args...).Output()
+	if err != nil {
+		log.Warnf("Could not run %s %v: %v", name, args, err)
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
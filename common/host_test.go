@@ -0,0 +1,71 @@
+package common
+
+import "testing"
+
+const (
+	x86CpuInfo = `processor	: 0
+vendor_id	: GenuineIntel
+cpu family	: 6
+model		: 85
+model name	: Intel(R) Xeon(R) CPU @ 2.20GHz
+stepping	: 7
+microcode	: 0xffffffff
+cpu MHz		: 2200.214
+flags		: fpu vme de pse tsc msr pae avx2 avx512f
+bogomips	: 4400.42
+
+processor	: 1
+vendor_id	: GenuineIntel
+model name	: Intel(R) Xeon(R) CPU @ 2.20GHz
+microcode	: 0x1
+flags		: fpu vme
+`
+	arm64CpuInfo = `processor	: 0
+BogoMIPS	: 243.75
+Features	: fp asimd evtstrm aes pmull sha1 sha2 crc32 atomics fphp asimdhp cpuid asimdrdm lrcpc dcpop asimddp
+CPU implementer	: 0x41
+CPU architecture: 8
+CPU variant	: 0x3
+CPU part	: 0xd0c
+CPU revision	: 1
+
+processor	: 1
+BogoMIPS	: 243.75
+Features	: fp asimd
+`
+)
+
+func TestParseCpuInfo(t *testing.T) {
+	tests := []struct {
+		name, cpuinfo           string
+		model, flags, microcode string
+	}{
+		{"x86", x86CpuInfo, "Intel(R) Xeon(R) CPU @ 2.20GHz", "fpu vme de pse tsc msr pae avx2 avx512f", "0xffffffff"},
+		{"arm64", arm64CpuInfo, "",
+			"fp asimd evtstrm aes pmull sha1 sha2 crc32 atomics fphp asimdhp cpuid asimdrdm lrcpc dcpop asimddp", ""},
+		{"empty", "", "", "", ""},
+	}
+	for _, test := range tests {
+		model, flags, microcode := parseCpuInfo(test.cpuinfo)
+		if model != test.model || flags != test.flags || microcode != test.microcode {
+			t.Errorf("%s: parseCpuInfo = %q, %q, %q, want %q, %q, %q",
+				test.name, model, flags, microcode, test.model, test.flags, test.microcode)
+		}
+	}
+}
+
+func TestParseMemInfo(t *testing.T) {
+	tests := []struct {
+		name, meminfo string
+		want          uint64
+	}{
+		{"x86", "MemTotal:       16380400 kB\nMemFree:         1002388 kB\nMemAvailable:    9870100 kB\n", 16380400},
+		{"arm64", "MemTotal:        8024364 kB\nMemFree:          312004 kB\n", 8024364},
+		{"missing", "MemFree:          312004 kB\n", 0},
+	}
+	for _, test := range tests {
+		if got := parseMemInfo(test.meminfo); got != test.want {
+			t.Errorf("%s: parseMemInfo = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package common
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Isolation describes how benchmark processes are separated from the runner and
+	// the rest of the system. Empty or zero values leave the respective setting untouched.
+	Isolation struct {
+		CpuSet       string // cpu list (taskset syntax, e.g. "1" or "2-3") the go test process is pinned to
+		RunnerCpuSet string // cpu list the runner itself is moved to
+		GoMaxProcs   int    // GOMAXPROCS and -cpu value of the benchmark process (0 keeps -cpu 1)
+		Nice         int    // niceness of the benchmark process, negative values raise the priority
+	}
+)
+
+// ParseCpuList converts a cpu list like "0,2-3" into the contained cpu numbers.
+func ParseCpuList(cpuList string) ([]int, error) {
+	cpus := make([]int, 0, 4)
+	for _, part := range strings.Split(cpuList, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cpu list %q", cpuList)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(to)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid cpu list %q", cpuList)
+			}
+		}
+		if start < 0 || end < start {
+			return nil, errors.Errorf("invalid cpu range %q in cpu list %q", part, cpuList)
+		}
+
+		for cpu := start; cpu <= end; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+
+	if len(cpus) == 0 {
+		return nil, errors.Errorf("empty cpu list %q", cpuList)
+	}
+	return cpus, nil
+}
+
+// Validate checks the settings and disables the ones which cannot be applied on this host,
+// so that the recorded settings always reflect what was actually used.
+func (iso *Isolation) Validate() {
+	if iso.CpuSet != "" {
+		if _, err := ParseCpuList(iso.CpuSet); err != nil {
+			log.Warnf("Ignoring benchmark cpu set: %v", err)
+			iso.CpuSet = ""
+		} else if _, err := exec.LookPath("taskset"); err != nil {
+			log.Warnf("Ignoring benchmark cpu set %s, taskset not available: %v", iso.CpuSet, err)
+			iso.CpuSet = ""
+		}
+	}
+
+	if iso.Nice != 0 {
+		if _, err := exec.LookPath("nice"); err != nil {
+			log.Warnf("Ignoring niceness %d, nice not available: %v", iso.Nice, err)
+			iso.Nice = 0
+		} else if iso.Nice < 0 && !priorityRaisable(iso.Nice) {
+			log.Warnf("Ignoring niceness %d, raising the priority is not permitted (requires CAP_SYS_NICE)", iso.Nice)
+			iso.Nice = 0
+		}
+	}
+
+	if iso.GoMaxProcs < 0 {
+		log.Warnf("Ignoring invalid GOMAXPROCS %d", iso.GoMaxProcs)
+		iso.GoMaxProcs = 0
+	}
+}
+
+// priorityRaisable checks whether a process started with nice -n adjustment runs at a lower niceness than the
+// runner. Without permission, nice only prints a warning and starts the process at the current niceness.
+func priorityRaisable(adjustment int) bool {
+	current, err := niceness(0)
+	if err != nil {
+		log.Warnf("Could not read niceness: %v", err)
+		return false
+	}
+	raised, err := niceness(adjustment)
+	if err != nil {
+		log.Warnf("Could not read niceness: %v", err)
+		return false
+	}
+	return raised < current
+}
+
+// niceness returns the niceness of a process started with nice -n adjustment, read from nice without arguments.
+func niceness(adjustment int) (int, error) {
+	out, err := exec.Command("nice", "-n", strconv.Itoa(adjustment), "nice").Output()
+	if err != nil {
+		return 0, errors.Wrap(err, "running nice")
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
+
+// CpuFlag returns the value for the -cpu flag of go test.
+func (iso *Isolation) CpuFlag() string {
+	if iso == nil || iso.GoMaxProcs == 0 {
+		return "1"
+	}
+	return strconv.Itoa(iso.GoMaxProcs)
+}
+
+// Command creates the command for running go with the given arguments. The go process is
+// wrapped with nice and taskset, so that the compiler and the test binary inherit priority
+// and cpu affinity.
+func (iso *Isolation) Command(goArgs ...string) *exec.Cmd {
+	args := make([]string, 0, len(goArgs)+6)
+	if iso != nil && iso.Nice != 0 {
+		args = append(args, "nice", "-n", strconv.Itoa(iso.Nice))
+	}
+	if iso != nil && iso.CpuSet != "" {
+		args = append(args, "taskset", "-c", iso.CpuSet)
+	}
+	args = append(args, "go")
+	args = append(args, goArgs...)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	if iso != nil && iso.GoMaxProcs > 0 {
+		cmd.Env = append(cmd.Environ(), fmt.Sprintf("GOMAXPROCS=%d", iso.GoMaxProcs))
+	}
+	return cmd
+}
+
+// PinRunner moves the current process to RunnerCpuSet, if configured. On failure the setting
+// is cleared, as the runner keeps running unpinned.
+func (iso *Isolation) PinRunner() {
+	if iso.RunnerCpuSet == "" {
+		return
+	}
+
+	cpus, err := ParseCpuList(iso.RunnerCpuSet)
+	if err == nil {
+		err = pinProcess(cpus)
+	}
+	if err != nil {
+		log.Warnf("Could not pin runner to cpus %s: %v", iso.RunnerCpuSet, err)
+		iso.RunnerCpuSet = ""
+		return
+	}
+	log.Debugf("Pinned runner to cpus %s", iso.RunnerCpuSet)
+}
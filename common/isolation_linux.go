@@ -0,0 +1,36 @@
+//go:build linux
+
+package common
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// pinProcess sets the cpu affinity of every thread of the current process. Threads created
+// later inherit the affinity of the thread creating them.
+func pinProcess(cpus []int) error {
+	var set unix.CPUSet
+	set.Zero()
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return errors.Wrap(err, "listing threads")
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if err := unix.SchedSetaffinity(tid, &set); err != nil {
+			return errors.Wrapf(err, "sched_setaffinity for thread %d", tid)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package common
+
+import "github.com/pkg/errors"
+
+// pinProcess is only supported on linux.
+func pinProcess(cpus []int) error {
+	return errors.New("cpu pinning is only supported on linux")
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseCpuList checks single cpus, ranges and invalid cpu lists.
+func TestParseCpuList(t *testing.T) {
+	cpus, err := ParseCpuList("0,2-4")
+	if err != nil || !reflect.DeepEqual(cpus, []int{0, 2, 3, 4}) {
+		t.Fatalf(`ParseCpuList("0,2-4") = %v, %v, want [0 2 3 4], nil`, cpus, err)
+	}
+
+	for _, invalid := range []string{"", "a", "3-1", "1-x"} {
+		if _, err := ParseCpuList(invalid); err == nil {
+			t.Fatalf(`ParseCpuList(%q) returned no error`, invalid)
+		}
+	}
+}
+
+// TestValidateNice checks that a raised priority is only kept if the benchmark process actually runs with it.
+func TestValidateNice(t *testing.T) {
+	current, err := niceness(0)
+	if err != nil {
+		t.Skipf("nice not available: %v", err)
+	}
+	if current < 19 {
+		if lowered, err := niceness(1); err != nil || lowered != current+1 {
+			t.Errorf("niceness(1) = %d, %v, want %d", lowered, err, current+1)
+		}
+	}
+
+	raised, err := niceness(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iso := Isolation{Nice: -1}
+	iso.Validate()
+	if permitted := raised < current; permitted && iso.Nice != -1 || !permitted && iso.Nice != 0 {
+		t.Errorf("niceness -1 runs at %d instead of %d, Validate kept Nice %d", raised, current, iso.Nice)
+	}
+
+	iso = Isolation{Nice: 5}
+	iso.Validate()
+	if iso.Nice != 5 {
+		t.Errorf("Validate changed niceness 5 to %d", iso.Nice)
+	}
+}
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type (
+	// BenchmarkName is a benchmark name split into its parts, e.g., BenchmarkEncode/size=1024/json-8
+	// has the function BenchmarkEncode, the sub-benchmark path size=1024/json, and was run with 8 procs.
+	BenchmarkName struct {
+		Function string
+		Sub      string
+		Params   []BenchmarkParam
+		Procs    int
+	}
+
+	// BenchmarkParam is a single parameter of a sub-benchmark path. Key is empty for positional
+	// parameters, Level is the 1-based position of the path element below the function.
+	BenchmarkParam struct {
+		Key   string
+		Value string
+		Level int
+	}
+)
+
+var regexProcsSuffix = regexp.MustCompile(`-(\d+)$`)
+
+// ParseBenchmarkName splits a benchmark name as printed by go test. go test appends -N to the
+// name if GOMAXPROCS N is not 1, which is ambiguous with names ending in -N. Pass the procs the
+// benchmark ran with to only strip that suffix, or 0 if unknown to strip any numeric suffix.
+func ParseBenchmarkName(name string, procs int) BenchmarkName {
+	parsed := BenchmarkName{Procs: 1}
+	if procs == 0 {
+		if match := regexProcsSuffix.FindStringSubmatch(name); match != nil {
+			parsed.Procs, _ = strconv.Atoi(match[1])
+			name = strings.TrimSuffix(name, match[0])
+		}
+	} else {
+		parsed.Procs = procs
+		if procs != 1 {
+			name = strings.TrimSuffix(name, "-"+strconv.Itoa(procs))
+		}
+	}
+
+	parsed.Function, parsed.Sub, _ = strings.Cut(name, "/")
+	if parsed.Sub == "" {
+		return parsed
+	}
+
+	for i, elem := range strings.Split(parsed.Sub, "/") {
+		level := i + 1
+
+		// key=value pairs, possibly several per element, e.g., size=1024,parallel=4
+		pairs := strings.Split(elem, ",")
+		allPairs := true
+		for _, pair := range pairs {
+			if key, _, found := strings.Cut(pair, "="); !found || key == "" {
+				allPairs = false
+				break
+			}
+		}
+
+		if !allPairs {
+			parsed.Params = append(parsed.Params, BenchmarkParam{Value: elem, Level: level})
+			continue
+		}
+		for _, pair := range pairs {
+			key, value, _ := strings.Cut(pair, "=")
+			parsed.Params = append(parsed.Params, BenchmarkParam{Key: key, Value: value, Level: level})
+		}
+	}
+	return parsed
+}
+
+// Name joins function and sub-benchmark path again, without the procs suffix.
+func (name BenchmarkName) Name() string {
+	if name.Sub == "" {
+		return name.Function
+	}
+	return name.Function + "/" + name.Sub
+}
+
+// ParamsJSON encodes the parameters as JSON object for storage. Positional parameters are keyed by their level.
+func (name BenchmarkName) ParamsJSON() string {
+	params := make(map[string]string, len(name.Params))
+	for _, p := range name.Params {
+		key := p.Key
+		if key == "" {
+			key = strconv.Itoa(p.Level)
+		}
+		params[key] = p.Value
+	}
+	encoded, _ := json.Marshal(params) // map[string]string can always be encoded
+	return string(encoded)
+}
@@ -0,0 +1,162 @@
+package common
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// SystemNoise summarizes the state of the host during a benchmark execution.
+	// CPU shares are given in percent of the total cpu time between the two samples.
+	SystemNoise struct {
+		Sampled          bool
+		CpuUserPct       float64
+		CpuSystemPct     float64
+		CpuIowaitPct     float64
+		CpuStealPct      float64
+		CtxSwitches      uint64
+		LoadAvg1         float64
+		MemAvailableKb   uint64
+		MemPressureAvg10 float64
+	}
+
+	// SystemSample is a single reading of the counters in /proc.
+	SystemSample struct {
+		cpuTimes         [8]uint64 // user, nice, system, idle, iowait, irq, softirq, steal
+		ctxSwitches      uint64
+		loadAvg1         float64
+		memAvailableKb   uint64
+		memPressureAvg10 float64
+	}
+)
+
+// SampleSystem reads the current cpu times, context switches, load average and memory state.
+// Memory pressure is only available on kernels with PSI support and stays 0 otherwise.
+func SampleSystem() (*SystemSample, error) {
+	stat, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return nil, errors.Wrap(err, "reading /proc/stat")
+	}
+	loadavg, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil, errors.Wrap(err, "reading /proc/loadavg")
+	}
+	meminfo, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return nil, errors.Wrap(err, "reading /proc/meminfo")
+	}
+	pressure, _ := os.ReadFile("/proc/pressure/memory")
+	return ParseSystemSample(string(stat), string(loadavg), string(meminfo), string(pressure)), nil
+}
+
+// ParseSystemSample parses the contents of /proc/stat, /proc/loadavg, /proc/meminfo and /proc/pressure/memory,
+// pressure is empty without PSI support.
+func ParseSystemSample(stat string, loadavg string, meminfo string, pressure string) *SystemSample {
+	var sample SystemSample
+	for _, line := range strings.Split(stat, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "cpu":
+			for i := 0; i < len(sample.cpuTimes) && i+1 < len(fields); i++ {
+				sample.cpuTimes[i], _ = strconv.ParseUint(fields[i+1], 10, 64)
+			}
+		case "ctxt":
+			sample.ctxSwitches, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+
+	if fields := strings.Fields(loadavg); len(fields) > 0 {
+		sample.loadAvg1, _ = strconv.ParseFloat(fields[0], 64)
+	}
+
+	for _, line := range strings.Split(meminfo, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			sample.memAvailableKb, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+
+	// e.g. "some avg10=0.00 avg60=0.00 avg300=0.00 total=0"
+	for _, line := range strings.Split(pressure, "\n") {
+		if !strings.HasPrefix(line, "some ") {
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			if strings.HasPrefix(field, "avg10=") {
+				sample.memPressureAvg10, _ = strconv.ParseFloat(strings.TrimPrefix(field, "avg10="), 64)
+			}
+		}
+	}
+
+	return &sample
+}
+
+// SummarizeNoise computes the noise between two samples. Load and memory pressure are the
+// maximum of both samples, available memory the minimum.
+func SummarizeNoise(before *SystemSample, after *SystemSample) SystemNoise {
+	if before == nil || after == nil {
+		return SystemNoise{}
+	}
+
+	var delta [8]uint64
+	var total uint64
+	for i := range delta {
+		if after.cpuTimes[i] > before.cpuTimes[i] {
+			delta[i] = after.cpuTimes[i] - before.cpuTimes[i]
+		}
+		total += delta[i]
+	}
+	pct := func(ticks uint64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return 100 * float64(ticks) / float64(total)
+	}
+
+	noise := SystemNoise{
+		Sampled:          true,
+		CpuUserPct:       pct(delta[0] + delta[1]),
+		CpuSystemPct:     pct(delta[2] + delta[5] + delta[6]),
+		CpuIowaitPct:     pct(delta[4]),
+		CpuStealPct:      pct(delta[7]),
+		LoadAvg1:         after.loadAvg1,
+		MemAvailableKb:   after.memAvailableKb,
+		MemPressureAvg10: after.memPressureAvg10,
+	}
+	if after.ctxSwitches > before.ctxSwitches {
+		noise.CtxSwitches = after.ctxSwitches - before.ctxSwitches
+	}
+	if before.loadAvg1 > noise.LoadAvg1 {
+		noise.LoadAvg1 = before.loadAvg1
+	}
+	if before.memAvailableKb < noise.MemAvailableKb {
+		noise.MemAvailableKb = before.memAvailableKb
+	}
+	if before.memPressureAvg10 > noise.MemPressureAvg10 {
+		noise.MemPressureAvg10 = before.memPressureAvg10
+	}
+	return noise
+}
+
+// Values returns the noise columns of a measurement, all NULL if nothing was sampled.
+func (noise SystemNoise) Values() []any {
+	if !noise.Sampled {
+		return []any{nil, nil, nil, nil, nil, nil, nil, nil}
+	}
+	return []any{
+		noise.CpuUserPct,
+		noise.CpuSystemPct,
+		noise.CpuIowaitPct,
+		noise.CpuStealPct,
+		int64(noise.CtxSwitches),
+		noise.LoadAvg1,
+		int64(noise.MemAvailableKb),
+		noise.MemPressureAvg10,
+	}
+}
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSummarizeNoise checks counter deltas, a missing PSI file and that unsampled noise is stored as NULL.
+func TestSummarizeNoise(t *testing.T) {
+	meminfo := "MemTotal:       16000000 kB\nMemAvailable:    8000000 kB\n"
+	tests := []struct {
+		name          string
+		before, after *SystemSample
+		want          SystemNoise
+	}{
+		{
+			name: "deltas",
+			before: ParseSystemSample("cpu  100 0 50 800 10 0 0 0 0 0\nctxt 1000\n", "0.50 0.40 0.30 1/100 42\n", meminfo,
+				"some avg10=1.50 avg60=0.00 avg300=0.00 total=0\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n"),
+			// 200 ticks: 60 user + 20 nice, 20 system + 10 irq + 10 softirq, 60 idle, 10 iowait, 10 steal
+			after: ParseSystemSample("cpu  160 20 70 860 20 10 10 10 0 0\nctxt 1500\n", "1.25 0.50 0.30 2/100 43\n",
+				"MemAvailable:    7000000 kB\n", "some avg10=0.50 avg60=0.00 avg300=0.00 total=0\n"),
+			want: SystemNoise{Sampled: true, CpuUserPct: 40, CpuSystemPct: 20, CpuIowaitPct: 5, CpuStealPct: 5,
+				CtxSwitches: 500, LoadAvg1: 1.25, MemAvailableKb: 7000000, MemPressureAvg10: 1.5},
+		},
+		{
+			name:   "no psi and no cpu time passed",
+			before: ParseSystemSample("cpu  100 0 50 800 10 0 0 0\nctxt 1000\n", "0.50 0.40 0.30 1/100 42\n", meminfo, ""),
+			after:  ParseSystemSample("cpu  100 0 50 800 10 0 0 0\nctxt 900\n", "0.25 0.40 0.30 1/100 42\n", meminfo, ""),
+			want:   SystemNoise{Sampled: true, LoadAvg1: 0.5, MemAvailableKb: 8000000},
+		},
+		{
+			name:  "not sampled",
+			after: ParseSystemSample("cpu  1 2 3 4 5 6 7 8\n", "", "", ""),
+			want:  SystemNoise{},
+		},
+	}
+
+	for _, test := range tests {
+		got := SummarizeNoise(test.before, test.after)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: SummarizeNoise = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	if values := (SystemNoise{}).Values(); !reflect.DeepEqual(values, make([]any, 8)) {
+		t.Errorf("values of unsampled noise = %v, want 8 NULLs", values)
+	}
+	if values := tests[0].want.Values(); values[4] != int64(500) || values[6] != int64(7000000) {
+		t.Errorf("values of sampled noise = %v", values)
+	}
+}
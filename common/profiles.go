@@ -0,0 +1,137 @@
+package common
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// ProfileOptions configures which profiles are recorded during benchmark executions.
+	ProfileOptions struct {
+		Kinds    []string // any of cpu, mem, block, mutex and trace
+		Sampling float64  // probability of profiling a single go test execution, in (0, 1]
+		Dir      string   // absolute directory the profiles are written to, one subdirectory per kind
+		Bucket   string   // bucket the profiles are uploaded to
+		KeyBase  string   // prefix of the bucket object keys
+	}
+
+	// ProfileFile indexes a profile recorded during a benchmark execution.
+	ProfileFile struct {
+		Kind      string
+		LocalPath string
+		Bucket    string
+		ObjectKey string
+		Tag       string
+		BedPos    int
+		ItPos     int
+		SrPos     int
+	}
+)
+
+// PROFILE_FLAGS maps the supported profile kinds to their go test flags.
+var PROFILE_FLAGS = map[string]string{
+	"cpu":   "-cpuprofile",
+	"mem":   "-memprofile",
+	"block": "-blockprofile",
+	"mutex": "-mutexprofile",
+	"trace": "-trace",
+}
+
+var regexUnsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// ParseProfileKinds splits a comma separated list of profile kinds and checks that they are supported.
+func ParseProfileKinds(kinds string) ([]string, error) {
+	parsed := make([]string, 0, len(PROFILE_FLAGS))
+	for _, kind := range strings.Split(kinds, ",") {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		if kind == "" {
+			continue
+		}
+		if _, ok := PROFILE_FLAGS[kind]; !ok {
+			return nil, errors.Errorf("unsupported profile kind %q", kind)
+		}
+		parsed = append(parsed, kind)
+	}
+	return parsed, nil
+}
+
+// Enabled reports whether any profile kind is selected.
+func (opts *ProfileOptions) Enabled() bool {
+	return opts != nil && len(opts.Kinds) > 0
+}
+
+// CreateDirs creates the directories the profiles are written to.
+func (opts *ProfileOptions) CreateDirs() error {
+	for _, kind := range opts.Kinds {
+		if err := os.MkdirAll(filepath.Join(opts.Dir, kind), os.ModePerm); err != nil {
+			return errors.Wrapf(err, "creating profile directory for %s", kind)
+		}
+	}
+	return nil
+}
+
+// sample decides whether the next execution is profiled.
+func (opts *ProfileOptions) sample() bool {
+	if !opts.Enabled() {
+		return false
+	}
+	return opts.Sampling >= 1 || rand.Float64() < opts.Sampling
+}
+
+// profileArgs returns the go test arguments for profiling one execution of bench, together with
+// the index of the files to be written. The file names contain package, benchmark, tag and
+// positions, plus a hash of those, since sanitizing the names alone is not collision free.
+func (opts *ProfileOptions) profileArgs(bench *Benchmark, tag string, bedPos int, itPos int, srPos int) ([]string, []ProfileFile) {
+	key := fmt.Sprintf("%s|%s|%s|%d|%d|%d", bench.ProjectPackage(), bench.Name, tag, srPos, itPos, bedPos)
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+
+	base := regexUnsafeFileChars.ReplaceAllString(fmt.Sprintf("%s_%s_%s_sr%d_it%d_bed%d", bench.ProjectPackage(), bench.Name, tag, srPos, itPos, bedPos), "_")
+	base = strings.Trim(base, "._")
+	fileName := fmt.Sprintf("%s_%08x.out", base, hash.Sum32())
+
+	args := make([]string, 0, 2*len(opts.Kinds))
+	files := make([]ProfileFile, 0, len(opts.Kinds))
+	for _, kind := range opts.Kinds {
+		localPath := filepath.Join(opts.Dir, kind, fileName)
+		args = append(args, PROFILE_FLAGS[kind], localPath)
+		files = append(files, ProfileFile{
+			Kind:      kind,
+			LocalPath: localPath,
+			Bucket:    opts.Bucket,
+			ObjectKey: opts.KeyBase + "/" + kind + "/" + fileName,
+			Tag:       tag,
+			BedPos:    bedPos,
+			ItPos:     itPos,
+			SrPos:     srPos,
+		})
+	}
+	return args, files
+}
+
+// UploadProfiles uploads the recorded profiles and returns those that were uploaded, so that only profiles
+// present in the bucket are indexed by the orchestrator. Profiles that could not be read or uploaded are dropped.
+func UploadProfiles(profiles []ProfileFile, upload func(profile ProfileFile, data []byte) error) []ProfileFile {
+	uploaded := make([]ProfileFile, 0, len(profiles))
+	for _, profile := range profiles {
+		data, err := os.ReadFile(profile.LocalPath)
+		if err != nil {
+			log.Warnf("Could not read profile %s: %v", profile.LocalPath, err)
+			continue
+		}
+		if err := upload(profile, data); err != nil {
+			log.Warnf("Could not upload profile %s to %s: %v", profile.LocalPath, profile.ObjectKey, err)
+			continue
+		}
+		uploaded = append(uploaded, profile)
+	}
+	return uploaded
+}
@@ -0,0 +1,107 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProfileKinds(t *testing.T) {
+	tests := []struct {
+		kinds   string
+		want    []string
+		invalid bool
+	}{
+		{"", []string{}, false},
+		{"cpu", []string{"cpu"}, false},
+		{" CPU, mem ,,trace", []string{"cpu", "mem", "trace"}, false},
+		{"block,mutex", []string{"block", "mutex"}, false},
+		{"cpu,heap", nil, true},
+	}
+	for _, test := range tests {
+		got, err := ParseProfileKinds(test.kinds)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("ParseProfileKinds(%q) returned no error", test.kinds)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseProfileKinds(%q) = %v, %v, want %v, nil", test.kinds, got, err, test.want)
+		}
+	}
+}
+
+func TestProfileArgs(t *testing.T) {
+	opts := &ProfileOptions{Kinds: []string{"cpu", "trace"}, Sampling: 1, Dir: "/tmp/profiles", Bucket: "bucket", KeyBase: "host/profiles"}
+	bench := &Benchmark{Name: "BenchmarkEncode/small", Package: "./sub", Module: "./api"}
+
+	args, files := opts.profileArgs(bench, "v1.2.0", 3, 2, 1)
+	if len(args) != 4 || args[0] != "-cpuprofile" || args[2] != "-trace" {
+		t.Fatalf("profileArgs = %v, want -cpuprofile <path> -trace <path>", args)
+	}
+	if len(files) != 2 {
+		t.Fatalf("profileArgs indexed %d files, want 2", len(files))
+	}
+	for i, file := range files {
+		if args[2*i+1] != file.LocalPath {
+			t.Errorf("%s profile is written to %s, but indexed as %s", file.Kind, args[2*i+1], file.LocalPath)
+		}
+		name := filepath.Base(file.LocalPath)
+		if filepath.Dir(file.LocalPath) != filepath.Join(opts.Dir, file.Kind) {
+			t.Errorf("%s profile is written to %s, want a file in %s", file.Kind, file.LocalPath, filepath.Join(opts.Dir, file.Kind))
+		}
+		if strings.ContainsAny(name, "/ ") || !strings.HasPrefix(name, "api_sub_BenchmarkEncode_small_v1.2.0_sr1_it2_bed3_") {
+			t.Errorf("unexpected profile file name %s", name)
+		}
+		if want := "host/profiles/" + file.Kind + "/" + name; file.ObjectKey != want {
+			t.Errorf("object key %s, want %s", file.ObjectKey, want)
+		}
+		if file.Bucket != "bucket" || file.Tag != "v1.2.0" || file.BedPos != 3 || file.ItPos != 2 || file.SrPos != 1 {
+			t.Errorf("unexpected profile index %+v", file)
+		}
+	}
+
+	// names which only differ in characters replaced by the sanitizing still get different files
+	_, other := opts.profileArgs(&Benchmark{Name: "BenchmarkEncode_small", Package: "./sub", Module: "./api"}, "v1.2.0", 3, 2, 1)
+	if other[0].LocalPath == files[0].LocalPath {
+		t.Errorf("BenchmarkEncode/small and BenchmarkEncode_small share the profile %s", files[0].LocalPath)
+	}
+	_, next := opts.profileArgs(bench, "v1.2.0", 4, 2, 1)
+	if next[0].LocalPath == files[0].LocalPath {
+		t.Errorf("bed positions 3 and 4 share the profile %s", files[0].LocalPath)
+	}
+}
+
+// TestUploadProfiles checks that only uploaded profiles are kept in the index.
+func TestUploadProfiles(t *testing.T) {
+	dir := t.TempDir()
+	profiles := make([]ProfileFile, 0, 3)
+	for _, name := range []string{"ok", "failing", "missing"} {
+		path := filepath.Join(dir, name+".out")
+		if name != "missing" {
+			if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		profiles = append(profiles, ProfileFile{Kind: "cpu", LocalPath: path, ObjectKey: "profiles/cpu/" + name + ".out"})
+	}
+
+	uploads := make(map[string]string)
+	uploaded := UploadProfiles(profiles, func(profile ProfileFile, data []byte) error {
+		if string(data) == "failing" {
+			return errors.New("upload failed")
+		}
+		uploads[profile.ObjectKey] = string(data)
+		return nil
+	})
+	if len(uploaded) != 1 || uploaded[0] != profiles[0] {
+		t.Errorf("UploadProfiles kept %v, want only %v", uploaded, profiles[0])
+	}
+	if len(uploads) != 1 || uploads["profiles/cpu/ok.out"] != "ok" {
+		t.Errorf("uploaded %v, want only profiles/cpu/ok.out", uploads)
+	}
+}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"bytes"
+	"debug/buildinfo"
+	"runtime/debug"
+	"strings"
+)
+
+// VERSION_LDFLAG is the linker flag setting Version at build time, e.g., go build -ldflags "-X cloud-benchmark-tool/common.Version=v1.2.0".
+const VERSION_LDFLAG = "cloud-benchmark-tool/common.Version="
+
+// Version of the binary, set at build time. If empty, the version is derived from the build information.
+var Version = ""
+
+// BuildVersion returns the version of the running binary.
+func BuildVersion() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	return versionFromBuildInfo(info)
+}
+
+// BinaryVersion returns the version of a Go binary, e.g., the runner embedded in the orchestrator.
+func BinaryVersion(binary []byte) string {
+	info, err := buildinfo.Read(bytes.NewReader(binary))
+	if err != nil {
+		return "unknown"
+	}
+	return versionFromBuildInfo(info)
+}
+
+// versionFromBuildInfo returns the version set by VERSION_LDFLAG, otherwise the VCS revision the binary was built from,
+// suffixed by -dirty for uncommitted changes, otherwise the module version.
+func versionFromBuildInfo(info *debug.BuildInfo) string {
+	var revision string
+	var modified bool
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "-ldflags":
+			if _, version, found := strings.Cut(setting.Value, VERSION_LDFLAG); found {
+				fields := strings.Fields(version)
+				if len(fields) > 0 && strings.Trim(fields[0], `"'`) != "" {
+					return strings.Trim(fields[0], `"'`)
+				}
+			}
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+
+	if revision == "" {
+		return info.Main.Version
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,142 @@
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// MIN_BOOTSTRAP_STDDEV replaces standard deviations of 0 of bootstrap samples in the studentized bootstrap.
+const MIN_BOOTSTRAP_STDDEV = 0.000001
+
+// Interval is a confidence interval.
+type Interval struct {
+	Lower float64
+	Upper float64
+}
+
+// Width returns the absolute width of the interval.
+func (i Interval) Width() float64 {
+	return math.Abs(i.Upper - i.Lower)
+}
+
+// resample draws a bootstrap sample of the data into sample.
+func resample(data []float64, sample []float64, rng *rand.Rand) {
+	for i := range sample {
+		sample[i] = data[rng.Intn(len(data))]
+	}
+}
+
+// percentileInterval returns the two-sided interval of the bootstrap distribution at confidence level cl in percent.
+func percentileInterval(dist []float64, cl float64) Interval {
+	sort.Float64s(dist)
+	lower := (100 - cl) / 2
+	return Interval{percentileSorted(dist, lower), percentileSorted(dist, cl+lower)}
+}
+
+// CiBootstrapMeanP returns the confidence interval of the mean with the percentile bootstrap of it iterations.
+func CiBootstrapMeanP(data []float64, it int, cl float64, rng *rand.Rand) Interval {
+	sample := make([]float64, len(data))
+	dist := make([]float64, it)
+	for i := range dist {
+		resample(data, sample, rng)
+		dist[i] = Mean(sample)
+	}
+	return percentileInterval(dist, cl)
+}
+
+// CiBootstrapMedianP returns the confidence interval of the median with the percentile bootstrap of it iterations.
+func CiBootstrapMedianP(data []float64, it int, cl float64, rng *rand.Rand) Interval {
+	sample := make([]float64, len(data))
+	dist := make([]float64, it)
+	for i := range dist {
+		resample(data, sample, rng)
+		sort.Float64s(sample)
+		dist[i] = percentileSorted(sample, 50)
+	}
+	return percentileInterval(dist, cl)
+}
+
+// CiBootstrapMeanT returns the confidence interval of the mean with the studentized bootstrap of it iterations.
+// The bootstrap t statistics use the sample standard deviation of each bootstrap sample, non-finite ones count as 0.
+func CiBootstrapMeanT(data []float64, it int, cl float64, rng *rand.Rand) Interval {
+	n := float64(len(data))
+	origMean := Mean(data)
+	origStdDev := StdDev(data)
+
+	sample := make([]float64, len(data))
+	tStar := make([]float64, it)
+	for i := range tStar {
+		resample(data, sample, rng)
+		bsStdDev := StdDev(sample)
+		if bsStdDev == 0 {
+			bsStdDev = MIN_BOOTSTRAP_STDDEV
+		}
+		tStar[i] = finiteOrZero((Mean(sample) - origMean) / (bsStdDev / math.Sqrt(n)))
+	}
+	p := percentileInterval(tStar, cl)
+	return Interval{origMean - p.Upper*origStdDev/math.Sqrt(n), origMean - p.Lower*origStdDev/math.Sqrt(n)}
+}
+
+// CiBootstrapMedianT returns the confidence interval of the median with the studentized bootstrap of it iterations.
+// Like stat_functions.py, the medians are studentized by the square root of their Maritz-Jarrett standard error.
+// This includes the original median, as for the results in optimizer/go_optimization.
+func CiBootstrapMedianT(data []float64, it int, cl float64, rng *rand.Rand) Interval {
+	origMedian := Median(data)
+	weights := maritzJarrettWeights(len(data), 0.5)
+	origStdDev := math.Sqrt(maritzJarrettSeSorted(sorted(data), weights))
+
+	sample := make([]float64, len(data))
+	tStar := make([]float64, it)
+	for i := range tStar {
+		resample(data, sample, rng)
+		sort.Float64s(sample)
+		bsStdDev := math.Sqrt(maritzJarrettSeSorted(sample, weights))
+		if bsStdDev == 0 {
+			bsStdDev = MIN_BOOTSTRAP_STDDEV
+		}
+		tStar[i] = finiteOrZero((percentileSorted(sample, 50) - origMedian) / bsStdDev)
+	}
+	p := percentileInterval(tStar, cl)
+	return Interval{origMedian - p.Upper*origStdDev, origMedian - p.Lower*origStdDev}
+}
+
+// SeBootstrapMedian returns the bootstrap standard error of the median of it iterations.
+func SeBootstrapMedian(data []float64, it int, rng *rand.Rand) float64 {
+	sample := make([]float64, len(data))
+	dist := make([]float64, it)
+	for i := range dist {
+		resample(data, sample, rng)
+		dist[i] = Median(sample)
+	}
+	return StdDev(dist)
+}
+
+// RciwMeanP returns the width of the percentile bootstrap confidence interval of the mean relative to the mean.
+func RciwMeanP(data []float64, it int, cl float64, rng *rand.Rand) float64 {
+	return CiBootstrapMeanP(data, it, cl, rng).Width() / Mean(data)
+}
+
+// RciwMedianP returns the width of the percentile bootstrap confidence interval relative to the median.
+// Like stat_functions.py, the interval is the one of the mean.
+func RciwMedianP(data []float64, it int, cl float64, rng *rand.Rand) float64 {
+	return CiBootstrapMeanP(data, it, cl, rng).Width() / Median(data)
+}
+
+// RciwMeanT returns the width of the studentized bootstrap confidence interval of the mean relative to the mean.
+func RciwMeanT(data []float64, it int, cl float64, rng *rand.Rand) float64 {
+	return CiBootstrapMeanT(data, it, cl, rng).Width() / Mean(data)
+}
+
+// RciwMedianT returns the width of the studentized bootstrap confidence interval of the median.
+// Like stat_functions.py, it is relative to the mean.
+func RciwMedianT(data []float64, it int, cl float64, rng *rand.Rand) float64 {
+	return CiBootstrapMedianT(data, it, cl, rng).Width() / Mean(data)
+}
+
+func finiteOrZero(x float64) float64 {
+	if math.IsInf(x, 0) || math.IsNaN(x) {
+		return 0
+	}
+	return x
+}
@@ -0,0 +1,78 @@
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// KlDivergence returns the Kullback-Leibler divergence of the discrete distributions p and q, the sum of
+// scipy.special.rel_entr over the elements.
+func KlDivergence(p []float64, q []float64) float64 {
+	sum := 0.0
+	for i := range p {
+		switch {
+		case p[i] == 0 && q[i] >= 0:
+		case p[i] > 0 && q[i] > 0:
+			sum += p[i] * math.Log(p[i]/q[i])
+		default:
+			return math.Inf(1)
+		}
+	}
+	return sum
+}
+
+// BetterKl estimates the Kullback-Leibler divergence of the continuous distributions of two sorted samples, based on
+// "Kullback-Leibler divergence estimation of continuous distributions" (Pérez-Cruz, 2008), like better_kl.
+func BetterKl(d1 []float64, d2 []float64) float64 {
+	p := empiricalCdf(d1)
+	q := empiricalCdf(d2)
+	e := math.Min(minDiff(d1), minDiff(d2)) / 2
+
+	sum := 0.0
+	for _, x := range d2 {
+		sum += math.Log((p(x) - p(x-e)) / (q(x) - q(x-e)))
+	}
+	return sum / float64(len(d2))
+}
+
+// empiricalCdf returns the linear interpolation of the sorted sample at the knots (i+0.5)/n, 0 below and 1 above the sample.
+func empiricalCdf(data []float64) func(x float64) float64 {
+	n := float64(len(data))
+	return func(x float64) float64 {
+		if x < data[0] {
+			return 0
+		}
+		if x > data[len(data)-1] {
+			return 1
+		}
+		i := sort.SearchFloat64s(data, x) // first index with data[i] >= x
+		if data[i] == x {
+			return (float64(i) + 0.5) / n
+		}
+		frac := (x - data[i-1]) / (data[i] - data[i-1])
+		return (float64(i-1) + 0.5 + frac) / n
+	}
+}
+
+// minDiff returns the smallest difference of consecutive values.
+func minDiff(data []float64) float64 {
+	diff := math.Inf(1)
+	for i := 1; i < len(data); i++ {
+		diff = math.Min(diff, data[i]-data[i-1])
+	}
+	return diff
+}
+
+// Iou returns the intersection over union of two intervals, 0 if they do not overlap.
+func Iou(i1 Interval, i2 Interval) float64 {
+	min1, max1 := math.Min(i1.Lower, i1.Upper), math.Max(i1.Lower, i1.Upper)
+	min2, max2 := math.Min(i2.Lower, i2.Upper), math.Max(i2.Lower, i2.Upper)
+
+	higherMin := math.Max(min1, min2)
+	lowerMax := math.Min(max1, max2)
+	inner := 0.0
+	if higherMin < lowerMax {
+		inner = lowerMax - higherMin
+	}
+	return inner / (math.Max(max1, max2) - math.Min(min1, min2))
+}
@@ -0,0 +1,171 @@
+package stats
+
+import (
+	"math"
+)
+
+// MaritzJarrettSe returns the Maritz-Jarrett standard error of the p-th quantile (0 to 1), like scipy.stats.mstats.mjci.
+func MaritzJarrettSe(data []float64, p float64) float64 {
+	return maritzJarrettSeSorted(sorted(data), maritzJarrettWeights(len(data), p))
+}
+
+// maritzJarrettWeights returns the weights of the order statistics of n values for the p-th quantile,
+// they only depend on n and p and are shared by the bootstrap samples.
+func maritzJarrettWeights(n int, p float64) []float64 {
+	m := int(p*float64(n) + 0.5)
+	a, b := float64(m-1), float64(n-m)
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = BetaCdf(float64(i+1)/float64(n), a, b) - BetaCdf(float64(i)/float64(n), a, b)
+	}
+	return weights
+}
+
+// maritzJarrettSeSorted returns the standard error of the quantile of the weights for sorted data.
+func maritzJarrettSeSorted(data []float64, weights []float64) float64 {
+	c1, c2 := 0.0, 0.0
+	for i, x := range data {
+		c1 += weights[i] * x
+		c2 += weights[i] * x * x
+	}
+	return math.Sqrt(c2 - c1*c1)
+}
+
+// VarMedianMaritzJarrett returns the Maritz-Jarrett variance of the sample median, its square root is the standard error.
+// Unlike var_median_maritz_jarrett in stat_functions.py, the data does not have to be sorted.
+func VarMedianMaritzJarrett(data []float64) float64 {
+	s := sorted(data)
+	n := len(s)
+	nf := float64(n)
+	m := n / 2
+	mf := float64(m)
+
+	var res float64
+	if n%2 == 0 {
+		b1, b2 := 0.0, 0.0
+		left := make([]float64, n)
+		for i := 1; i <= n; i++ {
+			u := BetaCdf(float64(i)/nf, mf, mf) - BetaCdf(float64(i-1)/nf, mf, mf)
+			b1 += s[i-1] * u
+			b2 += s[i-1] * s[i-1] * u
+			left[i-1] = math.Pow(float64(i)/nf, mf) - math.Pow(float64(i-1)/nf, mf)
+		}
+
+		factor := (2*mf + 1) * Beta(mf+1, mf+1)
+		if factor <= 0 {
+			factor = 1e-20 // small but non-zero factor for numerical stability
+		}
+
+		// C_n = x' U x, U is upper triangular with U_ij = factor * left_i * left_(n+1-j) above the diagonal
+		cn := 0.0
+		for i := 1; i <= n; i++ {
+			fi := float64(i)
+			u := BetaCdf(fi/nf, mf, mf) - BetaCdf((fi-1)/nf, mf, mf)
+			diag := u - factor*(math.Pow(fi/nf, mf)*math.Pow((nf-fi)/nf, mf)+
+				math.Pow((fi-1)/nf, mf)*math.Pow((nf+1-fi)/nf, mf)-
+				2*math.Pow((fi-1)/nf, mf)*math.Pow((nf-fi)/nf, mf))
+			cn += s[i-1] * diag * s[i-1]
+			for j := i + 1; j <= n; j++ {
+				cn += s[i-1] * factor * left[i-1] * left[n-j] * s[j-1]
+			}
+		}
+		res = (b2+cn)/2 - b1*b1
+	} else {
+		a1, a2 := 0.0, 0.0
+		for i := 1; i <= n; i++ {
+			w := BetaCdf(float64(i)/nf, mf+1, mf+1) - BetaCdf(float64(i-1)/nf, mf+1, mf+1)
+			a1 += s[i-1] * w
+			a2 += s[i-1] * s[i-1] * w
+		}
+		res = a2 - a1*a1
+	}
+
+	if res < 0 {
+		return 0
+	}
+	return res
+}
+
+// Beta returns the beta function B(a, b).
+func Beta(a float64, b float64) float64 {
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	return math.Exp(la + lb - lab)
+}
+
+// BetaCdf returns the regularized incomplete beta function I_x(a, b), the cumulative distribution function
+// of the beta distribution, like scipy.special.betainc. It is NaN unless a and b are positive.
+func BetaCdf(x float64, a float64, b float64) float64 {
+	if a <= 0 || b <= 0 || math.IsNaN(x) {
+		return math.NaN()
+	}
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log1p(-x))
+
+	// the continued fraction converges quickly for x < (a+1)/(a+b+2), otherwise use the symmetry
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(x, a, b) / a
+	}
+	return 1 - front*betaContinuedFraction(1-x, b, a)/b
+}
+
+// betaContinuedFraction evaluates the continued fraction of the incomplete beta function with the modified Lentz method.
+func betaContinuedFraction(x float64, a float64, b float64) float64 {
+	const (
+		maxIterations = 1000
+		epsilon       = 1e-15
+		tiny          = 1e-300
+	)
+	qab, qap, qam := a+b, a+1, a-1
+	c := 1.0
+	d := 1 - qab*x/qap
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		mf := float64(m)
+		m2 := 2 * mf
+
+		// even step
+		aa := mf * (b - mf) * x / ((qam + m2) * (a + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+
+		// odd step
+		aa = -(a + mf) * (qab + mf) * x / ((a + m2) * (qap + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
@@ -0,0 +1,105 @@
+// Package stats implements the instability measures and confidence intervals of optimizer/stat_functions.py,
+// so that the orchestrator and runner can compute them without Python. Results match the Python functions,
+// including their quirks, which are noted at the respective functions. Bootstrap estimators draw from the
+// generator they are passed, so results are reproducible with a seeded one, see NewRand.
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	DEFAULT_SEED       = 42    // seed of the generator in stat_functions.py
+	DEFAULT_ITERATIONS = 10000 // bootstrap iterations
+	DEFAULT_CONFIDENCE = 99    // confidence level in percent
+)
+
+// NewRand returns a generator for the bootstrap estimators. The sequence differs from numpy's,
+// so bootstrap results match the Python functions only statistically.
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}
+
+// Mean returns the arithmetic mean, NaN for no data.
+func Mean(data []float64) float64 {
+	if len(data) == 0 {
+		return math.NaN()
+	}
+	sum := 0.0
+	for _, x := range data {
+		sum += x
+	}
+	return sum / float64(len(data))
+}
+
+// Median returns the median, the mean of the two middle values for an even number of values.
+func Median(data []float64) float64 {
+	return Percentile(data, 50)
+}
+
+// StdDev returns the sample standard deviation (n-1 degrees of freedom).
+func StdDev(data []float64) float64 {
+	n := len(data)
+	if n < 2 {
+		return math.NaN()
+	}
+	m := Mean(data)
+	squares := 0.0
+	for _, x := range data {
+		squares += (x - m) * (x - m)
+	}
+	return math.Sqrt(squares / float64(n-1))
+}
+
+// Percentile returns the p-th percentile (0 to 100) with linear interpolation between the closest ranks,
+// like numpy.percentile.
+func Percentile(data []float64, p float64) float64 {
+	return percentileSorted(sorted(data), p)
+}
+
+// percentileSorted returns the p-th percentile of sorted data.
+func percentileSorted(data []float64, p float64) float64 {
+	n := len(data)
+	if n == 0 {
+		return math.NaN()
+	}
+	rank := p / 100 * float64(n-1)
+	lower := int(math.Floor(rank))
+	if lower >= n-1 {
+		return data[n-1]
+	}
+	if lower < 0 {
+		return data[0]
+	}
+	frac := rank - float64(lower)
+	return data[lower] + frac*(data[lower+1]-data[lower])
+}
+
+// sorted returns a sorted copy of the data.
+func sorted(data []float64) []float64 {
+	s := append([]float64(nil), data...)
+	sort.Float64s(s)
+	return s
+}
+
+// Cv returns the coefficient of variation, the population standard deviation (n degrees of freedom) relative to the mean.
+func Cv(data []float64) float64 {
+	m := Mean(data)
+	squares := 0.0
+	for _, x := range data {
+		squares += (x - m) * (x - m)
+	}
+	return math.Sqrt(squares/float64(len(data))) / m
+}
+
+// Rmad returns the relative median absolute deviation, the median of the absolute deviations from the median relative to the median.
+func Rmad(data []float64) float64 {
+	m := Median(data)
+	deviations := make([]float64, len(data))
+	for i, x := range data {
+		deviations[i] = math.Abs(x - m)
+	}
+	return Median(deviations) / m
+}
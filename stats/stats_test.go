@@ -0,0 +1,145 @@
+package stats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestStatsAgainstPython compares the instability measures of the zap benchmarks with the results of stat_functions.py,
+// exactly for the deterministic ones and up to the bootstrap noise for the confidence intervals.
+func TestStatsAgainstPython(t *testing.T) {
+	data := map[string][]float64{}
+	for _, rec := range readCsv(t, "../optimizer/final_data_with_config/zap/zap.csv") {
+		if rec[10] == "1" {
+			v, _ := strconv.ParseFloat(rec[2], 64)
+			data[strings.TrimSpace(rec[11])] = append(data[strings.TrimSpace(rec[11])], v)
+		}
+	}
+
+	exact := map[string]func([]float64) float64{"cv_mean_p": Cv, "rmad_median_p": Rmad}
+	for dir, f := range exact {
+		for _, rec := range readCsv(t, "../optimizer/go_optimization/zap_results/"+dir+"/full_config_res.csv") {
+			want, _ := strconv.ParseFloat(rec[2], 64)
+			if got := f(data[rec[0]]); math.Abs(got-want) > 1e-12*math.Abs(want) {
+				t.Errorf("%s of %s = %v, want %v", dir, rec[0], got, want)
+			}
+		}
+	}
+
+	intervals := map[string]func([]float64, int, float64, *rand.Rand) Interval{
+		"rciw_mean_p":   CiBootstrapMeanP,
+		"rciw_median_t": CiBootstrapMedianT,
+	}
+	for dir, f := range intervals {
+		for _, rec := range readCsv(t, "../optimizer/go_optimization/zap_results/"+dir+"/full_config_res.csv") {
+			lower, _ := strconv.ParseFloat(rec[5], 64)
+			upper, _ := strconv.ParseFloat(rec[6], 64)
+			// both bounds are bootstrap estimates of 10000 iterations, which differ by less than a tenth of the width
+			got := f(data[rec[0]], 10000, DEFAULT_CONFIDENCE, NewRand(DEFAULT_SEED))
+			if tolerance := (upper - lower) / 10; math.Abs(got.Lower-lower) > tolerance || math.Abs(got.Upper-upper) > tolerance {
+				t.Errorf("%s of %s = %v, want [%v, %v]", dir, rec[0], got, lower, upper)
+			}
+		}
+	}
+
+	if got := BetaCdf(0.5, 37, 37); math.Abs(got-0.5) > 1e-12 {
+		t.Errorf("BetaCdf(0.5, 37, 37) = %v, want 0.5", got)
+	}
+	if got := BetaCdf(0.3, 2, 3); math.Abs(got-0.3483) > 1e-12 {
+		t.Errorf("BetaCdf(0.3, 2, 3) = %v, want 0.3483", got)
+	}
+}
+
+// TestStatsReferenceValues compares the estimators with the functions of stat_functions.py for fixed inputs. The references
+// were computed with betainc and beta evaluated exactly, and for the bootstrap intervals with all 6^6 resamples,
+// which the bootstrap of 10^6 iterations reaches.
+func TestStatsReferenceValues(t *testing.T) {
+	odd := []float64{708.8, 710.7, 706.0, 702.0, 709.0, 715.3, 704.4}
+	even := append(append([]float64{}, odd...), 711.9)
+	closeTo := func(name string, got float64, want float64) {
+		t.Helper()
+		if math.Abs(got-want) > 1e-9*math.Abs(want) && math.Abs(got-want) > 1e-12 {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+
+	closeTo("VarMedianMaritzJarrett(odd)", VarMedianMaritzJarrett(odd), 4.27766896397707)
+	closeTo("VarMedianMaritzJarrett(even)", VarMedianMaritzJarrett([]float64{8.8, 10.7, 6.0, 2.0, 9.0, 15.3, 4.4, 11.9}), 4.359331816733379)
+	closeTo("VarMedianMaritzJarrett(1..10)", VarMedianMaritzJarrett([]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}), 2.3558047619315476)
+	// the even formula cancels out for large values, the exact result -27.49 is clamped
+	closeTo("VarMedianMaritzJarrett(even ns/op)", VarMedianMaritzJarrett(even), 0)
+
+	// mjci(data, prob=[p])
+	mjci := []struct {
+		p         float64
+		odd, even float64
+	}{
+		{0.5, 2.411042168496283, 2.3564822380898156},
+		{0.25, 1.999055547832195, 1.9927272850756275},
+		{0.9, 2.800880227308808, 2.1776000909362248},
+	}
+	for _, m := range mjci {
+		closeTo(fmt.Sprintf("MaritzJarrettSe(odd, %v)", m.p), MaritzJarrettSe(odd, m.p), m.odd)
+		closeTo(fmt.Sprintf("MaritzJarrettSe(even, %v)", m.p), MaritzJarrettSe(even, m.p), m.even)
+	}
+
+	boot := odd[:6]
+	intervals := []struct {
+		name string
+		f    func([]float64, int, float64, *rand.Rand) Interval
+		cl   float64
+		want Interval
+	}{
+		{"CiBootstrapMedianP", CiBootstrapMedianP, 90, Interval{Lower: 705.4, Upper: 712.15}},
+		{"CiBootstrapMeanT", CiBootstrapMeanT, 90, Interval{Lower: 704.7629101765157, Upper: 712.0755907465866}},
+		{"CiBootstrapMeanT", CiBootstrapMeanT, 99, Interval{Lower: 701.5996819887326, Upper: 714.8944252805277}},
+	}
+	for _, i := range intervals {
+		got := i.f(boot, 1000000, i.cl, NewRand(DEFAULT_SEED))
+		if tolerance := i.want.Width() / 100; math.Abs(got.Lower-i.want.Lower) > tolerance || math.Abs(got.Upper-i.want.Upper) > tolerance {
+			t.Errorf("%s at %v%% = %v, want %v", i.name, i.cl, got, i.want)
+		}
+	}
+
+	closeTo("BetterKl", BetterKl([]float64{702.0, 704.4, 706.0, 708.8, 709.0, 710.7, 715.3},
+		[]float64{703.1, 705.5, 707.2, 709.9, 712.4, 714.0}), -0.7844219184473628)
+	closeTo("KlDivergence", KlDivergence([]float64{0.1, 0.4, 0.5}, []float64{0.2, 0.3, 0.5}), 0.04575811092471789)
+	closeTo("KlDivergence with p 0", KlDivergence([]float64{0, 0.5, 0.5}, []float64{0.25, 0.25, 0.5}), 0.34657359027997264)
+	if got := KlDivergence([]float64{0.5, 0.5}, []float64{1, 0}); !math.IsInf(got, 1) {
+		t.Errorf("KlDivergence with q 0 = %v, want +Inf", got)
+	}
+
+	ious := []struct {
+		i1, i2 Interval
+		want   float64
+	}{
+		{Interval{Lower: 1, Upper: 3}, Interval{Lower: 2, Upper: 4}, 1.0 / 3},
+		{Interval{Lower: 3, Upper: 1}, Interval{Lower: 2, Upper: 4}, 1.0 / 3},
+		{Interval{Lower: 1, Upper: 2}, Interval{Lower: 3, Upper: 4}, 0},
+		{Interval{Lower: 1, Upper: 4}, Interval{Lower: 2, Upper: 3}, 1.0 / 3},
+		{Interval{Lower: 0.5, Upper: 2.5}, Interval{Lower: 1.5, Upper: 2.25}, 0.375},
+	}
+	for _, i := range ious {
+		closeTo(fmt.Sprintf("Iou(%v, %v)", i.i1, i.i2), Iou(i.i1, i.i2), i.want)
+	}
+}
+
+// readCsv returns the records of a csv file without the header.
+func readCsv(t *testing.T, name string) [][]string {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records[1:]
+}
@@ -0,0 +1,40 @@
+package greetings
+
+import (
+	"cloud-benchmark-tool/common"
+	"reflect"
+	"testing"
+)
+
+// TestParseBenchmarkName splits key/value and positional parameters and the procs suffix.
+func TestParseBenchmarkName(t *testing.T) {
+	name := common.ParseBenchmarkName("BenchmarkEncode/size=1024/json-8", 0)
+	want := common.BenchmarkName{
+		Function: "BenchmarkEncode",
+		Sub:      "size=1024/json",
+		Params: []common.BenchmarkParam{
+			{Key: "size", Value: "1024", Level: 1},
+			{Value: "json", Level: 2},
+		},
+		Procs: 8,
+	}
+	if !reflect.DeepEqual(name, want) {
+		t.Fatalf(`ParseBenchmarkName = %+v, want %+v`, name, want)
+	}
+	if json := name.ParamsJSON(); json != `{"2":"json","size":"1024"}` {
+		t.Fatalf(`ParamsJSON() = %s`, json)
+	}
+}
+
+// TestParseBenchmarkNameKnownProcs keeps numeric suffixes which are part of the name.
+func TestParseBenchmarkNameKnownProcs(t *testing.T) {
+	name := common.ParseBenchmarkName("BenchmarkChunk/chunk-8", 1)
+	if name.Name() != "BenchmarkChunk/chunk-8" || name.Procs != 1 {
+		t.Fatalf(`ParseBenchmarkName = %+v, want unchanged name with procs 1`, name)
+	}
+
+	name = common.ParseBenchmarkName("BenchmarkChunk/a=1,b=2-4", 4)
+	if name.Name() != "BenchmarkChunk/a=1,b=2" || name.Procs != 4 || len(name.Params) != 2 {
+		t.Fatalf(`ParseBenchmarkName = %+v, want two params with procs 4`, name)
+	}
+}